@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"time"
 
@@ -30,6 +31,8 @@ import (
 
 var (
 	metricsFetcherInterval = flag.Duration("recommender-interval", 2*time.Hour, `How often metrics should be fetched`)
+	timeframeCheckInterval = flag.Duration("timeframe-check-interval", time.Minute, `How often timeframes are checked for having ended`)
+	runTimeout             = flag.Duration("run-timeout", time.Hour, `How long a run may query Prometheus before its remaining queries are cancelled`)
 	globalConfig           = flag.String("config-file", "", `Specifies global config file. The config file type is yaml`)
 )
 
@@ -43,13 +46,26 @@ func main() {
 	glog.V(1).Infof("Recommender %s", version.RecommenderVersion)
 	recommender := routines.NewRecommender(globalConfig)
 
-	recommender.RunOnce()
+	run(recommender.RunOnce)
+	runTicker := time.NewTicker(*metricsFetcherInterval)
+	timeframeTicker := time.NewTicker(*timeframeCheckInterval)
 	for {
 		select {
-		case <-time.After(*metricsFetcherInterval):
+		case <-runTicker.C:
 			{
-				recommender.RunOnce()
+				run(recommender.RunOnce)
+			}
+		case <-timeframeTicker.C:
+			{
+				run(recommender.RunTimeframes)
 			}
 		}
 	}
 }
+
+// run runs f with a context which is done after the run timeout.
+func run(f func(ctx context.Context)) {
+	ctx, cancel := context.WithTimeout(context.Background(), *runTimeout)
+	defer cancel()
+	f(ctx)
+}
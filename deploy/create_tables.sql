@@ -1,6 +1,12 @@
 CREATE TABLE IF NOT EXISTS `t_application` (
   `id` int(11) unsigned NOT NULL AUTO_INCREMENT,
   `name` varchar(64) NOT NULL DEFAULT '' COMMENT '应用名称',
+  `policy` text COMMENT '推荐策略，为空时使用全局策略',
+  `resource_policy` text COMMENT '资源策略，包括余量、上下限及不推荐的资源',
+  `update_policy` text COMMENT '更新策略，为空时使用全局配置',
+  `labels` text COMMENT '应用标签，供时间段的标签选择器匹配',
+  `label_schema` text COMMENT 'Prometheus 标签映射，为空时使用全局配置',
+  `clusters` text COMMENT '应用所在的集群，为空时为所有集群',
   `created` datetime DEFAULT NULL COMMENT '创建时间',
   `updated` datetime DEFAULT NULL COMMENT '修改时间',
   `deleted` datetime DEFAULT NULL COMMENT '删除时间',
@@ -12,12 +18,36 @@ CREATE TABLE IF NOT EXISTS `t_container_resource` (
   `name` varchar(64) NOT NULL COMMENT '容器名称',
   `application_id` int(11) NOT NULL COMMENT '关联应用ID',
   `timeframe_id` int(11) DEFAULT NULL COMMENT '指定时间段ID',
-  `cpu_limit` int(11) unsigned DEFAULT NULL,
-  `memory_limit` int(11) unsigned DEFAULT NULL,
-  `disk_read_io_limit` int(11) unsigned DEFAULT NULL,
-  `disk_write_io_limit` int(11) unsigned DEFAULT NULL,
-  `network_receive_io_limit` int(11) unsigned DEFAULT NULL,
-  `network_transmit_io_limit` int(11) unsigned DEFAULT NULL,
+  `cluster` varchar(64) NOT NULL DEFAULT '' COMMENT '集群名称，为空时为所有集群合并的推荐',
+  `cpu_limit` bigint(20) unsigned DEFAULT NULL,
+  `memory_limit` bigint(20) unsigned DEFAULT NULL,
+  `disk_read_io_limit` bigint(20) unsigned DEFAULT NULL,
+  `disk_write_io_limit` bigint(20) unsigned DEFAULT NULL,
+  `network_receive_io_limit` bigint(20) unsigned DEFAULT NULL,
+  `network_transmit_io_limit` bigint(20) unsigned DEFAULT NULL,
+  `cpu_request` bigint(20) unsigned DEFAULT NULL COMMENT 'CPU 推荐 request',
+  `memory_request` bigint(20) unsigned DEFAULT NULL COMMENT '内存推荐 request',
+  `cpu_lower_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐下限',
+  `cpu_upper_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐上限',
+  `memory_lower_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐下限',
+  `memory_upper_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐上限',
+  `disk_read_io_lower_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐下限',
+  `disk_read_io_upper_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐上限',
+  `disk_write_io_lower_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐下限',
+  `disk_write_io_upper_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐上限',
+  `network_receive_io_lower_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐下限',
+  `network_receive_io_upper_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐上限',
+  `network_transmit_io_lower_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐下限',
+  `network_transmit_io_upper_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐上限',
+  `confidence` double DEFAULT NULL COMMENT '置信度，即推荐所依据的有效数据天数',
+  `cpu_peak` bigint(20) unsigned DEFAULT NULL COMMENT '推荐所依据的峰值使用量',
+  `memory_peak` bigint(20) unsigned DEFAULT NULL COMMENT '推荐所依据的峰值使用量',
+  `disk_read_io_peak` bigint(20) unsigned DEFAULT NULL COMMENT '推荐所依据的峰值使用量',
+  `disk_write_io_peak` bigint(20) unsigned DEFAULT NULL COMMENT '推荐所依据的峰值使用量',
+  `network_receive_io_peak` bigint(20) unsigned DEFAULT NULL COMMENT '推荐所依据的峰值使用量',
+  `network_transmit_io_peak` bigint(20) unsigned DEFAULT NULL COMMENT '推荐所依据的峰值使用量',
+  `pending_runs` int(11) NOT NULL DEFAULT 0 COMMENT 'hysteresis 更新策略下连续超出阈值的次数',
+  `pending_direction` tinyint(4) NOT NULL DEFAULT 0 COMMENT '连续超出阈值的方向：1 为升高，-1 为降低',
   `created` datetime DEFAULT NULL,
   `updated` datetime DEFAULT NULL,
   PRIMARY KEY (`id`)
@@ -26,12 +56,76 @@ CREATE TABLE IF NOT EXISTS `t_container_resource` (
 CREATE TABLE IF NOT EXISTS `t_timeframe` (
   `id` int(11) unsigned NOT NULL AUTO_INCREMENT,
   `name` varchar(64) NOT NULL DEFAULT '' COMMENT '名称',
-  `start` datetime NOT NULL COMMENT '开始时间',
-  `end` datetime NOT NULL COMMENT '结束时间',
-  `status` varchar(10) DEFAULT NULL COMMENT '执行状态',
+  `start` datetime DEFAULT NULL COMMENT '开始时间',
+  `end` datetime DEFAULT NULL COMMENT '结束时间',
+  `schedule` varchar(64) DEFAULT NULL COMMENT '周期时间段的 cron 表达式，为空表示一次性时间段',
+  `duration` varchar(16) DEFAULT NULL COMMENT '周期时间段每次持续时长',
+  `last_occurrence` datetime DEFAULT NULL COMMENT '已计算的最近一次周期结束时间',
+  `status` varchar(10) DEFAULT NULL COMMENT '执行状态：off、scheduled、pending、running、succeeded、failed、projected',
+  `error` text COMMENT '最近一次计算失败的原因',
+  `attempts` int(11) NOT NULL DEFAULT 0 COMMENT '本次计算已尝试的次数',
+  `next_attempt` datetime DEFAULT NULL COMMENT '失败后下次重试的时间',
+  `time_zone` varchar(64) DEFAULT NULL COMMENT 'IANA 时区，周期按该时区触发，为空表示服务器本地时区',
+  `selector` text COMMENT '标签选择器，选择具有全部标签的应用',
+  `projected_from` varchar(64) DEFAULT NULL COMMENT '预测时间段的来源时间段名称',
   `description` varchar(255) DEFAULT NULL COMMENT '描述',
   `created` datetime DEFAULT NULL COMMENT '创建时间',
   `updated` datetime DEFAULT NULL COMMENT '修改时间',
   `deleted` datetime DEFAULT NULL COMMENT '删除时间',
   PRIMARY KEY (`id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `t_checkpoint` (
+  `id` int(11) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键',
+  `application_id` int(11) NOT NULL COMMENT '关联应用ID',
+  `container_name` varchar(64) NOT NULL COMMENT '容器名称',
+  `cluster` varchar(64) NOT NULL DEFAULT '' COMMENT '数据来源的集群名称，未配置集群时为空',
+  `last_sample_time` datetime NOT NULL COMMENT '已聚合数据的截止时间',
+  `state` mediumtext COMMENT '聚合状态（峰值与直方图）',
+  `created` datetime DEFAULT NULL COMMENT '创建时间',
+  `updated` datetime DEFAULT NULL COMMENT '修改时间',
+  PRIMARY KEY (`id`),
+  KEY `idx_application_id` (`application_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `t_recommendation_history` (
+  `id` int(11) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键',
+  `name` varchar(64) NOT NULL COMMENT '容器名称',
+  `application_id` int(11) NOT NULL COMMENT '关联应用ID',
+  `timeframe_id` int(11) DEFAULT NULL COMMENT '指定时间段ID',
+  `cluster` varchar(64) NOT NULL DEFAULT '' COMMENT '集群名称，为空时为所有集群合并的推荐',
+  `version` int(11) NOT NULL COMMENT '推荐版本，推荐值变化时递增',
+  `cpu_limit` bigint(20) unsigned DEFAULT NULL,
+  `memory_limit` bigint(20) unsigned DEFAULT NULL,
+  `disk_read_io_limit` bigint(20) unsigned DEFAULT NULL,
+  `disk_write_io_limit` bigint(20) unsigned DEFAULT NULL,
+  `network_receive_io_limit` bigint(20) unsigned DEFAULT NULL,
+  `network_transmit_io_limit` bigint(20) unsigned DEFAULT NULL,
+  `cpu_request` bigint(20) unsigned DEFAULT NULL COMMENT 'CPU 推荐 request',
+  `memory_request` bigint(20) unsigned DEFAULT NULL COMMENT '内存推荐 request',
+  `cpu_lower_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐下限',
+  `cpu_upper_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐上限',
+  `memory_lower_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐下限',
+  `memory_upper_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐上限',
+  `disk_read_io_lower_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐下限',
+  `disk_read_io_upper_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐上限',
+  `disk_write_io_lower_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐下限',
+  `disk_write_io_upper_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐上限',
+  `network_receive_io_lower_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐下限',
+  `network_receive_io_upper_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐上限',
+  `network_transmit_io_lower_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐下限',
+  `network_transmit_io_upper_bound` bigint(20) unsigned DEFAULT NULL COMMENT '推荐上限',
+  `confidence` double DEFAULT NULL COMMENT '置信度，即推荐所依据的有效数据天数',
+  `created` datetime DEFAULT NULL COMMENT '创建时间',
+  PRIMARY KEY (`id`),
+  KEY `idx_application_id_created` (`application_id`, `created`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `t_timeframe_application` (
+  `id` int(11) unsigned NOT NULL AUTO_INCREMENT COMMENT '主键',
+  `timeframe_id` int(11) NOT NULL COMMENT '关联时间段ID',
+  `application_id` int(11) NOT NULL COMMENT '关联应用ID',
+  `created` datetime DEFAULT NULL COMMENT '创建时间',
+  PRIMARY KEY (`id`),
+  KEY `idx_timeframe_id` (`timeframe_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
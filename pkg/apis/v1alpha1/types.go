@@ -36,13 +36,13 @@ type ApplicationStore interface {
 // RecommendResourceStore defines store RecommendResource
 type RecommendResourceStore interface {
 	// RecommendResource CRUD
-	GetApplicationResource(name string) (*ApplicationResource, error)
+	GetApplicationResource(name, cluster string) (*ApplicationResource, error)
 
 	DeleteApplicationResource(name string) error
 
 	DeleteTimeframeResource(name string) error
 
-	ListApplicationResource() ([]*ApplicationResource, error)
+	ListApplicationResource(cluster string) ([]*ApplicationResource, error)
 
 	AddOrUpdateContainerResource(resource []*ContainerResource) error
 
@@ -57,6 +57,8 @@ type TimeframeStore interface {
 
 	GetTimeframe(name string) (*Timeframe, error)
 
+	GetTimeframeByID(id int64) (*Timeframe, error)
+
 	ListTimeframe() ([]*Timeframe, error)
 
 	UpdateTimeframe(frame *Timeframe) error
@@ -68,51 +70,508 @@ type TimeframeStore interface {
 
 // Application defines application info.
 type Application struct {
-	ID      int64     `json:"id"      form:"id"         xorm:"pk autoincr 'id'"`
-	Name    string    `json:"name"    form:"name"       xorm:"name"`
-	Created time.Time `json:"created"                   xorm:"created"`
-	Updated time.Time `json:"updated"                   xorm:"updated"`
-	Deleted time.Time `json:"deleted"                   xorm:"deleted"`
+	ID   int64  `json:"id"      form:"id"         xorm:"pk autoincr 'id'"`
+	Name string `json:"name"    form:"name"       xorm:"name"`
+	// Policy overrides the global recommendation policy, nil means using the global one.
+	Policy *RecommendationPolicy `json:"policy,omitempty"          xorm:"json 'policy'"`
+	// ResourcePolicy adjusts the recommendations of the application's containers.
+	ResourcePolicy *ResourcePolicy `json:"resource_policy,omitempty" xorm:"json 'resource_policy'"`
+	// UpdatePolicy overrides the global update policy, nil means using the global one.
+	UpdatePolicy *UpdatePolicy `json:"update_policy,omitempty"   xorm:"json 'update_policy'"`
+	// Labels are matched by the selectors of timeframes.
+	Labels map[string]string `json:"labels,omitempty"          xorm:"json 'labels'"`
+	// LabelSchema overrides the global label schema, nil means using the global one.
+	LabelSchema *LabelSchema `json:"label_schema,omitempty"    xorm:"json 'label_schema'"`
+	// Clusters are the clusters the application runs in, empty means all clusters.
+	Clusters []string  `json:"clusters,omitempty"        xorm:"json 'clusters'"`
+	Created  time.Time `json:"created"                   xorm:"created"`
+	Updated  time.Time `json:"updated"                   xorm:"updated"`
+	Deleted  time.Time `json:"deleted"                   xorm:"deleted"`
+}
+
+// RunsIn returns true if the application runs in the cluster.
+func (a *Application) RunsIn(cluster string) bool {
+	if len(a.Clusters) == 0 {
+		return true
+	}
+	for _, name := range a.Clusters {
+		if name == cluster {
+			return true
+		}
+	}
+	return false
+}
+
+// LabelSchema maps the container series in Prometheus to the applications.
+// Zero valued fields fall back to the global schema.
+type LabelSchema struct {
+	// Application is the label of the application name, e.g. system_mwType_serviceID.
+	Application string `json:"application,omitempty" yaml:"application"`
+	// Container is the label of the container name, e.g. container_name, or container with newer cAdvisor.
+	Container string `json:"container,omitempty"   yaml:"container"`
+	// Instance are the labels which identify an instance of a container, e.g. name, or namespace and pod.
+	Instance []string `json:"instance,omitempty"    yaml:"instance"`
+	// Selector is the base selector of the container series, e.g. container!="POD",image!="".
+	Selector string `json:"selector,omitempty"    yaml:"selector"`
+}
+
+const (
+	// UpdateModeRatchet only lets stored recommendations grow.
+	UpdateModeRatchet = "ratchet"
+	// UpdateModeReplace always stores the latest recommendations.
+	UpdateModeReplace = "replace"
+	// UpdateModeHysteresis stores the latest recommendations once they have
+	// differed from the stored ones by more than the threshold for a number
+	// of consecutive runs.
+	UpdateModeHysteresis = "hysteresis"
+)
+
+// UpdatePolicy decides how new recommendations replace the stored ones.
+// Zero valued fields fall back to the global policy.
+type UpdatePolicy struct {
+	// Mode is one of ratchet, replace or hysteresis.
+	Mode string `json:"mode"                yaml:"mode"`
+	// Threshold is the change in percent the hysteresis mode ignores, e.g. 10
+	Threshold float64 `json:"threshold,omitempty" yaml:"threshold"`
+	// Runs is the number of consecutive runs a change must exceed the threshold in hysteresis mode.
+	Runs int `json:"runs,omitempty"      yaml:"runs"`
 }
 
-// ContainerResource defines container of application resource
+// DefaultContainerResourcePolicy is the container name of the policy
+// applied to containers which don't have a policy of their own.
+const DefaultContainerResourcePolicy = "*"
+
+// ResourcePolicy controls how recommendations are adjusted before they are persisted.
+type ResourcePolicy struct {
+	// ContainerPolicies for individual containers.
+	ContainerPolicies []ContainerResourcePolicy `json:"container_policies"`
+}
+
+// ContainerResourcePolicy controls how recommendations are adjusted for a container.
+type ContainerResourcePolicy struct {
+	// ContainerName is the name of the container or DefaultContainerResourcePolicy.
+	ContainerName string `json:"container_name"`
+	// Resources maps a resource name (cpu, memory, disk-read-io, disk-write-io,
+	// network-receive-io, network-transmit-io) to its bounds.
+	Resources map[string]ResourceBounds `json:"resources"`
+}
+
+// ResourceBounds defines the margin and the allowed range of a resource recommendation.
+// Amounts are in recommendation units, i.e. CPU in millicores and memory in bytes.
+type ResourceBounds struct {
+	// Margin is the percentage added to the recommendation, e.g. 15 means 15%.
+	Margin float64 `json:"margin,omitempty"`
+	// MinAllowed is the lowest recommendation, 0 means no floor.
+	MinAllowed int64 `json:"min_allowed,omitempty"`
+	// MaxAllowed is the highest recommendation, 0 means no ceiling.
+	MaxAllowed int64 `json:"max_allowed,omitempty"`
+	// Off disables the recommendation of the resource, which is then stored as 0.
+	Off bool `json:"off,omitempty"`
+}
+
+const (
+	// PolicyMax recommends the peak usage.
+	PolicyMax = "max"
+	// PolicyPercentile recommends a percentile of the usage distribution.
+	PolicyPercentile = "percentile"
+	// PolicyStdDev recommends the mean usage plus k standard deviations.
+	PolicyStdDev = "stddev"
+	// PolicyMargin recommends the peak usage multiplied by a margin.
+	PolicyMargin = "margin"
+)
+
+const (
+	// QoSClassBurstable recommends requests from the typical usage and limits from the peaks.
+	QoSClassBurstable = "Burstable"
+	// QoSClassGuaranteed recommends requests equal to the limits.
+	QoSClassGuaranteed = "Guaranteed"
+)
+
+// RecommendationPolicy selects the rule used to derive recommendations from aggregated usage.
+// The rule selected by Name derives the limits, requests are a percentile of the usage.
+// Zero valued parameters fall back to the global policy.
+type RecommendationPolicy struct {
+	// Name is one of max, percentile, stddev or margin.
+	Name string `json:"name"                  yaml:"policy"`
+	// Percentiles maps a resource name to the usage percentile recommended for it, e.g. cpu: 0.95
+	Percentiles map[string]float64 `json:"percentiles,omitempty" yaml:"percentiles"`
+	// StdDevs is the k in mean + k * stddev.
+	StdDevs float64 `json:"stddevs,omitempty"     yaml:"stddevs"`
+	// Margin is the factor the peak is multiplied with, e.g. 1.2
+	Margin float64 `json:"margin,omitempty"      yaml:"margin"`
+	// RequestPercentile is the usage percentile recommended as the cpu and memory requests, e.g. 0.9
+	RequestPercentile float64 `json:"request_percentile,omitempty" yaml:"requestPercentile"`
+	// QoSClass is Burstable or Guaranteed and decides how requests relate to limits.
+	QoSClass string `json:"qos_class,omitempty"          yaml:"qosClass"`
+}
+
+// ContainerResource defines container of application resource.
+// PendingRuns counts the consecutive runs whose recommendation was held back
+// by the hysteresis UpdatePolicy, which is not persisted. PendingDirection is
+// 1 if they were higher than the stored one, -1 if lower.
+// Cluster is the cluster of a per-cluster recommendation, empty for the one
+// merged over all clusters. UsagePeaks are the peaks the recommendation is
+// computed from, they are never held back by the UpdatePolicy.
 type ContainerResource struct {
-	ID                     int64     `json:"id"                             xorm:"pk autoincr 'id'"`
-	Name                   string    `json:"name"                           xorm:"name"`
-	ApplicationID          int64     `json:"application_id"                 xorm:"application_id"`
-	TimeframeID            int64     `json:"timeframe_id"                   xorm:"timeframe_id"`
-	CPULimit               int64     `json:"cpu_limit"                      xorm:"cpu_limit"`
-	MemoryLimit            int64     `json:"memory_limit"                   xorm:"memory_limit"`
-	DiskReadIOLimit        int64     `json:"disk_read_io_limit"             xorm:"disk_read_io_limit"`
-	DiskWriteIOLimit       int64     `json:"disk_write_io_limit"            xorm:"disk_write_io_limit"`
-	NetworkReceiveIOLimit  int64     `json:"network_receive_io_limit"       xorm:"network_receive_io_limit"`
-	NetworkTransmitIOLimit int64     `json:"network_transmit_io_limit"      xorm:"network_transmit_io_limit"`
-	Created                time.Time `json:"created"                        xorm:"created"`
-	Updated                time.Time `json:"updated"                        xorm:"updated"`
+	ID                   int64  `json:"id"                                xorm:"pk autoincr 'id'"`
+	Name                 string `json:"name"                              xorm:"name"`
+	ApplicationID        int64  `json:"application_id"                    xorm:"application_id"`
+	TimeframeID          int64  `json:"timeframe_id"                      xorm:"timeframe_id"`
+	Cluster              string `json:"cluster,omitempty"                 xorm:"cluster"`
+	RecommendedResources `xorm:"extends"`
+	UsagePeaks           `xorm:"extends"`
+	PendingRuns          int           `json:"pending_runs"                      xorm:"pending_runs"`
+	PendingDirection     int           `json:"pending_direction"                 xorm:"pending_direction"`
+	UpdatePolicy         *UpdatePolicy `json:"-"                                 xorm:"-"`
+	Created              time.Time     `json:"created"                           xorm:"created"`
+	Updated              time.Time     `json:"updated"                           xorm:"updated"`
+}
+
+// RecommendedResources holds the recommendation of a container.
+// The *Limit fields hold the target recommendation, which is expected within
+// the lower and upper bounds. The requests never exceed the limits.
+// Confidence is the number of days of usage data backing the recommendation.
+type RecommendedResources struct {
+	CPULimit                    int64   `json:"cpu_limit"                         xorm:"cpu_limit"`
+	MemoryLimit                 int64   `json:"memory_limit"                      xorm:"memory_limit"`
+	DiskReadIOLimit             int64   `json:"disk_read_io_limit"                xorm:"disk_read_io_limit"`
+	DiskWriteIOLimit            int64   `json:"disk_write_io_limit"               xorm:"disk_write_io_limit"`
+	NetworkReceiveIOLimit       int64   `json:"network_receive_io_limit"          xorm:"network_receive_io_limit"`
+	NetworkTransmitIOLimit      int64   `json:"network_transmit_io_limit"         xorm:"network_transmit_io_limit"`
+	CPURequest                  int64   `json:"cpu_request"                       xorm:"cpu_request"`
+	MemoryRequest               int64   `json:"memory_request"                    xorm:"memory_request"`
+	CPULowerBound               int64   `json:"cpu_lower_bound"                   xorm:"cpu_lower_bound"`
+	CPUUpperBound               int64   `json:"cpu_upper_bound"                   xorm:"cpu_upper_bound"`
+	MemoryLowerBound            int64   `json:"memory_lower_bound"                xorm:"memory_lower_bound"`
+	MemoryUpperBound            int64   `json:"memory_upper_bound"                xorm:"memory_upper_bound"`
+	DiskReadIOLowerBound        int64   `json:"disk_read_io_lower_bound"          xorm:"disk_read_io_lower_bound"`
+	DiskReadIOUpperBound        int64   `json:"disk_read_io_upper_bound"          xorm:"disk_read_io_upper_bound"`
+	DiskWriteIOLowerBound       int64   `json:"disk_write_io_lower_bound"         xorm:"disk_write_io_lower_bound"`
+	DiskWriteIOUpperBound       int64   `json:"disk_write_io_upper_bound"         xorm:"disk_write_io_upper_bound"`
+	NetworkReceiveIOLowerBound  int64   `json:"network_receive_io_lower_bound"    xorm:"network_receive_io_lower_bound"`
+	NetworkReceiveIOUpperBound  int64   `json:"network_receive_io_upper_bound"    xorm:"network_receive_io_upper_bound"`
+	NetworkTransmitIOLowerBound int64   `json:"network_transmit_io_lower_bound"   xorm:"network_transmit_io_lower_bound"`
+	NetworkTransmitIOUpperBound int64   `json:"network_transmit_io_upper_bound"   xorm:"network_transmit_io_upper_bound"`
+	Confidence                  float64 `json:"confidence"                        xorm:"confidence"`
+}
+
+// Values returns the recommended amounts keyed by their JSON names.
+func (r *RecommendedResources) Values() map[string]int64 {
+	return map[string]int64{
+		"cpu_limit":                       r.CPULimit,
+		"memory_limit":                    r.MemoryLimit,
+		"disk_read_io_limit":              r.DiskReadIOLimit,
+		"disk_write_io_limit":             r.DiskWriteIOLimit,
+		"network_receive_io_limit":        r.NetworkReceiveIOLimit,
+		"network_transmit_io_limit":       r.NetworkTransmitIOLimit,
+		"cpu_request":                     r.CPURequest,
+		"memory_request":                  r.MemoryRequest,
+		"cpu_lower_bound":                 r.CPULowerBound,
+		"cpu_upper_bound":                 r.CPUUpperBound,
+		"memory_lower_bound":              r.MemoryLowerBound,
+		"memory_upper_bound":              r.MemoryUpperBound,
+		"disk_read_io_lower_bound":        r.DiskReadIOLowerBound,
+		"disk_read_io_upper_bound":        r.DiskReadIOUpperBound,
+		"disk_write_io_lower_bound":       r.DiskWriteIOLowerBound,
+		"disk_write_io_upper_bound":       r.DiskWriteIOUpperBound,
+		"network_receive_io_lower_bound":  r.NetworkReceiveIOLowerBound,
+		"network_receive_io_upper_bound":  r.NetworkReceiveIOUpperBound,
+		"network_transmit_io_lower_bound": r.NetworkTransmitIOLowerBound,
+		"network_transmit_io_upper_bound": r.NetworkTransmitIOUpperBound,
+	}
+}
+
+// Limits returns the recommended limits keyed by the resource names.
+func (r *RecommendedResources) Limits() map[string]int64 {
+	return map[string]int64{
+		"cpu":                 r.CPULimit,
+		"memory":              r.MemoryLimit,
+		"disk-read-io":        r.DiskReadIOLimit,
+		"disk-write-io":       r.DiskWriteIOLimit,
+		"network-receive-io":  r.NetworkReceiveIOLimit,
+		"network-transmit-io": r.NetworkTransmitIOLimit,
+	}
+}
+
+// UsagePeaks holds the peak usage of a container, before any margin, resource
+// policy or update policy is applied.
+type UsagePeaks struct {
+	CPUPeak               int64 `json:"cpu_peak"                 xorm:"cpu_peak"`
+	MemoryPeak            int64 `json:"memory_peak"              xorm:"memory_peak"`
+	DiskReadIOPeak        int64 `json:"disk_read_io_peak"        xorm:"disk_read_io_peak"`
+	DiskWriteIOPeak       int64 `json:"disk_write_io_peak"       xorm:"disk_write_io_peak"`
+	NetworkReceiveIOPeak  int64 `json:"network_receive_io_peak"  xorm:"network_receive_io_peak"`
+	NetworkTransmitIOPeak int64 `json:"network_transmit_io_peak" xorm:"network_transmit_io_peak"`
+}
+
+// Peaks returns the peak usages keyed by the resource names.
+func (p *UsagePeaks) Peaks() map[string]int64 {
+	return map[string]int64{
+		"cpu":                 p.CPUPeak,
+		"memory":              p.MemoryPeak,
+		"disk-read-io":        p.DiskReadIOPeak,
+		"disk-write-io":       p.DiskWriteIOPeak,
+		"network-receive-io":  p.NetworkReceiveIOPeak,
+		"network-transmit-io": p.NetworkTransmitIOPeak,
+	}
+}
+
+// RecommendationHistory is a version of the recommendation of a container.
+// A version is written only when the recommended amounts change.
+type RecommendationHistory struct {
+	ID                   int64  `json:"id"                                xorm:"pk autoincr 'id'"`
+	Name                 string `json:"name"                              xorm:"name"`
+	ApplicationID        int64  `json:"application_id"                    xorm:"application_id"`
+	TimeframeID          int64  `json:"timeframe_id"                      xorm:"timeframe_id"`
+	Cluster              string `json:"cluster,omitempty"                 xorm:"cluster"`
+	Version              int64  `json:"version"                           xorm:"'version'"`
+	RecommendedResources `xorm:"extends"`
+	Created              time.Time `json:"created"                           xorm:"created"`
+}
+
+// RecommendationDiff compares the recommendations of a container at two points in time.
+// From or To is nil if the container had no recommendation at that time.
+type RecommendationDiff struct {
+	Name    string                     `json:"name"`
+	From    *RecommendationHistory     `json:"from"`
+	To      *RecommendationHistory     `json:"to"`
+	Changes map[string]*ResourceChange `json:"changes"`
+}
+
+// ResourceChange is the change of a recommended amount.
+// Ratio is the change in percent of From, 0 if From is 0.
+type ResourceChange struct {
+	From  int64   `json:"from"`
+	To    int64   `json:"to"`
+	Delta int64   `json:"delta"`
+	Ratio float64 `json:"ratio"`
+}
+
+// TimeframeReport compares the recommendations of a timeframe with the
+// baseline recommendations of the same containers.
+type TimeframeReport struct {
+	Timeframe    string               `json:"timeframe"`
+	Applications []*ApplicationReport `json:"applications"`
+	// TopGrowth lists the applications by their largest ratio, descending.
+	TopGrowth []*ApplicationGrowth `json:"top_growth"`
+}
+
+// ApplicationReport compares the recommendations of the containers of an application.
+type ApplicationReport struct {
+	Name       string             `json:"name"`
+	Containers []*ContainerReport `json:"containers"`
+}
+
+// ContainerReport compares the peak usage of a container in a timeframe with
+// its baseline one, keyed by the resource names. Ratios is the timeframe peak
+// divided by the baseline one, resources with a zero baseline are left out.
+type ContainerReport struct {
+	Name      string             `json:"name"`
+	Timeframe map[string]int64   `json:"timeframe"`
+	Baseline  map[string]int64   `json:"baseline"`
+	Ratios    map[string]float64 `json:"ratios"`
+}
+
+// ApplicationGrowth is the largest ratio of an application, found for the
+// given container and resource.
+type ApplicationGrowth struct {
+	Name      string  `json:"name"`
+	Container string  `json:"container"`
+	Resource  string  `json:"resource"`
+	Ratio     float64 `json:"ratio"`
 }
 
 type StatusName string
 
+// The lifecycle of a timeframe. A timeframe switched on is pending, or
+// scheduled if it has not ended yet, and is computed once it has ended.
+// A failed computation is retried with backoff, and an interrupted one right
+// away, until MaxTimeframeAttempts attempts have failed. A recurring timeframe
+// is computed again whenever another occurrence has finished.
 const (
-	StatusOn  = "on"
+	// StatusOn switches a timeframe on, it is stored as pending or scheduled.
+	StatusOn = "on"
+	// StatusOff switches a timeframe off, it is not computed.
 	StatusOff = "off"
+	// StatusScheduled is the status of a switched on timeframe which has not
+	// ended yet. It is computed as soon as it ends.
+	StatusScheduled = "scheduled"
+	// StatusPending is the status of a timeframe waiting to be computed.
+	StatusPending = "pending"
+	// StatusRunning is the status of a timeframe being computed.
+	StatusRunning = "running"
+	// StatusSucceeded is the status of a timeframe whose recommendations are stored.
+	StatusSucceeded = "succeeded"
+	// StatusFailed is the status of a timeframe whose last computation failed.
+	StatusFailed = "failed"
+	// StatusProjected is the status of a timeframe whose recommendations are
+	// projected from another timeframe, it is not computed.
+	StatusProjected = "projected"
 )
 
-// Timeframe defines query time frame
+// MaxTimeframeAttempts is the number of attempts of a timeframe computation
+// after which it is not retried anymore.
+const MaxTimeframeAttempts = 5
+
+// Timeframe defines query time frame. A one-off timeframe is the window
+// from Start to End. A recurring timeframe has a cron Schedule of the starts
+// of its occurrences, each lasting Duration, and its recommendation
+// aggregates every occurrence finished within the history. LastOccurrence
+// is the end of the latest occurrence the recommendation includes.
+// Error and Attempts describe the last computation, a failed one is retried
+// at NextAttempt. TimeZone is the IANA time zone the timeframe is defined
+// in, its schedule fires in it and its times are shown in it by default.
 type Timeframe struct {
-	ID          int64     `json:"id"                  xorm:"pk autoincr 'id'"`
-	Name        string    `json:"name"                xorm:"name"`
-	Start       time.Time `json:"start"               xorm:"start"`
-	End         time.Time `json:"end"                 xorm:"end"`
-	Status      string    `json:"status"              xorm:"status"`
-	Description string    `json:"description"         xorm:"description"`
-	Created     time.Time `json:"created"             xorm:"created"`
-	Updated     time.Time `json:"updated"             xorm:"updated"`
-	Deleted     time.Time `json:"deleted"             xorm:"deleted"`
+	ID             int64     `json:"id"                  xorm:"pk autoincr 'id'"`
+	Name           string    `json:"name"                xorm:"name"`
+	Start          time.Time `json:"start"               xorm:"start"`
+	End            time.Time `json:"end"                 xorm:"end"`
+	Schedule       string    `json:"schedule"            xorm:"schedule"`
+	Duration       string    `json:"duration"            xorm:"duration"`
+	LastOccurrence time.Time `json:"last_occurrence"     xorm:"last_occurrence"`
+	Status         string    `json:"status"              xorm:"status"`
+	Error          string    `json:"error"               xorm:"error"`
+	Attempts       int       `json:"attempts"            xorm:"attempts"`
+	NextAttempt    time.Time `json:"next_attempt"        xorm:"next_attempt"`
+	TimeZone       string    `json:"time_zone"           xorm:"time_zone"`
+	// Applications are the names of the applications in the scope of the
+	// timeframe, stored in t_timeframe_application.
+	Applications []string `json:"applications,omitempty" xorm:"-"`
+	// Scoped is set if the timeframe was stored with applications, even if
+	// all of them have been deleted since, so that it includes none then.
+	Scoped bool `json:"-" xorm:"-"`
+	// Selector selects the applications with all of its labels into the scope.
+	Selector map[string]string `json:"selector,omitempty"  xorm:"json 'selector'"`
+	// ProjectedFrom is the name of the timeframe a projected timeframe is projected from.
+	ProjectedFrom string    `json:"projected_from,omitempty" xorm:"projected_from"`
+	Description   string    `json:"description"         xorm:"description"`
+	Created       time.Time `json:"created"             xorm:"created"`
+	Updated       time.Time `json:"updated"             xorm:"updated"`
+	Deleted       time.Time `json:"deleted"             xorm:"deleted"`
+}
+
+// IncludesAll returns true if the timeframe never named an application and
+// has no selector, it includes all applications then.
+func (t *Timeframe) IncludesAll() bool {
+	return len(t.Applications) == 0 && !t.Scoped && len(t.Selector) == 0
+}
+
+// Includes returns true if the application is in the scope of the timeframe,
+// i.e. it is named by the timeframe or matches its selector, or the timeframe
+// includes all applications.
+func (t *Timeframe) Includes(application *Application) bool {
+	if t.IncludesAll() {
+		return true
+	}
+	for _, name := range t.Applications {
+		if name == application.Name {
+			return true
+		}
+	}
+	if len(t.Selector) == 0 {
+		return false
+	}
+	for key, value := range t.Selector {
+		if labelValue, ok := application.Labels[key]; !ok || labelValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Levels of a TimeframeIssue.
+const (
+	// IssueError rejects the timeframe.
+	IssueError = "error"
+	// IssueWarning is reported but doesn't reject the timeframe.
+	IssueWarning = "warning"
+)
+
+// TimeframeIssue is a problem found validating a timeframe. Timeframe names
+// the existing timeframe it conflicts with, if any.
+type TimeframeIssue struct {
+	Level     string `json:"level"`
+	Timeframe string `json:"timeframe,omitempty"`
+	Message   string `json:"message"`
+}
+
+// TimeframeApplication names an application in the scope of a timeframe.
+type TimeframeApplication struct {
+	ID            int64     `json:"id"             xorm:"pk autoincr 'id'"`
+	TimeframeID   int64     `json:"timeframe_id"   xorm:"timeframe_id"`
+	ApplicationID int64     `json:"application_id" xorm:"application_id"`
+	Created       time.Time `json:"created"        xorm:"created"`
+}
+
+// IsRecurring returns true if the timeframe repeats on a schedule.
+func (t *Timeframe) IsRecurring() bool {
+	return len(t.Schedule) != 0
+}
+
+// Location returns the location of the timeframe's time zone, the local time
+// zone if it has none or it is unknown.
+func (t *Timeframe) Location() *time.Location {
+	if len(t.TimeZone) == 0 {
+		return time.Local
+	}
+	location, err := time.LoadLocation(t.TimeZone)
+	if err != nil {
+		return time.Local
+	}
+	return location
+}
+
+// In sets the location of the timeframe's times, leaving unset times zero.
+func (t *Timeframe) In(location *time.Location) {
+	for _, tp := range []*time.Time{&t.Start, &t.End, &t.LastOccurrence, &t.NextAttempt, &t.Created, &t.Updated} {
+		if !tp.IsZero() {
+			*tp = tp.In(location)
+		}
+	}
 }
 
 type ApplicationResource struct {
 	ID                int64                `json:"id"`
 	Name              string               `json:"name"`
+	Cluster           string               `json:"cluster,omitempty"`
 	ContainerResource []*ContainerResource `json:"container_resource"`
 }
+
+// Checkpoint holds the usage aggregated for a container of an application,
+// so later runs only need to query the metrics collected since LastSampleTime,
+// the end of the usage window aggregated in the state. Cluster is the cluster
+// the usage was read from, empty if no clusters are configured.
+type Checkpoint struct {
+	ID             int64                     `json:"id"                  xorm:"pk autoincr 'id'"`
+	ApplicationID  int64                     `json:"application_id"      xorm:"application_id"`
+	ContainerName  string                    `json:"container_name"      xorm:"container_name"`
+	Cluster        string                    `json:"cluster,omitempty"   xorm:"cluster"`
+	LastSampleTime time.Time                 `json:"last_sample_time"    xorm:"last_sample_time"`
+	State          *ContainerStateCheckpoint `json:"state"               xorm:"json 'state'"`
+	Created        time.Time                 `json:"created"             xorm:"created"`
+	Updated        time.Time                 `json:"updated"             xorm:"updated"`
+}
+
+// ContainerStateCheckpoint is the serialized aggregated usage of a container.
+type ContainerStateCheckpoint struct {
+	// Peaks maps a resource name to the peak usage of the resource.
+	Peaks map[string]int64 `json:"peaks"`
+	// WindowPeaks maps a resource name to the peak usage of the resource within
+	// each day, keyed by the Unix time the day starts at.
+	WindowPeaks map[string]map[int64]int64 `json:"window_peaks"`
+	// Histograms maps a resource name to the usage distribution of the resource.
+	Histograms        map[string]*HistogramCheckpoint `json:"histograms"`
+	FirstSampleStart  time.Time                       `json:"first_sample_start"`
+	LastSampleStart   time.Time                       `json:"last_sample_start"`
+	TotalSamplesCount int                             `json:"total_samples_count"`
+}
+
+// HistogramCheckpoint contains data needed to reconstruct the histogram.
+type HistogramCheckpoint struct {
+	// Reference timestamp for samples collected within this histogram.
+	ReferenceTimestamp time.Time `json:"reference_timestamp,omitempty"`
+	// Map from bucket index to bucket weight.
+	BucketWeights map[int]uint32 `json:"bucket_weights,omitempty"`
+	// Sum of samples to be used as denominator for weights from BucketWeights.
+	TotalWeight float64 `json:"total_weight,omitempty"`
+}
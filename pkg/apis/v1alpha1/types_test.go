@@ -0,0 +1,65 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeframeIncludes(t *testing.T) {
+	web := &Application{Name: "web", Labels: map[string]string{"team": "shop", "tier": "frontend"}}
+	batch := &Application{Name: "batch", Labels: map[string]string{"team": "data"}}
+	for _, c := range []struct {
+		timeframe Timeframe
+		web       bool
+		batch     bool
+	}{
+		{Timeframe{}, true, true},
+		{Timeframe{Applications: []string{"batch"}}, false, true},
+		{Timeframe{Selector: map[string]string{"team": "shop"}}, true, false},
+		{Timeframe{Selector: map[string]string{"team": "shop", "tier": "backend"}}, false, false},
+		{Timeframe{Applications: []string{"batch"}, Selector: map[string]string{"tier": "frontend"}}, true, true},
+		// All the applications of the timeframe have been deleted.
+		{Timeframe{Scoped: true}, false, false},
+	} {
+		if got := c.timeframe.Includes(web); got != c.web {
+			t.Errorf("%+v includes web: got %v, want %v", c.timeframe, got, c.web)
+		}
+		if got := c.timeframe.Includes(batch); got != c.batch {
+			t.Errorf("%+v includes batch: got %v, want %v", c.timeframe, got, c.batch)
+		}
+	}
+}
+
+func TestTimeframeIn(t *testing.T) {
+	timeframe := &Timeframe{
+		Start:    time.Date(2018, 11, 10, 16, 0, 0, 0, time.UTC),
+		End:      time.Date(2018, 11, 11, 16, 0, 0, 0, time.UTC),
+		TimeZone: "Asia/Shanghai",
+	}
+	timeframe.In(timeframe.Location())
+	if got := timeframe.Start.Format(time.RFC3339); got != "2018-11-11T00:00:00+08:00" {
+		t.Errorf("start: got %s, want 2018-11-11T00:00:00+08:00", got)
+	}
+	if !timeframe.NextAttempt.IsZero() {
+		t.Errorf("unset next attempt: got %v, want zero", timeframe.NextAttempt)
+	}
+	if location := (&Timeframe{TimeZone: "Nowhere/City"}).Location(); location != time.Local {
+		t.Errorf("unknown time zone: got %v, want Local", location)
+	}
+}
@@ -54,10 +54,13 @@ func Load(s server.Controller, middleware ...gin.HandlerFunc) http.Handler {
 		app.GET("/application/:name", s.GetApplication)
 		app.GET("/applications", s.ListApplications)
 		app.POST("/application", s.CreateApplication)
+		app.PUT("/application", s.UpdateApplication)
 		app.DELETE("/application/:name", s.DeleteApplication)
 
 		app.GET("/resource/:name", s.GetResource)
 		app.DELETE("/resource/:name", s.DeleteResource)
+		app.GET("/resource/:name/history", s.GetResourceHistory)
+		app.GET("/resource/:name/diff", s.GetResourceDiff)
 		app.GET("/resources", s.ListResource)
 		app.GET("/resources/timeframe/:name", s.ListTimeframeResource)
 		app.DELETE("/resources/timeframe/:name", s.DeleteTimeframeResource)
@@ -69,6 +72,11 @@ func Load(s server.Controller, middleware ...gin.HandlerFunc) http.Handler {
 		app.GET("/timeframe/:name", s.GetTimeframe)
 		app.PUT("/timeframe", s.UpdateTimeframe)
 		app.DELETE("/timeframe/:name", s.DeleteTimeframe)
+		app.POST("/timeframe/:name/rerun", s.RerunTimeframe)
+		app.GET("/timeframe/:name/report", s.GetTimeframeReport)
+		app.POST("/timeframe/:name/project", s.ProjectTimeframe)
+		app.POST("/timeframes/import", s.ImportTimeframes)
+		app.POST("/timeframes/validate", s.ValidateTimeframe)
 	}
 
 	e.GET("/version", versionCtrl)
@@ -17,12 +17,15 @@ limitations under the License.
 package input
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/angao/recommender/pkg/apis/v1alpha1"
 	"github.com/angao/recommender/pkg/input/prometheus"
+	"github.com/angao/recommender/pkg/logic"
 	"github.com/angao/recommender/pkg/model"
 	"github.com/angao/recommender/pkg/store"
 	"github.com/angao/recommender/pkg/utils"
@@ -43,28 +46,98 @@ type ClusterStateFeeder interface {
 	LoadTimeframeVPAs()
 
 	// LoadMetrics loads clusterState with current usage metrics of containers.
-	LoadMetrics()
+	// The queries not done when the context is done fail.
+	LoadMetrics(ctx context.Context)
 
-	LoadTimeframeMetrics()
+	LoadTimeframeMetrics(ctx context.Context)
 
 	UpdateResources()
+
+	// UpdateTimeframeResources stores the recommendations of the timeframes
+	// loaded by LoadTimeframes and marks them as computed.
+	UpdateTimeframeResources()
+
+	// SaveCheckpoints stores the usage aggregated by LoadMetrics.
+	SaveCheckpoints()
 }
 
-// NewClusterStateFeeder creates new ClusterStateFeeder with internal data providers, based on kube client config and a historyProvider.
-func NewClusterStateFeeder(store store.Store, globalConfig *utils.GlobalConfig, clusterState *model.ClusterState) ClusterStateFeeder {
+// NewClusterStateFeeder creates new ClusterStateFeeder reading the metrics of
+// every cluster of globalConfig.MetricSources() from the provider at the same
+// index in providers.
+func NewClusterStateFeeder(store store.Store, globalConfig *utils.GlobalConfig, clusterState *model.ClusterState, providers []prometheus.Provider) ClusterStateFeeder {
+	sources := make([]*metricSource, 0)
+	for i, cluster := range globalConfig.MetricSources() {
+		sources = append(sources, &metricSource{
+			name:     cluster.Name,
+			config:   cluster.PrometheusConfig,
+			provider: providers[i],
+		})
+	}
 	return &clusterStateFeeder{
 		store:        store,
 		clusterState: clusterState,
 		globalConfig: globalConfig,
-		provider:     prometheus.NewPrometheusHistoryProvider(globalConfig.PrometheusConfig.Address),
+		sources:      sources,
+	}
+}
+
+// metricSource is a cluster and the Prometheus its metrics are read from.
+// Without configured clusters, the only source is unnamed.
+type metricSource struct {
+	name     string
+	config   utils.PrometheusConfig
+	provider prometheus.Provider
+}
+
+// includes returns true if the application runs in the cluster.
+func (source *metricSource) includes(application *v1alpha1.Application) bool {
+	return len(source.name) == 0 || application.RunsIn(source.name)
+}
+
+// stateKey returns the key of the state read from the cluster in the VPA
+// merged over all clusters.
+func (source *metricSource) stateKey(key model.AggregateStateKey) model.AggregateStateKey {
+	if len(source.name) == 0 {
+		return key
+	}
+	return model.NewClusterStateKey(source.name, key)
+}
+
+// describe names the application in the cluster in logs and errors.
+func (source *metricSource) describe(name string) string {
+	if len(source.name) == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s in cluster %s", name, source.name)
+}
+
+// maxConcurrentBatches bounds the batch queries run at once, each of them
+// covers many applications.
+const maxConcurrentBatches = 2
+
+func mustParseDuration(s string) time.Duration {
+	d, err := utils.ParseDuration(s)
+	if err != nil {
+		glog.Fatalf("invalid duration %q: %v", s, err)
 	}
+	return d
 }
 
 type clusterStateFeeder struct {
 	store        store.Store
 	clusterState *model.ClusterState
 	globalConfig *utils.GlobalConfig
-	provider     prometheus.Provider
+	sources      []*metricSource
+	// checkpointLock guards checkpointTimes.
+	checkpointLock sync.Mutex
+	// checkpointTimes maps the VPA of an application in a cluster to the end
+	// of the usage window aggregated for it by the last LoadMetrics.
+	checkpointTimes map[model.ApplicationID]time.Time
+	// timeframeLock guards timeframeErrors.
+	timeframeLock sync.Mutex
+	// timeframeErrors maps the name of a timeframe to the error which failed
+	// its computation in the last LoadTimeframeMetrics.
+	timeframeErrors map[string]error
 }
 
 func (feeder *clusterStateFeeder) LoadApplications() {
@@ -99,33 +172,114 @@ func (feeder *clusterStateFeeder) LoadTimeframes() {
 	} else {
 		glog.V(3).Infof("Fetched %d timeframes.", len(timeframes))
 	}
+	now := time.Now()
+	history := mustParseDuration(feeder.globalConfig.ExtraConfig.History)
+	due := make(map[string]bool)
+	running := make([]*v1alpha1.Timeframe, 0)
 	for _, timeframe := range timeframes {
-		if timeframe.Status != v1alpha1.StatusOn {
+		status := timeframe.Status
+		if !timeframeDue(timeframe, history, now) {
+			if timeframe.Status != status {
+				// An interrupted computation which used up its attempts failed.
+				glog.Errorf("Timeframe %s: %s", timeframe.Name, timeframe.Error)
+				running = append(running, timeframe)
+			}
 			continue
 		}
+		due[timeframe.Name] = true
+		timeframe.Status = v1alpha1.StatusRunning
+		timeframe.Error = ""
+		running = append(running, timeframe)
 		feeder.clusterState.AddTimeframe(timeframe)
 	}
+	if len(running) > 0 {
+		if err := feeder.store.UpdateTimeframes(running); err != nil {
+			glog.Errorf("Cannot update timeframe statuses. Reason: %+v", err)
+		}
+	}
 
 	for name := range feeder.clusterState.Timeframes {
-		exist := false
-		for _, timeframe := range timeframes {
-			if timeframe.Status == v1alpha1.StatusOn && name == timeframe.Name {
-				exist = true
-			}
-		}
-		if !exist {
+		if !due[name] {
 			feeder.clusterState.DeleteTimeframe(name)
 		}
 	}
 }
 
+// timeframeDue returns true if the recommendation of the timeframe has to be
+// computed. A one-off timeframe is computed once it has ended, a recurring
+// one whenever another occurrence has finished. A failed computation is
+// retried after its backoff, and an interrupted one right away, both up to
+// MaxTimeframeAttempts; an interrupted one is marked failed then. If the
+// timeframe is due, its LastOccurrence and Attempts are set for the new
+// computation.
+func timeframeDue(timeframe *v1alpha1.Timeframe, history time.Duration, now time.Time) bool {
+	if timeframe.Status == v1alpha1.StatusOff || timeframe.Status == v1alpha1.StatusProjected {
+		return false
+	}
+	end := timeframe.End
+	newOccurrence := false
+	if timeframe.IsRecurring() {
+		windows, err := recurringWindows(timeframe, history, now)
+		if err != nil {
+			glog.Errorf("Invalid timeframe %s: %+v", timeframe.Name, err)
+			return false
+		}
+		if len(windows) == 0 {
+			return false
+		}
+		end = windows[len(windows)-1].End
+		newOccurrence = !end.Equal(timeframe.LastOccurrence)
+	}
+	if end.After(now) {
+		return false
+	}
+
+	retry := false
+	switch timeframe.Status {
+	case v1alpha1.StatusSucceeded:
+		if !newOccurrence {
+			return false
+		}
+	case v1alpha1.StatusFailed:
+		retry = timeframe.Attempts < v1alpha1.MaxTimeframeAttempts && !now.Before(timeframe.NextAttempt)
+		if !retry && !newOccurrence {
+			return false
+		}
+	case v1alpha1.StatusRunning:
+		// Computations don't overlap, so this one was interrupted, e.g. by
+		// a crash of the process the window keeps causing.
+		retry = timeframe.Attempts < v1alpha1.MaxTimeframeAttempts
+		if !retry && !newOccurrence {
+			timeframe.Status = v1alpha1.StatusFailed
+			timeframe.Error = fmt.Sprintf("the computation was interrupted %d times", timeframe.Attempts)
+			return false
+		}
+	}
+	if retry && !newOccurrence {
+		timeframe.Attempts++
+	} else {
+		timeframe.Attempts = 1
+	}
+	if timeframe.IsRecurring() {
+		timeframe.LastOccurrence = end
+	}
+	return true
+}
+
 func (feeder *clusterStateFeeder) LoadVPAs() {
 	applications := feeder.clusterState.Applications
 	applicationKey := make(map[model.ApplicationID]bool)
-	for name := range applications {
-		applicationID := model.ApplicationID{Name: name}
-		applicationKey[applicationID] = true
-		feeder.clusterState.AddOrUpdateVPA(applicationID)
+	for name, application := range applications {
+		applicationKey[model.ApplicationID{Name: name}] = true
+		feeder.clusterState.AddOrUpdateVPA(application, "")
+		// With configured clusters, every cluster has its own VPA besides the merged one.
+		for _, source := range feeder.sources {
+			if len(source.name) == 0 || !application.RunsIn(source.name) {
+				continue
+			}
+			applicationKey[model.ApplicationID{Name: name, Cluster: source.name}] = true
+			feeder.clusterState.AddOrUpdateVPA(application, source.name)
+		}
 	}
 
 	for vpaID := range feeder.clusterState.Vpas {
@@ -150,147 +304,456 @@ func (feeder *clusterStateFeeder) LoadTimeframeVPAs() {
 	}
 }
 
-func (feeder *clusterStateFeeder) loadHistoryMetrics(name, history string) {
-	aggregateContainerState, err := feeder.provider.GetHistoryMetrics(name, history)
-	if err != nil {
-		glog.Errorf("Cannot get %s history metrics. Reason: %+v", name, err)
+// restoreCheckpoints returns the usage aggregated in the application's
+// checkpoints, and the start of the usage to query since then, or
+// historyStart if there are no checkpoints. The peaks older than
+// historyStart are dropped.
+func restoreCheckpoints(name string, checkpoints []*v1alpha1.Checkpoint, historyStart time.Time) (map[model.AggregateStateKey]*model.AggregateContainerState, time.Time) {
+	aggregateContainerStates := make(map[model.AggregateStateKey]*model.AggregateContainerState)
+	start := historyStart
+	for _, checkpoint := range checkpoints {
+		if checkpoint.State == nil {
+			glog.Errorf("Empty checkpoint of %s/%s, dropping it.", name, checkpoint.ContainerName)
+			continue
+		}
+		state := model.NewAggregateContainerState()
+		if err := state.LoadFromCheckpoint(checkpoint.State); err != nil {
+			glog.Errorf("Cannot load checkpoint of %s/%s, dropping it. Reason: %+v", name, checkpoint.ContainerName, err)
+			continue
+		}
+		state.ExpirePeaks(historyStart)
+		aggregateContainerStates[model.NewCheckpointStateKey(name, checkpoint.ContainerName)] = state
+		if checkpoint.LastSampleTime.After(start) {
+			start = checkpoint.LastSampleTime
+		}
+	}
+	return aggregateContainerStates, start
+}
+
+// labelSchema returns the label schema of the application in the cluster,
+// the cluster's one overridden by the application's.
+func (feeder *clusterStateFeeder) labelSchema(source *metricSource, name string) *v1alpha1.LabelSchema {
+	var override *v1alpha1.LabelSchema
+	if application, ok := feeder.clusterState.Applications[name]; ok && application != nil {
+		override = application.LabelSchema
 	}
-	applicationID := model.ApplicationID{Name: name}
-	for vpaID, vpa := range feeder.clusterState.Vpas {
-		if vpaID == applicationID {
-			vpa.SetAggregationContainerState(aggregateContainerState)
-			break
+	return logic.MergeLabelSchema(source.config.LabelSchema, override)
+}
+
+// historyMetrics returns the usage of the containers of the applications in
+// the cluster between start and end, keyed by application name. In batch mode every
+// resource is queried once per batch of applications sharing a label
+// schema, otherwise once per application. The applications whose usage
+// cannot be queried are keyed in the errors instead.
+func (feeder *clusterStateFeeder) historyMetrics(ctx context.Context, source *metricSource, names []string, start, end time.Time) (map[string]map[model.AggregateStateKey]*model.AggregateContainerState, map[string]error) {
+	var lock sync.Mutex
+	res := make(map[string]map[model.AggregateStateKey]*model.AggregateContainerState)
+	errs := make(map[string]error)
+	batchSize := source.config.BatchSize
+	if batchSize <= 0 {
+		load := func(i int) {
+			states, err := source.provider.GetHistoryMetrics(ctx, names[i], feeder.labelSchema(source, names[i]), start, end)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				errs[names[i]] = err
+				return
+			}
+			res[names[i]] = states
 		}
+		work.Parallelize(8, len(names), load)
+		return res, errs
+	}
+
+	type batch struct {
+		names  []string
+		schema *v1alpha1.LabelSchema
 	}
+	// Applications are batched in order within each label schema.
+	schemas := make(map[string]*v1alpha1.LabelSchema)
+	keys := make([]string, 0)
+	grouped := make(map[string][]string)
+	for _, name := range names {
+		schema := feeder.labelSchema(source, name)
+		key := fmt.Sprintf("%q", *schema)
+		if _, ok := schemas[key]; !ok {
+			schemas[key] = schema
+			keys = append(keys, key)
+		}
+		grouped[key] = append(grouped[key], name)
+	}
+	batches := make([]batch, 0)
+	for _, key := range keys {
+		group := grouped[key]
+		for i := 0; i < len(group); i += batchSize {
+			j := i + batchSize
+			if j > len(group) {
+				j = len(group)
+			}
+			batches = append(batches, batch{names: group[i:j], schema: schemas[key]})
+		}
+	}
+	load := func(i int) {
+		applications, err := source.provider.GetBatchHistoryMetrics(ctx, batches[i].names, batches[i].schema, start, end)
+		lock.Lock()
+		defer lock.Unlock()
+		for _, name := range batches[i].names {
+			if err != nil {
+				errs[name] = err
+				continue
+			}
+			res[name] = applications[name]
+		}
+	}
+	work.Parallelize(maxConcurrentBatches, len(batches), load)
+	return res, errs
 }
 
-func (feeder *clusterStateFeeder) getTimeframeMetrics(appName, historyLen, offset string) (map[model.AggregateStateKey]*model.AggregateContainerState, error) {
-	aggregateContainerState, err := feeder.provider.GetTimeframeMetrics(appName, historyLen, offset)
-	if err != nil {
-		return nil, err
+func (feeder *clusterStateFeeder) setAggregateContainerStates(id model.ApplicationID, aggregateContainerStates map[model.AggregateStateKey]*model.AggregateContainerState) {
+	if vpa, ok := feeder.clusterState.Vpas[id]; ok {
+		vpa.SetAggregationContainerState(aggregateContainerStates)
 	}
-	return aggregateContainerState, nil
 }
 
-type queryParam struct {
-	TimeframeName string
-	AppName       string
-	HistoryLen    string
-	Offset        string
+// setTimeframeError records the error which failed the computation of the timeframe.
+func (feeder *clusterStateFeeder) setTimeframeError(name string, err error) {
+	feeder.timeframeLock.Lock()
+	defer feeder.timeframeLock.Unlock()
+	feeder.timeframeErrors[name] = err
 }
 
-func (feeder *clusterStateFeeder) LoadTimeframeMetrics() {
-	queryParams := make([]queryParam, 0)
+func (feeder *clusterStateFeeder) LoadTimeframeMetrics(ctx context.Context) {
+	feeder.timeframeErrors = make(map[string]error)
 	now := time.Now()
+	history := mustParseDuration(feeder.globalConfig.ExtraConfig.History)
 	for timeframeName, timeframe := range feeder.clusterState.Timeframes {
 		timeframeVpa := feeder.clusterState.TimeframeVpas[timeframeName]
-		for appID := range timeframeVpa {
-			history, offset, err := parse(timeframe.Start, timeframe.End, now)
+		var windows []window
+		if timeframe.IsRecurring() {
+			var err error
+			windows, err = recurringWindows(timeframe, history, timeframe.LastOccurrence)
 			if err != nil {
-				glog.Errorf("parse timeframe time: %+v", err)
+				glog.Errorf("Invalid timeframe %s: %+v", timeframeName, err)
+				feeder.setTimeframeError(timeframeName, err)
+				continue
+			}
+			// Every window is a separate usage query, only the latest ones are queried.
+			var dropped int
+			windows, dropped = latestWindows(windows, feeder.globalConfig.ExtraConfig.MaxTimeframeWindows)
+			if dropped > 0 {
+				glog.Warningf("Timeframe %s has %d occurrences within the history, the earliest %d are left out, see extraConfig.maxTimeframeWindows",
+					timeframeName, len(windows)+dropped, dropped)
 			}
-			param := queryParam{
-				TimeframeName: timeframeName,
-				AppName:       appID.Name,
-				HistoryLen:    history,
-				Offset:        offset,
+		} else {
+			if err := validate(timeframe.Start, timeframe.End, now); err != nil {
+				glog.Errorf("Invalid timeframe %s: %+v", timeframeName, err)
+				feeder.setTimeframeError(timeframeName, err)
+				continue
+			}
+			windows = []window{{Start: timeframe.Start, End: timeframe.End}}
+		}
+		// The usage of all windows and clusters is aggregated into one state
+		// per container, timeframes are only recommended over all clusters.
+		aggregateContainerStates := make(map[string]map[model.AggregateStateKey]*model.AggregateContainerState)
+		for _, source := range feeder.sources {
+			names := make([]string, 0, len(timeframeVpa))
+			for appID := range timeframeVpa {
+				if source.includes(feeder.clusterState.Applications[appID.Name]) {
+					names = append(names, appID.Name)
+				}
+			}
+			for _, w := range windows {
+				res, errs := feeder.historyMetrics(ctx, source, names, w.Start, w.End)
+				for name, err := range errs {
+					glog.Errorf("Cannot get %s timeframe history metrics. Reason: %+v", source.describe(name), err)
+					feeder.setTimeframeError(timeframeName, fmt.Errorf("cannot get %s history metrics: %v", source.describe(name), err))
+				}
+				for name, states := range res {
+					if aggregateContainerStates[name] == nil {
+						aggregateContainerStates[name] = make(map[model.AggregateStateKey]*model.AggregateContainerState)
+					}
+					for key, state := range states {
+						key = source.stateKey(key)
+						if aggregated, ok := aggregateContainerStates[name][key]; ok {
+							aggregated.MergeContainerState(state)
+						} else {
+							aggregateContainerStates[name][key] = state
+						}
+					}
+				}
+			}
+		}
+		for appID, vpa := range timeframeVpa {
+			if states, ok := aggregateContainerStates[appID.Name]; ok {
+				vpa.SetAggregationContainerState(states)
 			}
-			queryParams = append(queryParams, param)
 		}
 	}
-	load := func(i int) {
-		queryParam := queryParams[i]
-		aggregateContainerState, err := feeder.getTimeframeMetrics(queryParam.AppName, queryParam.HistoryLen, queryParam.Offset)
-		if err != nil {
-			glog.Errorf("Cannot get %s timeframe history metrics. Reason: %+v", queryParam.AppName, err)
-			return
+}
+
+func (feeder *clusterStateFeeder) LoadMetrics(ctx context.Context) {
+	feeder.checkpointTimes = make(map[model.ApplicationID]time.Time)
+	checkpoints := make(map[model.ApplicationID][]*v1alpha1.Checkpoint)
+	list, err := feeder.store.ListCheckpoints()
+	if err != nil {
+		// The whole history is queried instead of the usage since the checkpoints.
+		glog.Errorf("Cannot list checkpoints, loading the whole history. Reason: %+v", err)
+	}
+	applicationNames := make(map[int64]string)
+	for name, application := range feeder.clusterState.Applications {
+		applicationNames[application.ID] = name
+	}
+	for _, checkpoint := range list {
+		id := model.ApplicationID{Name: applicationNames[checkpoint.ApplicationID], Cluster: checkpoint.Cluster}
+		checkpoints[id] = append(checkpoints[id], checkpoint)
+	}
+
+	// The window is aligned with the step, so that the samples of consecutive
+	// windows neither overlap nor leave gaps.
+	end := time.Now().Truncate(mustParseDuration(feeder.globalConfig.PrometheusConfig.Step))
+	historyStart := end.Add(-mustParseDuration(feeder.globalConfig.ExtraConfig.History))
+	// merged maps the name of an application to the usage read from all clusters.
+	merged := make(map[string]map[model.AggregateStateKey]*model.AggregateContainerState)
+	for _, source := range feeder.sources {
+		res := feeder.loadSourceMetrics(ctx, source, checkpoints, historyStart, end)
+		if len(source.name) == 0 {
+			// The only source sets the merged VPAs itself.
+			continue
 		}
-		timeframeVPA := feeder.clusterState.TimeframeVpas[queryParam.TimeframeName]
-		for appID, vpa := range timeframeVPA {
-			if appID.Name == queryParam.AppName {
-				vpa.SetAggregationContainerState(aggregateContainerState)
-				break
+		for name, states := range res {
+			if merged[name] == nil {
+				merged[name] = make(map[model.AggregateStateKey]*model.AggregateContainerState)
+			}
+			for key, state := range states {
+				merged[name][source.stateKey(key)] = state
 			}
 		}
 	}
-	work.Parallelize(8, len(queryParams), load)
+	for name, states := range merged {
+		feeder.setAggregateContainerStates(model.ApplicationID{Name: name}, states)
+	}
 }
 
-func (feeder *clusterStateFeeder) LoadMetrics() {
-	applications := make([]string, 0)
-	for name := range feeder.clusterState.Applications {
-		applications = append(applications, name)
+// loadSourceMetrics sets the usage of the applications in the cluster,
+// restored from their checkpoints and read since then up to end, and
+// returns it keyed by application name.
+func (feeder *clusterStateFeeder) loadSourceMetrics(ctx context.Context, source *metricSource, checkpoints map[model.ApplicationID][]*v1alpha1.Checkpoint, historyStart, end time.Time) map[string]map[model.AggregateStateKey]*model.AggregateContainerState {
+	// The applications are grouped by the start of the usage to query, most
+	// of them were checkpointed at the end of the previous run.
+	restored := make(map[string]map[model.AggregateStateKey]*model.AggregateContainerState)
+	starts := make(map[int64]time.Time)
+	groups := make(map[int64][]string)
+	for name, application := range feeder.clusterState.Applications {
+		if !source.includes(application) {
+			continue
+		}
+		id := model.ApplicationID{Name: name, Cluster: source.name}
+		states, start := restoreCheckpoints(name, checkpoints[id], historyStart)
+		restored[name] = states
+		if !start.Before(end) {
+			feeder.setHistoryMetrics(id, states, end)
+			continue
+		}
+		starts[start.UnixNano()] = start
+		groups[start.UnixNano()] = append(groups[start.UnixNano()], name)
 	}
+	for group, names := range groups {
+		res, errs := feeder.historyMetrics(ctx, source, names, starts[group], end)
+		for _, name := range names {
+			id := model.ApplicationID{Name: name, Cluster: source.name}
+			if err, failed := errs[name]; failed {
+				// Recommend from the checkpoints only, and keep them as they are.
+				glog.Errorf("Cannot get %s history metrics. Reason: %+v", source.describe(name), err)
+				feeder.setAggregateContainerStates(id, restored[name])
+				continue
+			}
+			for key, state := range res[name] {
+				restored[name][key] = state
+			}
+			feeder.setHistoryMetrics(id, restored[name], end)
+		}
+	}
+	return restored
+}
 
-	load := func(i int) {
-		name := applications[i]
-		feeder.loadHistoryMetrics(name, feeder.globalConfig.ExtraConfig.History)
+// setHistoryMetrics sets the usage aggregated for the application in the
+// cluster up to end, which is checkpointed at end.
+func (feeder *clusterStateFeeder) setHistoryMetrics(id model.ApplicationID, aggregateContainerStates map[model.AggregateStateKey]*model.AggregateContainerState, end time.Time) {
+	feeder.setAggregateContainerStates(id, aggregateContainerStates)
+
+	feeder.checkpointLock.Lock()
+	defer feeder.checkpointLock.Unlock()
+	feeder.checkpointTimes[id] = end
+}
+
+func (feeder *clusterStateFeeder) SaveCheckpoints() {
+	history := mustParseDuration(feeder.globalConfig.ExtraConfig.History)
+	for id, end := range feeder.checkpointTimes {
+		name := id.Name
+		application, ok := feeder.clusterState.Applications[name]
+		if !ok {
+			continue
+		}
+		vpa, ok := feeder.clusterState.Vpas[id]
+		if !ok {
+			continue
+		}
+		checkpoints := make([]*v1alpha1.Checkpoint, 0)
+		for containerName, aggregateContainerState := range vpa.AggregateStateByContainerName() {
+			// Forget the containers which were not seen during the whole history.
+			lastSample := aggregateContainerState.LastSampleStart
+			if !lastSample.IsZero() && lastSample.Before(end.Add(-history)) {
+				continue
+			}
+			state, err := aggregateContainerState.SaveToCheckpoint()
+			if err != nil {
+				glog.Errorf("Cannot save checkpoint of %s/%s. Reason: %+v", name, containerName, err)
+				continue
+			}
+			checkpoints = append(checkpoints, &v1alpha1.Checkpoint{
+				ContainerName:  containerName,
+				LastSampleTime: end,
+				State:          state,
+			})
+		}
+		if err := feeder.store.SaveCheckpoints(application.ID, id.Cluster, checkpoints); err != nil {
+			glog.Errorf("Cannot save checkpoints of %s. Reason: %+v", name, err)
+		}
 	}
+	feeder.deleteStaleClusters()
+}
 
-	work.Parallelize(8, len(applications), load)
+// deleteStaleClusters deletes the recommendations and checkpoints of the
+// applications in the clusters they no longer run in, or which are no
+// longer configured.
+func (feeder *clusterStateFeeder) deleteStaleClusters() {
+	for name, application := range feeder.clusterState.Applications {
+		clusters := make([]string, 0)
+		for _, source := range feeder.sources {
+			if len(source.name) != 0 && source.includes(application) {
+				clusters = append(clusters, source.name)
+			}
+		}
+		if err := feeder.store.DeleteStaleClusters(application.ID, clusters); err != nil {
+			glog.Errorf("Cannot delete the stale clusters of %s. Reason: %+v", name, err)
+		}
+	}
 }
 
 func (feeder *clusterStateFeeder) UpdateResources() {
-	applications := feeder.clusterState.Applications
 	containerResources := make([]*v1alpha1.ContainerResource, 0)
-	for _, application := range applications {
-		applicationID := model.ApplicationID{Name: application.Name}
-		vpa := feeder.clusterState.Vpas[applicationID]
+	// Both the merged and the per-cluster VPAs are stored.
+	for applicationID, vpa := range feeder.clusterState.Vpas {
+		application, ok := feeder.clusterState.Applications[applicationID.Name]
+		if !ok {
+			continue
+		}
+		updatePolicy := logic.MergeUpdatePolicy(feeder.globalConfig.RecommenderConfig.UpdatePolicy, application.UpdatePolicy)
 		for _, recommendResource := range vpa.Recommendation {
 			containerResource := convert(recommendResource)
 			containerResource.ApplicationID = application.ID
+			containerResource.Cluster = applicationID.Cluster
+			containerResource.UpdatePolicy = updatePolicy
 			containerResources = append(containerResources, containerResource)
 		}
 	}
+	if err := feeder.store.AddOrUpdateContainerResource(containerResources); err != nil {
+		glog.Errorf("add or update container resource error: %+v", err)
+	}
+	retention := mustParseDuration(feeder.globalConfig.ExtraConfig.HistoryRetention)
+	if err := feeder.store.PruneRecommendationHistory(time.Now().Add(-retention)); err != nil {
+		glog.Errorf("Cannot prune recommendation history. Reason: %+v", err)
+	}
+}
+
+func (feeder *clusterStateFeeder) UpdateTimeframeResources() {
+	now := time.Now()
+	containerResources := make([]*v1alpha1.ContainerResource, 0)
 	timeframes := make([]*v1alpha1.Timeframe, 0)
+	succeeded := make([]*v1alpha1.Timeframe, 0)
 	for name, timeframe := range feeder.clusterState.Timeframes {
+		timeframes = append(timeframes, timeframe)
+		// A timeframe is only stored if all of its queries succeeded.
+		if err, failed := feeder.timeframeErrors[name]; failed {
+			setTimeframeFailed(timeframe, err, now)
+			continue
+		}
 		timeframeVPA := feeder.clusterState.TimeframeVpas[name]
 		for appID, vpa := range timeframeVPA {
 			application := feeder.clusterState.Applications[appID.Name]
 			for _, recommendResource := range vpa.Recommendation {
 				containerResource := convert(recommendResource)
 				containerResource.ApplicationID = application.ID
+				// The update policy doesn't apply, every computation replaces the timeframe's recommendation.
 				containerResource.TimeframeID = timeframe.ID
 				containerResources = append(containerResources, containerResource)
 			}
 		}
-		timeframe.Status = v1alpha1.StatusOff
-		timeframes = append(timeframes, timeframe)
+		succeeded = append(succeeded, timeframe)
 	}
 
 	err := feeder.store.AddOrUpdateContainerResource(containerResources)
 	if err != nil {
 		glog.Errorf("add or update container resource error: %+v", err)
-	} else {
-		err := feeder.store.UpdateTimeframes(timeframes)
+	}
+	for _, timeframe := range succeeded {
 		if err != nil {
-			glog.Errorf("update timeframe error: %+v", err)
+			setTimeframeFailed(timeframe, err, now)
+			continue
 		}
+		timeframe.Status = v1alpha1.StatusSucceeded
+		timeframe.Error = ""
+	}
+	if err := feeder.store.UpdateTimeframes(timeframes); err != nil {
+		glog.Errorf("update timeframe error: %+v", err)
 	}
 }
 
 func convert(recommendResource model.RecommendedContainerResources) *v1alpha1.ContainerResource {
+	target, lowerBound, upperBound := recommendResource.Target, recommendResource.LowerBound, recommendResource.UpperBound
+	peak := recommendResource.Peak
 	return &v1alpha1.ContainerResource{
-		Name:                   recommendResource.ContainerName,
-		CPULimit:               int64(recommendResource.CPULimit),
-		MemoryLimit:            int64(recommendResource.MemoryLimit),
-		DiskReadIOLimit:        int64(recommendResource.DiskReadIOLimit),
-		DiskWriteIOLimit:       int64(recommendResource.DiskWriteIOLimit),
-		NetworkReceiveIOLimit:  int64(recommendResource.NetworkReceiveIOLimit),
-		NetworkTransmitIOLimit: int64(recommendResource.NetworkTransmitIOLimit),
+		Name: recommendResource.ContainerName,
+		RecommendedResources: v1alpha1.RecommendedResources{
+			CPULimit:                    int64(target[model.ResourceCPU]),
+			MemoryLimit:                 int64(target[model.ResourceMemory]),
+			DiskReadIOLimit:             int64(target[model.ResourceDiskReadIO]),
+			DiskWriteIOLimit:            int64(target[model.ResourceDiskWriteIO]),
+			NetworkReceiveIOLimit:       int64(target[model.ResourceNetworkReceiveIO]),
+			NetworkTransmitIOLimit:      int64(target[model.ResourceNetworkTransmitIO]),
+			CPURequest:                  int64(recommendResource.Request[model.ResourceCPU]),
+			MemoryRequest:               int64(recommendResource.Request[model.ResourceMemory]),
+			CPULowerBound:               int64(lowerBound[model.ResourceCPU]),
+			CPUUpperBound:               int64(upperBound[model.ResourceCPU]),
+			MemoryLowerBound:            int64(lowerBound[model.ResourceMemory]),
+			MemoryUpperBound:            int64(upperBound[model.ResourceMemory]),
+			DiskReadIOLowerBound:        int64(lowerBound[model.ResourceDiskReadIO]),
+			DiskReadIOUpperBound:        int64(upperBound[model.ResourceDiskReadIO]),
+			DiskWriteIOLowerBound:       int64(lowerBound[model.ResourceDiskWriteIO]),
+			DiskWriteIOUpperBound:       int64(upperBound[model.ResourceDiskWriteIO]),
+			NetworkReceiveIOLowerBound:  int64(lowerBound[model.ResourceNetworkReceiveIO]),
+			NetworkReceiveIOUpperBound:  int64(upperBound[model.ResourceNetworkReceiveIO]),
+			NetworkTransmitIOLowerBound: int64(lowerBound[model.ResourceNetworkTransmitIO]),
+			NetworkTransmitIOUpperBound: int64(upperBound[model.ResourceNetworkTransmitIO]),
+			Confidence:                  recommendResource.Confidence,
+		},
+		UsagePeaks: v1alpha1.UsagePeaks{
+			CPUPeak:               int64(peak[model.ResourceCPU]),
+			MemoryPeak:            int64(peak[model.ResourceMemory]),
+			DiskReadIOPeak:        int64(peak[model.ResourceDiskReadIO]),
+			DiskWriteIOPeak:       int64(peak[model.ResourceDiskWriteIO]),
+			NetworkReceiveIOPeak:  int64(peak[model.ResourceNetworkReceiveIO]),
+			NetworkTransmitIOPeak: int64(peak[model.ResourceNetworkTransmitIO]),
+		},
 	}
 }
 
-func parse(start, end, now time.Time) (string, string, error) {
-	hisDuration := end.Sub(start).Minutes()
-	if hisDuration <= 0 {
-		return "", "", errors.New("timeframe start after end")
+func validate(start, end, now time.Time) error {
+	if !start.Before(end) {
+		return errors.New("timeframe start after end")
 	}
-	offsetDuration := now.Sub(end).Minutes()
-	if offsetDuration < 0 {
-		return "", "", errors.New("timeframe end time after now")
+	if end.After(now) {
+		return errors.New("timeframe end time after now")
 	}
-	history := fmt.Sprintf("%dm", int(hisDuration))
-	offset := fmt.Sprintf("%dm", int(offsetDuration))
-	return history, offset, nil
+	return nil
 }
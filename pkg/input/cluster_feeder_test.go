@@ -0,0 +1,170 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package input
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+	"github.com/angao/recommender/pkg/model"
+	"github.com/angao/recommender/pkg/store"
+	"github.com/angao/recommender/pkg/utils"
+)
+
+// fakeProvider returns one sample per container of the applications, or
+// fails every query if err is set.
+type fakeProvider struct {
+	containers map[string][]string
+	err        error
+}
+
+func (p *fakeProvider) GetHistoryMetrics(ctx context.Context, name string, schema *v1alpha1.LabelSchema, start, end time.Time) (map[model.AggregateStateKey]*model.AggregateContainerState, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	states := make(map[model.AggregateStateKey]*model.AggregateContainerState)
+	for _, containerName := range p.containers[name] {
+		key := model.NewAggregateStateKey(model.ApplicationContainer{
+			ContainerID: model.ContainerID{ApplicationID: model.ApplicationID{Name: name}, ContainerName: containerName},
+			Name:        name + "-1",
+		})
+		state := model.NewAggregateContainerState()
+		state.AddSample(model.ResourceMemory, 100, end)
+		states[key] = state
+	}
+	return states, nil
+}
+
+func (p *fakeProvider) GetBatchHistoryMetrics(ctx context.Context, names []string, schema *v1alpha1.LabelSchema, start, end time.Time) (map[string]map[model.AggregateStateKey]*model.AggregateContainerState, error) {
+	applications := make(map[string]map[model.AggregateStateKey]*model.AggregateContainerState)
+	for _, name := range names {
+		states, err := p.GetHistoryMetrics(ctx, name, schema, start, end)
+		if err != nil {
+			return nil, err
+		}
+		applications[name] = states
+	}
+	return applications, nil
+}
+
+func (p *fakeProvider) EarliestSample(ctx context.Context, since, until time.Time) (time.Time, error) {
+	return since, p.err
+}
+
+// fakeStore records the checkpoints saved and the clusters kept.
+type fakeStore struct {
+	store.Store
+	lock         sync.Mutex
+	applications []*v1alpha1.Application
+	saved        map[string]int
+	kept         map[int64][]string
+}
+
+func (s *fakeStore) ListApplication() ([]*v1alpha1.Application, error) {
+	return s.applications, nil
+}
+
+func (s *fakeStore) ListCheckpoints() ([]*v1alpha1.Checkpoint, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) SaveCheckpoints(applicationID int64, cluster string, checkpoints []*v1alpha1.Checkpoint) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, application := range s.applications {
+		if application.ID == applicationID {
+			s.saved[application.Name+"/"+cluster] = len(checkpoints)
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) DeleteStaleClusters(applicationID int64, clusters []string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.kept[applicationID] = clusters
+	return nil
+}
+
+func TestLoadMetricsClusters(t *testing.T) {
+	fake := &fakeStore{
+		applications: []*v1alpha1.Application{
+			{ID: 1, Name: "web"},
+			{ID: 2, Name: "batch", Clusters: []string{"east"}},
+		},
+		saved: make(map[string]int),
+		kept:  make(map[int64][]string),
+	}
+	globalConfig := &utils.GlobalConfig{
+		PrometheusConfig: utils.PrometheusConfig{Step: "5m"},
+		Clusters:         []utils.ClusterConfig{{Name: "east"}, {Name: "west"}},
+		ExtraConfig:      utils.ExtraConfig{History: "30d", HistoryRetention: "90d", MaxTimeframeWindows: 100},
+	}
+	feeder := &clusterStateFeeder{
+		store:        fake,
+		clusterState: model.NewClusterState(),
+		globalConfig: globalConfig,
+		sources: []*metricSource{
+			{name: "east", provider: &fakeProvider{containers: map[string][]string{"web": {"app"}, "batch": {"job"}}}},
+			{name: "west", provider: &fakeProvider{err: errors.New("prometheus is down")}},
+		},
+	}
+	feeder.LoadApplications()
+	feeder.LoadVPAs()
+	feeder.LoadMetrics(context.Background())
+
+	vpas := feeder.clusterState.Vpas
+	if _, ok := vpas[model.ApplicationID{Name: "batch", Cluster: "west"}]; ok {
+		t.Errorf("batch doesn't run in west and should have no VPA there")
+	}
+	if states := vpas[model.ApplicationID{Name: "web", Cluster: "east"}].AggregateStateByContainerName(); states["app"] == nil {
+		t.Errorf("web in east should have the usage of app, got %v", states)
+	}
+	if states := vpas[model.ApplicationID{Name: "web", Cluster: "west"}].AggregateStateByContainerName(); len(states) != 0 {
+		t.Errorf("web in the failing west should have no usage, got %v", states)
+	}
+	// The merged VPAs hold the usage of the clusters which could be read.
+	if states := vpas[model.ApplicationID{Name: "web"}].AggregateStateByContainerName(); states["app"] == nil || states["app"].GetPeak(model.ResourceMemory) != 100 {
+		t.Errorf("merged web should have the usage of app in east, got %v", states)
+	}
+	if states := vpas[model.ApplicationID{Name: "batch"}].AggregateStateByContainerName(); states["job"] == nil {
+		t.Errorf("merged batch should have the usage of job, got %v", states)
+	}
+
+	// The failing cluster keeps its checkpoints as they are.
+	feeder.SaveCheckpoints()
+	saved := make([]string, 0, len(fake.saved))
+	for key := range fake.saved {
+		saved = append(saved, key)
+	}
+	sort.Strings(saved)
+	if got := strings.Join(saved, ","); got != "batch/east,web/east" {
+		t.Errorf("saved checkpoints of %s, want batch/east,web/east", got)
+	}
+	if got := strings.Join(fake.kept[1], ","); got != "east,west" {
+		t.Errorf("web should keep east and west, got %s", got)
+	}
+	if got := strings.Join(fake.kept[2], ","); got != "east" {
+		t.Errorf("batch should keep east only, got %s", got)
+	}
+}
@@ -17,83 +17,220 @@ limitations under the License.
 package prometheus
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/angao/recommender/pkg/utils/ratelimit"
 )
 
 var (
 	numRetries = 5
-	retryDelay = 3 * time.Second
+	// retryDelay is the backoff after the first failed attempt, doubled
+	// after every other one up to maxRetryDelay.
+	retryDelay    = time.Second
+	maxRetryDelay = 30 * time.Second
+	// maxRetryAfter bounds the wait a Retry-After header asks for.
+	maxRetryAfter = 2 * time.Minute
 )
 
 // PrometheusClient talks to Prometheus using its HTTP API.
 type PrometheusClient interface {
 	// Given a particular query (that's supposed to return range vectors
 	// in Prometheus terminology), gets the results from Prometheus.
-	GetTimeseries(query string) ([]Timeseries, error)
+	GetTimeseries(ctx context.Context, query string) ([]Timeseries, error)
+
+	// GetTimeseriesAt evaluates the instant query at the given time.
+	GetTimeseriesAt(ctx context.Context, query string, t time.Time) ([]Timeseries, error)
+
+	// GetRangeTimeseries evaluates the query over the [start, end] range
+	// with the given resolution step and returns every sample of every
+	// resulting timeseries.
+	GetRangeTimeseries(ctx context.Context, query string, start, end time.Time, step time.Duration) ([]Timeseries, error)
 }
 
-type httpGetter interface {
-	Get(url string) (*http.Response, error)
+type httpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
 }
 
 // An implementation of PrometheusClient.
 type prometheusClient struct {
-	httpClient httpGetter
+	httpClient httpDoer
 	address    string
+	// limiter bounds the queries per second of all the client's callers, nil means no limit.
+	limiter *ratelimit.Limiter
 }
 
 // NewPrometheusClient constructs a prometheusClient.
-func NewPrometheusClient(httpClient httpGetter, address string) PrometheusClient {
-	return &prometheusClient{httpClient: httpClient, address: address}
+func NewPrometheusClient(httpClient httpDoer, address string, limiter *ratelimit.Limiter) PrometheusClient {
+	return &prometheusClient{httpClient: httpClient, address: address, limiter: limiter}
 }
 
-// Changes Prometheus address and query into a full escaped URL to call.
-func getUrlWithQuery(address, query string) (string, error) {
+// getApiUrl changes Prometheus address and API path into the URL to call.
+func getApiUrl(address, path string) (string, error) {
 	url, err := url.Parse(address)
 	if err != nil {
 		return "", err
 	}
-	url.Path = "api/v1/query"
-	queryValues := url.Query()
-	queryValues.Set("query", query)
-	url.RawQuery = queryValues.Encode()
+	url.Path = path
 	return url.String(), nil
 }
 
-func retry(callback func() error, attempts int, delay time.Duration) error {
-	for i := 1; ; i++ {
-		err := callback()
-		if err == nil {
-			return nil
-		}
-		if i >= attempts {
-			return fmt.Errorf("tried %d times, last error: %v", attempts, err)
-		}
-		time.Sleep(delay)
+// rangeQueryValues returns the parameters of a range query.
+func rangeQueryValues(query string, start, end time.Time, step time.Duration) url.Values {
+	return url.Values{
+		"query": {query},
+		"start": {formatTime(start)},
+		"end":   {formatTime(end)},
+		"step":  {strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+	}
+}
+
+// formatTime formats a time as a Unix timestamp in seconds, the way Prometheus API expects it.
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', -1, 64)
+}
+
+// backoff returns the delay after the given failed attempt, exponential with
+// jitter, so that the callers failed at once don't retry at once.
+func backoff(attempt int) time.Duration {
+	delay := retryDelay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// parseRetryAfter parses the Retry-After header, in seconds or as an HTTP
+// date, and returns 0 if it is missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		delay = t.Sub(now)
+	}
+	if delay < 0 {
+		return 0
+	}
+	if delay > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return delay
+}
+
+// attemptError is the error of an attempt to query Prometheus.
+type attemptError struct {
+	err error
+	// retryAfter is the wait the server asked for before the next attempt.
+	retryAfter time.Duration
+	// permanent is set if another attempt would fail the same way.
+	permanent bool
+}
+
+func (e *attemptError) Error() string {
+	return e.err.Error()
+}
+
+func (c *prometheusClient) GetTimeseries(ctx context.Context, query string) ([]Timeseries, error) {
+	return c.getTimeseries(ctx, "api/v1/query", url.Values{"query": {query}})
+}
+
+func (c *prometheusClient) GetTimeseriesAt(ctx context.Context, query string, t time.Time) ([]Timeseries, error) {
+	return c.getTimeseries(ctx, "api/v1/query", url.Values{"query": {query}, "time": {formatTime(t)}})
+}
+
+func (c *prometheusClient) GetRangeTimeseries(ctx context.Context, query string, start, end time.Time, step time.Duration) ([]Timeseries, error) {
+	if end.Before(start) {
+		return nil, fmt.Errorf("invalid range: start %v is after end %v", start, end)
+	}
+	if step <= 0 {
+		return nil, fmt.Errorf("invalid step: %v", step)
 	}
+	return c.getTimeseries(ctx, "api/v1/query_range", rangeQueryValues(query, start, end, step))
 }
 
-func (c *prometheusClient) GetTimeseries(query string) ([]Timeseries, error) {
-	url, err := getUrlWithQuery(c.address, query)
+// getTimeseries queries Prometheus until an attempt succeeds, fails
+// permanently, numRetries attempts fail or the context is done.
+func (c *prometheusClient) getTimeseries(ctx context.Context, path string, values url.Values) ([]Timeseries, error) {
+	url, err := getApiUrl(c.address, path)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't construct url to Prometheus: %v", err)
 	}
-	var resp *http.Response
-	err = retry(func() error {
-		resp, err = c.httpClient.Get(url)
-		if err != nil {
-			return fmt.Errorf("error getting data from Prometheus: %v", err)
+	var attemptErr *attemptError
+	for attempt := 1; ; attempt++ {
+		if waitErr := c.limiter.Wait(ctx); waitErr != nil {
+			return nil, fmt.Errorf("Retrying GetTimeseries cancelled: %v", waitErr)
+		}
+		var tss []Timeseries
+		tss, attemptErr = c.post(ctx, url, values)
+		if attemptErr == nil {
+			return tss, nil
+		}
+		if attemptErr.permanent || ctx.Err() != nil || attempt >= numRetries {
+			break
 		}
-		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("bad HTTP status: %v %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+		delay := backoff(attempt)
+		if attemptErr.retryAfter > delay {
+			delay = attemptErr.retryAfter
 		}
-		return nil
-	}, numRetries, retryDelay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("Retrying GetTimeseries cancelled, last error: %v", attemptErr)
+		}
+	}
+	return nil, fmt.Errorf("Retrying GetTimeseries unsuccessful: last error: %v", attemptErr)
+}
+
+// post makes a single attempt to query Prometheus. The parameters are sent
+// form-encoded in the body, so that long queries, e.g. the alternation of
+// the containers of a batch, don't exceed the URL length limits.
+func (c *prometheusClient) post(ctx context.Context, url string, values url.Values) ([]Timeseries, *attemptError) {
+	req, err := http.NewRequest("POST", url, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, &attemptError{err: err, permanent: true}
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, &attemptError{err: fmt.Errorf("error getting data from Prometheus: %v", err)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// Drains the body so that the connection can be reused.
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+		attemptErr := &attemptError{err: fmt.Errorf("bad HTTP status: %v %s", resp.StatusCode, http.StatusText(resp.StatusCode))}
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+			attemptErr.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		case resp.StatusCode >= 400 && resp.StatusCode < 500:
+			// The query itself is refused, e.g. it is invalid or unauthorized.
+			attemptErr.permanent = true
+		}
+		return nil, attemptErr
+	}
+	tss, err := decodeTimeseriesFromResponse(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("Retrying GetTimeseries unsuccessful: %v", err)
+		return nil, &attemptError{err: err, permanent: true}
 	}
-	return decodeTimeseriesFromResponse(resp.Body)
+	return tss, nil
 }
@@ -0,0 +1,158 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// trackedBody records whether the client closed it.
+type trackedBody struct {
+	*strings.Reader
+	closed bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+// statusDoer answers the requests with the statuses in order, and with a
+// vector once they run out.
+type statusDoer struct {
+	statuses   []int
+	retryAfter string
+	bodies     []*trackedBody
+}
+
+func (f *statusDoer) Do(req *http.Request) (*http.Response, error) {
+	status, body := http.StatusOK, vectorResponse
+	if i := len(f.bodies); i < len(f.statuses) {
+		status, body = f.statuses[i], "error"
+	}
+	tracked := &trackedBody{Reader: strings.NewReader(body)}
+	f.bodies = append(f.bodies, tracked)
+	header := make(http.Header)
+	if len(f.retryAfter) != 0 {
+		header.Set("Retry-After", f.retryAfter)
+	}
+	return &http.Response{StatusCode: status, Header: header, Body: tracked}, nil
+}
+
+func withRetryDelay(delay time.Duration) func() {
+	saved := retryDelay
+	retryDelay = delay
+	return func() { retryDelay = saved }
+}
+
+func TestGetTimeseriesRetries(t *testing.T) {
+	defer withRetryDelay(0)()
+	doer := &statusDoer{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusBadGateway}}
+	tss, err := NewPrometheusClient(doer, "http://prometheus:9090", nil).GetTimeseries(context.Background(), "up")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tss) != 1 || len(doer.bodies) != 4 {
+		t.Errorf("expected 1 timeseries after 4 requests, got %d after %d", len(tss), len(doer.bodies))
+	}
+	for i, body := range doer.bodies {
+		if !body.closed {
+			t.Errorf("body of request %d is not closed", i)
+		}
+		if rest, _ := ioutil.ReadAll(body); i < 3 && len(rest) != 0 {
+			t.Errorf("body of failed request %d is not drained", i)
+		}
+	}
+}
+
+func TestGetTimeseriesGivesUp(t *testing.T) {
+	defer withRetryDelay(0)()
+	doer := &statusDoer{statuses: []int{500, 500, 500, 500, 500, 500}}
+	if _, err := NewPrometheusClient(doer, "http://prometheus:9090", nil).GetTimeseries(context.Background(), "up"); err == nil {
+		t.Errorf("expected error")
+	}
+	if len(doer.bodies) != numRetries {
+		t.Errorf("expected %d requests, got %d", numRetries, len(doer.bodies))
+	}
+}
+
+func TestGetTimeseriesNotRetried(t *testing.T) {
+	defer withRetryDelay(0)()
+	doer := &statusDoer{statuses: []int{http.StatusBadRequest}}
+	if _, err := NewPrometheusClient(doer, "http://prometheus:9090", nil).GetTimeseries(context.Background(), "up{"); err == nil {
+		t.Errorf("expected error")
+	}
+	if len(doer.bodies) != 1 {
+		t.Errorf("expected a bad request not to be retried, got %d requests", len(doer.bodies))
+	}
+}
+
+func TestGetTimeseriesCancelled(t *testing.T) {
+	defer withRetryDelay(0)()
+	// The server asks for a wait far longer than the context lasts.
+	doer := &statusDoer{statuses: []int{http.StatusServiceUnavailable}, retryAfter: "60"}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	if _, err := NewPrometheusClient(doer, "http://prometheus:9090", nil).GetTimeseries(ctx, "up"); err == nil {
+		t.Errorf("expected error")
+	}
+	if elapsed := time.Since(begin); elapsed > 10*time.Second {
+		t.Errorf("expected the retry to stop with the context, took %v", elapsed)
+	}
+	if len(doer.bodies) != 1 {
+		t.Errorf("expected 1 request, got %d", len(doer.bodies))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	defer withRetryDelay(time.Second)()
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		delay := backoff(attempt + 1)
+		if delay < max/2 || delay > max {
+			t.Errorf("attempt %d: delay %v not within [%v, %v]", attempt+1, delay, max/2, max)
+		}
+	}
+	if delay := backoff(20); delay < maxRetryDelay/2 || delay > maxRetryDelay {
+		t.Errorf("expected the delay to be capped at %v, got %v", maxRetryDelay, delay)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2018, 10, 20, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"-5", 0},
+		{"soon", 0},
+		{"3600", maxRetryAfter},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	} {
+		if got := parseRetryAfter(tc.value, now); got != tc.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tc.value, got, tc.want)
+		}
+	}
+}
@@ -30,14 +30,11 @@ func mockHistoryMetrics() map[model.AggregateStateKey]*model.AggregateContainerS
 	aggregateStateKeys := mockAggregateStateKey()
 
 	for _, aggregateStateKey := range aggregateStateKeys {
-		aggregateContainerStateMap[aggregateStateKey] = &model.AggregateContainerState{
-			AggregateCPU:               model.ResourceAmount(rand.Intn(1000)),
-			AggregateMemory:            model.ResourceAmount(rand.Intn(1000)),
-			AggregateDiskReadIO:        model.ResourceAmount(rand.Intn(1000)),
-			AggregateDiskWriteIO:       model.ResourceAmount(rand.Intn(1000)),
-			AggregateNetworkReceiveIO:  model.ResourceAmount(rand.Intn(1000)),
-			AggregateNetworkTransmitIO: model.ResourceAmount(rand.Intn(1000)),
+		aggregateContainerState := model.NewAggregateContainerState()
+		for _, resource := range model.ResourceNames {
+			aggregateContainerState.AddSample(resource, model.ResourceAmount(rand.Intn(1000)), time.Now())
 		}
+		aggregateContainerStateMap[aggregateStateKey] = aggregateContainerState
 	}
 
 	return aggregateContainerStateMap
@@ -17,61 +17,160 @@ limitations under the License.
 package prometheus
 
 import (
+	"context"
 	"fmt"
-	"net/http"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
 	"github.com/angao/recommender/pkg/model"
+	"github.com/angao/recommender/pkg/utils"
+	"github.com/angao/recommender/pkg/utils/ratelimit"
+	"github.com/angao/recommender/pkg/utils/work"
+
+	"github.com/golang/glog"
 )
 
 // Provider gives metrics data of all pods in a cluster.
 // Consider refactoring to passing ClusterState and create history provider working with checkpoints.
 type Provider interface {
-	// GetClusterHistory(string)
-	GetHistoryMetrics(name, history string) (map[model.AggregateStateKey]*model.AggregateContainerState, error)
-
-	GetTimeframeMetrics(name, historyLen, offset string) (map[model.AggregateStateKey]*model.AggregateContainerState, error)
+	// GetHistoryMetrics returns usage samples of the application's containers
+	// between start and end, selected and mapped by the label schema.
+	GetHistoryMetrics(ctx context.Context, name string, schema *v1alpha1.LabelSchema, start, end time.Time) (map[model.AggregateStateKey]*model.AggregateContainerState, error)
+	// GetBatchHistoryMetrics returns usage samples of the containers of the
+	// applications between start and end, keyed by application name. The
+	// applications share the label schema.
+	GetBatchHistoryMetrics(ctx context.Context, names []string, schema *v1alpha1.LabelSchema, start, end time.Time) (map[string]map[model.AggregateStateKey]*model.AggregateContainerState, error)
+	// EarliestSample returns the time of the earliest container sample
+	// between since and until, to the minute, zero if there is none.
+	EarliestSample(ctx context.Context, since, until time.Time) (time.Time, error)
 }
 
 type prometheusProvider struct {
 	prometheusClient PrometheusClient
+	// Resolution of range queries.
+	step time.Duration
+	// Longest range of a single range query, and number of the chunks of a
+	// longer range queried at once.
+	chunkSize        time.Duration
+	chunkConcurrency int
+	// Default label schema, whose selector the samples are probed with.
+	labelSchema v1alpha1.LabelSchema
+	// Templates of the usage queries, and the offset modifier they are rendered with.
+	queries QueryTemplates
+	offset  string
 }
 
 // NewPrometheusHistoryProvider contructs a history provider that gets data from Prometheus.
-func NewPrometheusHistoryProvider(prometheusAddress string) Provider {
+// The config is expected to be validated.
+func NewPrometheusHistoryProvider(config utils.PrometheusConfig) Provider {
+	step, _ := utils.ParseDuration(config.Step)
+	chunkSize, _ := utils.ParseDuration(config.ChunkSize)
+	queries, _ := ParseQueryTemplates(config.Queries)
+	var offset string
+	if len(config.Offset) != 0 {
+		offset = " offset " + config.Offset
+	}
+	httpClient, err := NewHTTPClient(config)
+	if err != nil {
+		glog.Fatalf("cannot create Prometheus client: %v", err)
+	}
 	return &prometheusProvider{
-		prometheusClient: NewPrometheusClient(&http.Client{}, prometheusAddress),
+		prometheusClient: NewPrometheusClient(httpClient, config.Address, ratelimit.NewLimiter(config.QPS)),
+		step:             step,
+		chunkSize:        chunkSize,
+		chunkConcurrency: config.ChunkConcurrency,
+		labelSchema:      config.LabelSchema,
+		queries:          queries,
+		offset:           offset,
 	}
 }
 
-func getApplicationContainerFromLabels(labels map[string]string) (*model.ApplicationContainer, error) {
-	applicationName, ok := labels["system_mwType_serviceID"]
-	if !ok {
-		return nil, fmt.Errorf("no pod_name label")
+// timeRange is the range of the evaluation times of a range query.
+type timeRange struct {
+	start time.Time
+	end   time.Time
+}
+
+// chunks splits the evaluation times of a range query, every step from start
+// to end, into ranges of at most chunkSize. Every range starts one step after
+// the previous one ends, so the chunks evaluate the same times as the whole range.
+func chunks(start, end time.Time, step, chunkSize time.Duration) []timeRange {
+	steps := int64(chunkSize / step)
+	if steps < 1 {
+		steps = 1
 	}
-	containerName, ok := labels["container_name"]
+	ranges := make([]timeRange, 0)
+	for t := start; !t.After(end); t = t.Add(time.Duration(steps) * step) {
+		chunkEnd := t.Add(time.Duration(steps-1) * step)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+		ranges = append(ranges, timeRange{start: t, end: chunkEnd})
+	}
+	return ranges
+}
+
+func getApplicationContainerFromLabels(labels map[string]string, schema *v1alpha1.LabelSchema) (*model.ApplicationContainer, error) {
+	applicationName, ok := labels[schema.Application]
 	if !ok {
-		return nil, fmt.Errorf("no name label on container data")
+		return nil, fmt.Errorf("no %s label", schema.Application)
 	}
-	name, ok := labels["name"]
+	containerName, ok := labels[schema.Container]
 	if !ok {
-		return nil, fmt.Errorf("no name label on name data")
+		return nil, fmt.Errorf("no %s label on container data", schema.Container)
+	}
+	instance := make([]string, 0, len(schema.Instance))
+	for _, label := range schema.Instance {
+		value, ok := labels[label]
+		if !ok {
+			return nil, fmt.Errorf("no %s label on instance data", label)
+		}
+		instance = append(instance, value)
 	}
 	return &model.ApplicationContainer{
 		ContainerID: model.ContainerID{
 			ApplicationID: model.ApplicationID{Name: applicationName},
 			ContainerName: containerName,
 		},
-		Name: name,
+		Name: strings.Join(instance, "/"),
 	}, nil
 }
 
-func (p *prometheusProvider) readResource(res map[model.AggregateStateKey]*model.AggregateContainerState, query string, resource model.ResourceName) error {
-	tss, err := p.prometheusClient.GetTimeseries(query)
-	if err != nil {
-		return fmt.Errorf("cannot get timeseries for %v: %v", resource, err)
+func resourceAmount(resource model.ResourceName, value float64) model.ResourceAmount {
+	switch resource {
+	case model.ResourceCPU:
+		return model.CPUAmountFromCores(value)
+	case model.ResourceMemory:
+		return model.MemoryAmountFromBytes(value)
+	}
+	return model.ResourceAmountFromFloat(value)
+}
+
+// readResource queries the chunks of the range concurrently, each one is a
+// separate request retried on its own by the client. The samples are added
+// in the order of the chunks once all of them succeeded. The chunks not
+// started yet are skipped once the context is done.
+func (p *prometheusProvider) readResource(ctx context.Context, res map[model.AggregateStateKey]*model.AggregateContainerState, query string, schema *v1alpha1.LabelSchema, resource model.ResourceName, start, end time.Time, step time.Duration) error {
+	ranges := chunks(start, end, step, p.chunkSize)
+	results := make([][]Timeseries, len(ranges))
+	errs := make([]error, len(ranges))
+	work.Parallelize(p.chunkConcurrency, len(ranges), func(i int) {
+		if errs[i] = ctx.Err(); errs[i] != nil {
+			return
+		}
+		results[i], errs[i] = p.prometheusClient.GetRangeTimeseries(ctx, query, ranges[i].start, ranges[i].end, step)
+	})
+	tss := make([]Timeseries, 0)
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("cannot get timeseries for %v from %v to %v: %v", resource, ranges[i].start, ranges[i].end, err)
+		}
+		tss = append(tss, results[i]...)
 	}
 	for _, ts := range tss {
-		applicationContainer, err := getApplicationContainerFromLabels(ts.Labels)
+		applicationContainer, err := getApplicationContainerFromLabels(ts.Labels, schema)
 		if err != nil {
 			return fmt.Errorf("cannot get application container from labels: %v", err)
 		}
@@ -80,82 +179,152 @@ func (p *prometheusProvider) readResource(res map[model.AggregateStateKey]*model
 		if !ok {
 			aggregateContainerState = model.NewAggregateContainerState()
 		}
-		value := ts.Sample.Value
-		switch resource {
-		case model.ResourceCPU:
-			aggregateContainerState.AggregateCPU = model.CPUAmountFromCores(value)
-		case model.ResourceMemory:
-			aggregateContainerState.AggregateMemory = model.MemoryAmountFromBytes(value)
-		case model.ResourceDiskReadIO:
-			aggregateContainerState.AggregateDiskReadIO = model.ResourceAmountFromFloat(value)
-		case model.ResourceDiskWriteIO:
-			aggregateContainerState.AggregateDiskWriteIO = model.ResourceAmountFromFloat(value)
-		case model.ResourceNetworkReceiveIO:
-			aggregateContainerState.AggregateNetworkReceiveIO = model.ResourceAmountFromFloat(value)
-		case model.ResourceNetworkTransmitIO:
-			aggregateContainerState.AggregateNetworkTransmitIO = model.ResourceAmountFromFloat(value)
+		for _, sample := range ts.Samples {
+			aggregateContainerState.AddSample(resource, resourceAmount(resource, sample.Value), sample.Timestamp)
 		}
 		res[aggregateContainerKey] = aggregateContainerState
 	}
 	return nil
 }
 
-func (p *prometheusProvider) GetHistoryMetrics(name, historyLength string) (map[model.AggregateStateKey]*model.AggregateContainerState, error) {
-	res := make(map[model.AggregateStateKey]*model.AggregateContainerState)
-	podSelector := fmt.Sprintf(`pod_name=~"^.*$",container_name!="POD",image!="",name=~"^k8s_.*",system_mwType_serviceID="%s"`, name)
-	err := p.readResource(res, fmt.Sprintf("max_over_time(container_cpu_usage_seconds_total:rate:1m{%s}[%s])", podSelector, historyLength), model.ResourceCPU)
-	if err != nil {
-		return nil, fmt.Errorf("cannot get cpu usage history: %v", err)
+// GetHistoryMetrics evaluates the query of every resource once per step,
+// so that each sample holds the peak usage of the preceding step and the
+// samples together cover the whole [start, end] window.
+func (p *prometheusProvider) GetHistoryMetrics(ctx context.Context, name string, schema *v1alpha1.LabelSchema, start, end time.Time) (map[model.AggregateStateKey]*model.AggregateContainerState, error) {
+	return p.getHistoryMetrics(ctx, fmt.Sprintf(`%s="%s"`, schema.Application, escapeString(name)), schema, false, start, end)
+}
+
+// GetBatchHistoryMetrics queries every resource once for all the applications,
+// grouped by container, and splits the usage by application.
+func (p *prometheusProvider) GetBatchHistoryMetrics(ctx context.Context, names []string, schema *v1alpha1.LabelSchema, start, end time.Time) (map[string]map[model.AggregateStateKey]*model.AggregateContainerState, error) {
+	patterns := make([]string, 0, len(names))
+	for _, name := range names {
+		patterns = append(patterns, regexp.QuoteMeta(name))
 	}
-	err = p.readResource(res, fmt.Sprintf("max_over_time(container_memory_usage_bytes{%s}[%s])", podSelector, historyLength), model.ResourceMemory)
+	pattern := escapeString(strings.Join(patterns, "|"))
+	res, err := p.getHistoryMetrics(ctx, fmt.Sprintf(`%s=~"^(%s)$"`, schema.Application, pattern), schema, true, start, end)
 	if err != nil {
-		return nil, fmt.Errorf("cannot get memory usage history: %v", err)
+		return nil, err
 	}
-	err = p.readResource(res, fmt.Sprintf("max_over_time(container_fs_reads_total:rate:1m{%s}[%s])", podSelector, historyLength), model.ResourceDiskReadIO)
-	if err != nil {
-		return nil, fmt.Errorf("cannot get disk read io history: %v", err)
+	applications := make(map[string]map[model.AggregateStateKey]*model.AggregateContainerState)
+	for _, name := range names {
+		applications[name] = make(map[model.AggregateStateKey]*model.AggregateContainerState)
 	}
-	err = p.readResource(res, fmt.Sprintf("max_over_time(container_fs_writes_total:rate:1m{%s}[%s])", podSelector, historyLength), model.ResourceDiskWriteIO)
-	if err != nil {
-		return nil, fmt.Errorf("cannot get disk write io history: %v", err)
+	for key, state := range res {
+		if states, ok := applications[key.ApplicationName()]; ok {
+			states[key] = state
+		}
 	}
-	err = p.readResource(res, fmt.Sprintf("max_over_time(container_network_receive_bytes_total:rate:1m{%s}[%s])", podSelector, historyLength), model.ResourceNetworkReceiveIO)
-	if err != nil {
-		return nil, fmt.Errorf("cannot get network receive io history: %v", err)
+	return applications, nil
+}
+
+// getHistoryMetrics queries the usage of the containers matching the base
+// selector of the schema and the application selector. If grouped is set,
+// the series of a container are aggregated by their peak within each step.
+func (p *prometheusProvider) getHistoryMetrics(ctx context.Context, selector string, schema *v1alpha1.LabelSchema, grouped bool, start, end time.Time) (map[model.AggregateStateKey]*model.AggregateContainerState, error) {
+	if !start.Before(end) {
+		return nil, fmt.Errorf("invalid history window: start %v is not before end %v", start, end)
 	}
-	err = p.readResource(res, fmt.Sprintf("max_over_time(container_network_transmit_bytes_total:rate:1m{%s}[%s])", podSelector, historyLength), model.ResourceNetworkTransmitIO)
-	if err != nil {
-		return nil, fmt.Errorf("cannot get network transmit io history: %v", err)
+	step := p.step
+	if window := end.Sub(start); window < step {
+		step = window
+	}
+	if step < time.Second {
+		step = time.Second
+	}
+	// The first evaluation covers [start, start+step].
+	queryStart := start.Add(step)
+	if queryStart.After(end) {
+		queryStart = end
+	}
+
+	res := make(map[model.AggregateStateKey]*model.AggregateContainerState)
+	params := QueryParams{
+		Selector: "{" + joinSelectors(schema.Selector, selector) + "}",
+		Range:    utils.FormatDuration(step),
+		Offset:   p.offset,
+	}
+	containerLabels := strings.Join(append([]string{schema.Application, schema.Container}, schema.Instance...), ", ")
+	for _, resource := range model.ResourceNames {
+		query, err := p.queries.Query(resource, params)
+		if err != nil {
+			return nil, err
+		}
+		if grouped {
+			query = fmt.Sprintf("max by (%s) (%s)", containerLabels, query)
+		}
+		if err := p.readResource(ctx, res, query, schema, resource, queryStart, end, step); err != nil {
+			return nil, fmt.Errorf("cannot get %s usage history: %v", resource, err)
+		}
 	}
 	return res, nil
 }
 
-func (p *prometheusProvider) GetTimeframeMetrics(name, historyLen, offset string) (map[model.AggregateStateKey]*model.AggregateContainerState, error) {
-	res := make(map[model.AggregateStateKey]*model.AggregateContainerState)
-	podSelector := fmt.Sprintf(`pod_name=~"^.*$",container_name!="POD",image!="",name=~"^k8s_.*",system_mwType_serviceID="%s"`, name)
-	err := p.readResource(res, fmt.Sprintf("max_over_time(container_cpu_usage_seconds_total:rate:1m{%s}[%s] offset %s)", podSelector, historyLen, offset), model.ResourceCPU)
-	if err != nil {
-		return nil, fmt.Errorf("cannot get cpu usage history: %v", err)
+// stringEscaper escapes the backslashes and the quotes within PromQL strings.
+var stringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// escapeString escapes s to be interpolated into a double-quoted PromQL string.
+func escapeString(s string) string {
+	return stringEscaper.Replace(s)
+}
+
+// joinSelectors joins the non-empty label matchers.
+func joinSelectors(selectors ...string) string {
+	matchers := make([]string, 0, len(selectors))
+	for _, selector := range selectors {
+		if selector = strings.Trim(selector, " ,"); len(selector) != 0 {
+			matchers = append(matchers, selector)
+		}
 	}
-	err = p.readResource(res, fmt.Sprintf("max_over_time(container_memory_usage_bytes{%s}[%s] offset %s)", podSelector, historyLen, offset), model.ResourceMemory)
-	if err != nil {
-		return nil, fmt.Errorf("cannot get memory usage history: %v", err)
+	return strings.Join(matchers, ",")
+}
+
+// EarliestSample probes the samples at since and until, and bisects the
+// range in between if only until has samples. Samples are expected to be
+// continuous from the earliest one retained on.
+func (p *prometheusProvider) EarliestSample(ctx context.Context, since, until time.Time) (time.Time, error) {
+	if until.Before(since) {
+		return time.Time{}, fmt.Errorf("invalid range: since %v is after until %v", since, until)
 	}
-	err = p.readResource(res, fmt.Sprintf("max_over_time(container_fs_reads_total:rate:1m{%s}[%s] offset %s)", podSelector, historyLen, offset), model.ResourceDiskReadIO)
+	ok, err := p.hasSamples(ctx, since)
 	if err != nil {
-		return nil, fmt.Errorf("cannot get disk read io history: %v", err)
+		return time.Time{}, err
 	}
-	err = p.readResource(res, fmt.Sprintf("max_over_time(container_fs_writes_total:rate:1m{%s}[%s] offset %s)", podSelector, historyLen, offset), model.ResourceDiskWriteIO)
-	if err != nil {
-		return nil, fmt.Errorf("cannot get disk write io history: %v", err)
+	if ok {
+		return since, nil
+	}
+	ok, err = p.hasSamples(ctx, until)
+	if err != nil || !ok {
+		return time.Time{}, err
 	}
-	err = p.readResource(res, fmt.Sprintf("max_over_time(container_network_receive_bytes_total:rate:1m{%s}[%s] offset %s)", podSelector, historyLen, offset), model.ResourceNetworkReceiveIO)
+	for until.Sub(since) > time.Minute {
+		middle := since.Add(until.Sub(since) / 2)
+		ok, err := p.hasSamples(ctx, middle)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if ok {
+			until = middle
+		} else {
+			since = middle
+		}
+	}
+	return until, nil
+}
+
+// hasSamples returns true if Prometheus has memory usage samples of the
+// containers within the step ending at t, read with the memory query.
+func (p *prometheusProvider) hasSamples(ctx context.Context, t time.Time) (bool, error) {
+	query, err := p.queries.Query(model.ResourceMemory, QueryParams{
+		Selector: "{" + p.labelSchema.Selector + "}",
+		Range:    utils.FormatDuration(p.step),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("cannot get network receive io history: %v", err)
+		return false, err
 	}
-	err = p.readResource(res, fmt.Sprintf("max_over_time(container_network_transmit_bytes_total:rate:1m{%s}[%s] offset %s)", podSelector, historyLen, offset), model.ResourceNetworkTransmitIO)
+	tss, err := p.prometheusClient.GetTimeseriesAt(ctx, "count("+query+")", t)
 	if err != nil {
-		return nil, fmt.Errorf("cannot get network transmit io history: %v", err)
+		return false, fmt.Errorf("cannot probe samples at %v: %v", t, err)
 	}
-	return res, nil
+	return len(tss) > 0, nil
 }
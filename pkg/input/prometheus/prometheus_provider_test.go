@@ -0,0 +1,241 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+	"github.com/angao/recommender/pkg/model"
+)
+
+var defaultLabelSchema = &v1alpha1.LabelSchema{
+	Application: "system_mwType_serviceID",
+	Container:   "container_name",
+	Instance:    []string{"name"},
+	Selector:    `pod_name=~"^.*$",container_name!="POD",image!="",name=~"^k8s_.*"`,
+}
+
+var defaultQueryTemplates, _ = ParseQueryTemplates(nil)
+
+func TestChunks(t *testing.T) {
+	start := time.Unix(1540000000, 0)
+	ranges := chunks(start, start.Add(50*time.Minute), 5*time.Minute, 20*time.Minute)
+	want := []timeRange{
+		{start, start.Add(15 * time.Minute)},
+		{start.Add(20 * time.Minute), start.Add(35 * time.Minute)},
+		{start.Add(40 * time.Minute), start.Add(50 * time.Minute)},
+	}
+	if len(ranges) != len(want) {
+		t.Fatalf("got %d chunks, want %d", len(ranges), len(want))
+	}
+	for i := range want {
+		if !ranges[i].start.Equal(want[i].start) || !ranges[i].end.Equal(want[i].end) {
+			t.Errorf("chunk %d: got %v - %v, want %v - %v", i, ranges[i].start, ranges[i].end, want[i].start, want[i].end)
+		}
+	}
+	if ranges := chunks(start, start, 5*time.Minute, time.Hour); len(ranges) != 1 {
+		t.Errorf("single evaluation: got %d chunks, want 1", len(ranges))
+	}
+}
+
+// chunkGetter answers every range query with one sample at its start, and
+// fails the first request of the chunk starting at failStart.
+type chunkGetter struct {
+	sync.Mutex
+	failStart string
+	requests  map[string]int
+}
+
+func (f *chunkGetter) Do(req *http.Request) (*http.Response, error) {
+	start := req.FormValue("start")
+	f.Lock()
+	f.requests[start]++
+	requests := f.requests[start]
+	f.Unlock()
+	if start == f.failStart && requests == 1 {
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: ioutil.NopCloser(&bytes.Buffer{})}, nil
+	}
+	body := fmt.Sprintf(`{"status": "success", "data": {"resultType": "matrix", "result": [
+		{"metric": {"system_mwType_serviceID": "web", "container_name": "app", "name": "k8s_app"}, "values": [[%s, "1"]]}
+	]}}`, start)
+	return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBufferString(body))}, nil
+}
+
+func TestReadResourceChunks(t *testing.T) {
+	defer func(delay time.Duration) { retryDelay = delay }(retryDelay)
+	retryDelay = 0
+
+	start := time.Unix(1540000000, 0)
+	getter := &chunkGetter{failStart: formatTime(start.Add(time.Hour)), requests: make(map[string]int)}
+	provider := &prometheusProvider{
+		prometheusClient: NewPrometheusClient(getter, "http://prometheus:9090", nil),
+		chunkSize:        time.Hour,
+		chunkConcurrency: 2,
+	}
+	res := make(map[model.AggregateStateKey]*model.AggregateContainerState)
+	err := provider.readResource(context.Background(), res, "up", defaultLabelSchema, model.ResourceCPU, start, start.Add(3*time.Hour), 5*time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(getter.requests) != 4 {
+		t.Errorf("expected 4 chunks, got %v", getter.requests)
+	}
+	for chunkStart, requests := range getter.requests {
+		if want := 1; chunkStart == getter.failStart {
+			if want = 2; requests != want {
+				t.Errorf("failed chunk %s: got %d requests, want %d", chunkStart, requests, want)
+			}
+		} else if requests != want {
+			t.Errorf("chunk %s: got %d requests, want %d", chunkStart, requests, want)
+		}
+	}
+	if len(res) != 1 {
+		t.Fatalf("expected the chunks to be merged into 1 container, got %d", len(res))
+	}
+	for _, state := range res {
+		if state.TotalSamplesCount != 4 {
+			t.Errorf("expected 4 samples, got %d", state.TotalSamplesCount)
+		}
+	}
+}
+
+const batchResponse = `{
+  "status": "success",
+  "data": {
+    "resultType": "matrix",
+    "result": [
+      {"metric": {"system_mwType_serviceID": "shop.web", "container_name": "app", "name": "k8s_app_1"}, "values": [[1540000300, "1"]]},
+      {"metric": {"system_mwType_serviceID": "shop.web", "container_name": "app", "name": "k8s_app_2"}, "values": [[1540000300, "2"]]},
+      {"metric": {"system_mwType_serviceID": "other", "container_name": "app", "name": "k8s_app_3"}, "values": [[1540000300, "3"]]}
+    ]
+  }
+}`
+
+func TestGetBatchHistoryMetrics(t *testing.T) {
+	getter := &fakeGetter{body: batchResponse}
+	provider := &prometheusProvider{
+		prometheusClient: NewPrometheusClient(getter, "http://prometheus:9090", nil),
+		step:             5 * time.Minute,
+		chunkSize:        24 * time.Hour,
+		chunkConcurrency: 1,
+		queries:          defaultQueryTemplates,
+	}
+	start := time.Unix(1540000000, 0)
+	applications, err := provider.GetBatchHistoryMetrics(context.Background(), []string{"shop.web", "cart"}, defaultLabelSchema, start, start.Add(5*time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(applications) != 2 || len(applications["shop.web"]) != 2 || len(applications["cart"]) != 0 {
+		t.Errorf("unexpected usage by application: %v", applications)
+	}
+	query := getter.form.Get("query")
+	if !strings.HasPrefix(query, "max by (system_mwType_serviceID, container_name, name) (") {
+		t.Errorf("expected a grouped query, got %s", query)
+	}
+	if !strings.Contains(query, `system_mwType_serviceID=~"^(shop\\.web|cart)$"`) {
+		t.Errorf("expected the applications to be selected, got %s", query)
+	}
+}
+
+const kubePrometheusResponse = `{
+  "status": "success",
+  "data": {
+    "resultType": "matrix",
+    "result": [
+      {"metric": {"app": "web", "container": "app", "namespace": "shop", "pod": "web-1"}, "values": [[1540000300, "1"]]},
+      {"metric": {"app": "web", "container": "app", "namespace": "shop", "pod": "web-2"}, "values": [[1540000300, "2"]]},
+      {"metric": {"app": "web", "container": "app", "namespace": "default", "pod": "web-1"}, "values": [[1540000300, "3"]]}
+    ]
+  }
+}`
+
+func TestGetHistoryMetricsLabelSchema(t *testing.T) {
+	getter := &fakeGetter{body: kubePrometheusResponse}
+	provider := &prometheusProvider{
+		prometheusClient: NewPrometheusClient(getter, "http://prometheus:9090", nil),
+		step:             5 * time.Minute,
+		chunkSize:        24 * time.Hour,
+		chunkConcurrency: 1,
+		queries:          defaultQueryTemplates,
+	}
+	schema := &v1alpha1.LabelSchema{
+		Application: "app",
+		Container:   "container",
+		Instance:    []string{"namespace", "pod"},
+		Selector:    `container!="POD",container!=""`,
+	}
+	start := time.Unix(1540000000, 0)
+	states, err := provider.GetHistoryMetrics(context.Background(), "web", schema, start, start.Add(5*time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Pods of the same name in different namespaces are different instances.
+	if len(states) != 3 {
+		t.Errorf("expected 3 instances, got %v", states)
+	}
+	for key := range states {
+		if key.ApplicationName() != "web" || key.ContainerName() != "app" {
+			t.Errorf("unexpected key %v", key)
+		}
+	}
+	query := getter.form.Get("query")
+	if !strings.Contains(query, `{container!="POD",container!="",app="web"}`) {
+		t.Errorf("expected the schema selector, got %s", query)
+	}
+}
+
+func TestGetHistoryMetricsEscapesNames(t *testing.T) {
+	getter := &fakeGetter{body: batchResponse}
+	provider := &prometheusProvider{
+		prometheusClient: NewPrometheusClient(getter, "http://prometheus:9090", nil),
+		step:             5 * time.Minute,
+		chunkSize:        24 * time.Hour,
+		chunkConcurrency: 1,
+		queries:          defaultQueryTemplates,
+	}
+	start := time.Unix(1540000000, 0)
+	if _, err := provider.GetHistoryMetrics(context.Background(), `we"b`, defaultLabelSchema, start, start.Add(5*time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if query := getter.form.Get("query"); !strings.Contains(query, `system_mwType_serviceID="we\"b"`) {
+		t.Errorf("expected the quote to be escaped, got %s", query)
+	}
+	if _, err := provider.GetBatchHistoryMetrics(context.Background(), []string{`we"b`, `c\art`}, defaultLabelSchema, start, start.Add(5*time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if query := getter.form.Get("query"); !strings.Contains(query, `system_mwType_serviceID=~"^(we\"b|c\\\\art)$"`) {
+		t.Errorf("expected the quote and the backslash to be escaped, got %s", query)
+	}
+}
+
+func TestJoinSelectors(t *testing.T) {
+	if got := joinSelectors("", `app="web"`); got != `app="web"` {
+		t.Errorf("got %s", got)
+	}
+	if got := joinSelectors(`image!="",`, `app="web"`); got != `image!="",app="web"` {
+		t.Errorf("got %s", got)
+	}
+}
@@ -32,28 +32,36 @@ import (
 
 type responseType struct {
 	// Should be "success".
-	Status      string   `json:status`
-	Data        dataType `json:data`
-	ErrorType   string   `json:errorType`
-	ErrorString string   `json:error`
+	Status      string   `json:"status"`
+	Data        dataType `json:"data"`
+	ErrorType   string   `json:"errorType"`
+	ErrorString string   `json:"error"`
 }
 
 // Holds all the data returned.
 type dataType struct {
 	// For range vectors, this will be "matrix". Other possibilities are:
 	// "vector","scalar","string".
-	ResultType string `json:resultType`
+	ResultType string `json:"resultType"`
 	// This has different types depending on ResultType.
-	Result json.RawMessage `json:result`
+	Result json.RawMessage `json:"result"`
 }
 
 type vectorType struct {
 	// Labels of the timeseries.
-	Metric map[string]string `json:metric`
+	Metric map[string]string `json:"metric"`
+	// A single sample represented as a two-item list with floating point
+	// timestamp in seconds and a string holding the value of the metric.
+	Value []interface{} `json:"value"`
+}
+
+type matrixType struct {
+	// Labels of the timeseries.
+	Metric map[string]string `json:"metric"`
 	// List of samples. Each sample is represented as a two-item list with
 	// floating point timestamp in seconds and a string holding the value
 	// of the metric.
-	Value []interface{} `json:value`
+	Values [][]interface{} `json:"values"`
 }
 
 func decodeVectorSamples(input []interface{}) (Sample, error) {
@@ -83,11 +91,21 @@ func decodeTimeseriesFromResponse(input io.Reader) ([]Timeseries, error) {
 	if err != nil {
 		return nil, fmt.Errorf("couldn't parse response: %v", err)
 	}
-	if resp.Status != "success" || resp.Data.ResultType != "vector" {
-		return nil, fmt.Errorf("invalid response status: %s or type: %s", resp.Status, resp.Data.ResultType)
+	if resp.Status != "success" {
+		return nil, fmt.Errorf("invalid response status: %s", resp.Status)
+	}
+	switch resp.Data.ResultType {
+	case "vector":
+		return decodeVectors(resp.Data.Result)
+	case "matrix":
+		return decodeMatrices(resp.Data.Result)
 	}
+	return nil, fmt.Errorf("invalid response type: %s", resp.Data.ResultType)
+}
+
+func decodeVectors(result json.RawMessage) ([]Timeseries, error) {
 	var vectors []vectorType
-	err = json.Unmarshal(resp.Data.Result, &vectors)
+	err := json.Unmarshal(result, &vectors)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't parse response vector: %v", err)
 	}
@@ -97,8 +115,28 @@ func decodeTimeseriesFromResponse(input io.Reader) ([]Timeseries, error) {
 		if err != nil {
 			return []Timeseries{}, fmt.Errorf("error decoding sample: %v", err)
 		}
-		res = append(res, Timeseries{Labels: vector.Metric, Sample: sample})
+		res = append(res, Timeseries{Labels: vector.Metric, Samples: []Sample{sample}})
 	}
 	return res, nil
+}
 
+func decodeMatrices(result json.RawMessage) ([]Timeseries, error) {
+	var matrices []matrixType
+	err := json.Unmarshal(result, &matrices)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse response matrix: %v", err)
+	}
+	res := make([]Timeseries, 0)
+	for _, matrix := range matrices {
+		samples := make([]Sample, 0, len(matrix.Values))
+		for _, value := range matrix.Values {
+			sample, err := decodeVectorSamples(value)
+			if err != nil {
+				return []Timeseries{}, fmt.Errorf("error decoding sample: %v", err)
+			}
+			samples = append(samples, sample)
+		}
+		res = append(res, Timeseries{Labels: matrix.Metric, Samples: samples})
+	}
+	return res, nil
 }
@@ -0,0 +1,199 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+)
+
+const vectorResponse = `{
+  "status": "success",
+  "data": {
+    "resultType": "vector",
+    "result": [
+      {"metric": {"container_name": "web"}, "value": [1540000000, "1.5"]}
+    ]
+  }
+}`
+
+const matrixResponse = `{
+  "status": "success",
+  "data": {
+    "resultType": "matrix",
+    "result": [
+      {"metric": {"container_name": "web"}, "values": [[1540000000, "1"], [1540000060, "2"], [1540000120, "3"]]},
+      {"metric": {"container_name": "db"}, "values": [[1540000000, "10"]]}
+    ]
+  }
+}`
+
+func TestDecodeVectorResponse(t *testing.T) {
+	tss, err := decodeTimeseriesFromResponse(strings.NewReader(vectorResponse))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tss) != 1 || len(tss[0].Samples) != 1 {
+		t.Fatalf("expected one timeseries with one sample, got %+v", tss)
+	}
+	if tss[0].Samples[0].Value != 1.5 || tss[0].Labels["container_name"] != "web" {
+		t.Errorf("unexpected timeseries: %+v", tss[0])
+	}
+}
+
+func TestDecodeMatrixResponse(t *testing.T) {
+	tss, err := decodeTimeseriesFromResponse(strings.NewReader(matrixResponse))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tss) != 2 {
+		t.Fatalf("expected two timeseries, got %d", len(tss))
+	}
+	if len(tss[0].Samples) != 3 || len(tss[1].Samples) != 1 {
+		t.Fatalf("unexpected sample counts: %d, %d", len(tss[0].Samples), len(tss[1].Samples))
+	}
+	last := tss[0].Samples[2]
+	if last.Value != 3 || !last.Timestamp.Equal(time.Unix(1540000120, 0)) {
+		t.Errorf("unexpected last sample: %+v", last)
+	}
+}
+
+func TestDecodeRejectsScalar(t *testing.T) {
+	resp := `{"status": "success", "data": {"resultType": "scalar", "result": [1540000000, "1"]}}`
+	if _, err := decodeTimeseriesFromResponse(strings.NewReader(resp)); err == nil {
+		t.Errorf("expected error for scalar result")
+	}
+}
+
+type fakeGetter struct {
+	method string
+	url    string
+	// form is the parameters of the last query.
+	form url.Values
+	body string
+}
+
+func (f *fakeGetter) Do(req *http.Request) (*http.Response, error) {
+	if err := req.ParseForm(); err != nil {
+		return nil, err
+	}
+	f.method, f.url, f.form = req.Method, req.URL.String(), req.PostForm
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(f.body)),
+	}, nil
+}
+
+func TestGetRangeTimeseries(t *testing.T) {
+	getter := &fakeGetter{body: matrixResponse}
+	client := NewPrometheusClient(getter, "http://prometheus:9090", nil)
+	start := time.Unix(1540000000, 0)
+	tss, err := client.GetRangeTimeseries(context.Background(), "up", start, start.Add(2*time.Minute), time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tss) != 2 {
+		t.Fatalf("expected two timeseries, got %d", len(tss))
+	}
+	u, err := url.Parse(getter.url)
+	if err != nil {
+		t.Fatalf("invalid url %q: %v", getter.url, err)
+	}
+	if u.Path != "/api/v1/query_range" {
+		t.Errorf("unexpected path: %s", u.Path)
+	}
+	if getter.method != "POST" {
+		t.Errorf("expected the query to be posted, got %s", getter.method)
+	}
+	values := getter.form
+	if values.Get("start") != "1540000000" || values.Get("end") != "1540000120" || values.Get("step") != "60" {
+		t.Errorf("unexpected query values: %v", values)
+	}
+}
+
+// retentionGetter answers instant queries with a sample from earliest on.
+type retentionGetter struct {
+	earliest time.Time
+	queries  int
+	query    string
+}
+
+func (f *retentionGetter) Do(req *http.Request) (*http.Response, error) {
+	f.queries++
+	f.query = req.FormValue("query")
+	seconds, err := strconv.ParseFloat(req.FormValue("time"), 64)
+	if err != nil {
+		return nil, err
+	}
+	body := `{"status": "success", "data": {"resultType": "vector", "result": []}}`
+	if !time.Unix(int64(seconds), 0).Before(f.earliest) {
+		body = vectorResponse
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+	}, nil
+}
+
+func TestEarliestSample(t *testing.T) {
+	until := time.Unix(1540000000, 0)
+	since := until.Add(-30 * 24 * time.Hour)
+	getter := &retentionGetter{earliest: until.Add(-15*24*time.Hour - 90*time.Minute)}
+	queries, err := ParseQueryTemplates(map[string]string{
+		"memory": "max_over_time(container_memory_working_set_bytes{{.Selector}}[{{.Range}}]{{.Offset}})",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	provider := &prometheusProvider{
+		prometheusClient: NewPrometheusClient(getter, "http://prometheus:9090", nil),
+		step:             5 * time.Minute,
+		queries:          queries,
+		labelSchema:      v1alpha1.LabelSchema{Selector: `container!="POD"`},
+	}
+	earliest, err := provider.EarliestSample(context.Background(), since, until)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `count(max_over_time(container_memory_working_set_bytes{container!="POD"}[300s]))`; getter.query != want {
+		t.Errorf("probe: got %s, want %s", getter.query, want)
+	}
+	if earliest.Before(getter.earliest) || earliest.Sub(getter.earliest) > time.Minute {
+		t.Errorf("got %v, want within a minute after %v", earliest, getter.earliest)
+	}
+	if getter.queries > 20 {
+		t.Errorf("expected a bisection, got %d queries", getter.queries)
+	}
+
+	getter.earliest = since
+	if earliest, _ := provider.EarliestSample(context.Background(), since, until); !earliest.Equal(since) {
+		t.Errorf("full retention: got %v, want %v", earliest, since)
+	}
+	getter.earliest = until.Add(time.Hour)
+	if earliest, _ := provider.EarliestSample(context.Background(), since, until); !earliest.IsZero() {
+		t.Errorf("no samples: got %v, want zero", earliest)
+	}
+}
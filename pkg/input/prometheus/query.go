@@ -0,0 +1,116 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/angao/recommender/pkg/model"
+)
+
+// DefaultQueries are the templates of the usage queries of the resources
+// which are not configured. They rely on the recording rules of rates over 1m.
+var DefaultQueries = map[model.ResourceName]string{
+	model.ResourceCPU:               "max_over_time(container_cpu_usage_seconds_total:rate:1m{{.Selector}}[{{.Range}}]{{.Offset}})",
+	model.ResourceMemory:            "max_over_time(container_memory_usage_bytes{{.Selector}}[{{.Range}}]{{.Offset}})",
+	model.ResourceDiskReadIO:        "max_over_time(container_fs_reads_total:rate:1m{{.Selector}}[{{.Range}}]{{.Offset}})",
+	model.ResourceDiskWriteIO:       "max_over_time(container_fs_writes_total:rate:1m{{.Selector}}[{{.Range}}]{{.Offset}})",
+	model.ResourceNetworkReceiveIO:  "max_over_time(container_network_receive_bytes_total:rate:1m{{.Selector}}[{{.Range}}]{{.Offset}})",
+	model.ResourceNetworkTransmitIO: "max_over_time(container_network_transmit_bytes_total:rate:1m{{.Selector}}[{{.Range}}]{{.Offset}})",
+}
+
+// QueryParams are the placeholders of a query template.
+type QueryParams struct {
+	// Selector is the label selector of the containers, braces included,
+	// e.g. {container_name!="POD",system_mwType_serviceID="web"}.
+	Selector string
+	// Range is the range of a step, e.g. 5m. A query is expected to return
+	// the peak usage of every container within the range before each
+	// evaluation.
+	Range string
+	// Offset is the offset modifier, e.g. " offset 1m", or empty.
+	Offset string
+}
+
+// The placeholders rendered to check that a template uses them.
+const (
+	selectorPlaceholder = "<selector>"
+	rangePlaceholder    = "<range>"
+)
+
+// QueryTemplates maps every resource to the template of its usage query.
+type QueryTemplates map[model.ResourceName]*template.Template
+
+// ParseQueryTemplates parses the configured query templates, keyed by
+// resource name, and falls back to DefaultQueries for the other resources.
+// The templates are executed once to catch errors early, and must select the
+// containers with {{.Selector}} and read the step with {{.Range}}.
+func ParseQueryTemplates(queries map[string]string) (QueryTemplates, error) {
+	known := make(map[model.ResourceName]bool)
+	for _, resource := range model.ResourceNames {
+		known[resource] = true
+	}
+	for name := range queries {
+		if !known[model.ResourceName(name)] {
+			return nil, fmt.Errorf("unknown resource %q", name)
+		}
+	}
+
+	templates := make(QueryTemplates)
+	for _, resource := range model.ResourceNames {
+		text, ok := queries[string(resource)]
+		if !ok {
+			text = DefaultQueries[resource]
+		}
+		tmpl, err := template.New(string(resource)).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", resource, err)
+		}
+		templates[resource] = tmpl
+		query, err := templates.Query(resource, QueryParams{Selector: `{container_name!="POD"}`, Range: "5m", Offset: " offset 1m"})
+		if err != nil {
+			return nil, err
+		}
+		if len(strings.TrimSpace(query)) == 0 {
+			return nil, fmt.Errorf("%s: empty query", resource)
+		}
+		query, err = templates.Query(resource, QueryParams{Selector: selectorPlaceholder, Range: rangePlaceholder})
+		if err != nil {
+			return nil, err
+		}
+		if !strings.Contains(query, selectorPlaceholder) || !strings.Contains(query, rangePlaceholder) {
+			return nil, fmt.Errorf("%s: the query must use {{.Selector}} and {{.Range}}", resource)
+		}
+	}
+	return templates, nil
+}
+
+// Query renders the usage query of the resource.
+func (t QueryTemplates) Query(resource model.ResourceName, params QueryParams) (string, error) {
+	tmpl, ok := t[resource]
+	if !ok {
+		return "", fmt.Errorf("no query of %s", resource)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, params); err != nil {
+		return "", fmt.Errorf("%s: %v", resource, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/angao/recommender/pkg/model"
+)
+
+func TestParseQueryTemplates(t *testing.T) {
+	templates, err := ParseQueryTemplates(map[string]string{
+		"memory": "max_over_time(container_memory_working_set_bytes{{.Selector}}[{{.Range}}]{{.Offset}})",
+		"cpu":    "max_over_time(rate(container_cpu_usage_seconds_total{{.Selector}}[1m])[{{.Range}}:1m])",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	params := QueryParams{Selector: `{app="web"}`, Range: "5m", Offset: " offset 1m"}
+	query, err := templates.Query(model.ResourceMemory, params)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `max_over_time(container_memory_working_set_bytes{app="web"}[5m] offset 1m)`; query != want {
+		t.Errorf("got %s, want %s", query, want)
+	}
+	query, _ = templates.Query(model.ResourceCPU, params)
+	if want := `max_over_time(rate(container_cpu_usage_seconds_total{app="web"}[1m])[5m:1m])`; query != want {
+		t.Errorf("got %s, want %s", query, want)
+	}
+	// Resources which are not configured use the default queries.
+	query, _ = templates.Query(model.ResourceDiskReadIO, QueryParams{Selector: `{app="web"}`, Range: "5m"})
+	if want := `max_over_time(container_fs_reads_total:rate:1m{app="web"}[5m])`; query != want {
+		t.Errorf("got %s, want %s", query, want)
+	}
+}
+
+func TestParseQueryTemplatesErrors(t *testing.T) {
+	cases := []struct {
+		queries map[string]string
+		err     string
+	}{
+		{map[string]string{"gpu": "up"}, `unknown resource "gpu"`},
+		{map[string]string{"cpu": "rate(x{{.Selector}"}, "cpu:"},
+		{map[string]string{"cpu": "rate(x{{.Labels}})"}, "cpu:"},
+		{map[string]string{"memory": "  "}, "memory: empty query"},
+		{map[string]string{"memory": "max_over_time(container_memory_usage_bytes[{{.Range}}])"}, "memory: the query must use"},
+		{map[string]string{"cpu": "container_cpu_usage_seconds_total:rate:1m{{.Selector}}"}, "cpu: the query must use"},
+	}
+	for _, c := range cases {
+		_, err := ParseQueryTemplates(c.queries)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%v: got error %v, want %s", c.queries, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/angao/recommender/pkg/utils"
+)
+
+// NewHTTPClient builds the client of the requests to Prometheus, with the
+// timeout, TLS, proxy, authentication and extra headers of the config.
+// The config is expected to be validated.
+func NewHTTPClient(config utils.PrometheusConfig) (*http.Client, error) {
+	tlsConfig, err := newTLSConfig(config.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	proxy := http.ProxyFromEnvironment
+	if len(config.ProxyURL) != 0 {
+		proxyURL, err := url.Parse(config.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %v", err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	timeout, _ := utils.ParseDuration(config.Timeout)
+
+	var transport http.RoundTripper = &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsConfig,
+	}
+	auth := &authRoundTripper{headers: config.Headers, next: transport}
+	switch {
+	case len(config.BearerToken) != 0:
+		auth.bearerToken = &secret{value: config.BearerToken}
+	case len(config.BearerTokenFile) != 0:
+		auth.bearerToken = &secret{file: config.BearerTokenFile}
+	case config.BasicAuth != nil:
+		auth.username = config.BasicAuth.Username
+		auth.password = &secret{value: config.BasicAuth.Password, file: config.BasicAuth.PasswordFile}
+	}
+	// Reads the secrets once to report missing files early.
+	for _, s := range []*secret{auth.bearerToken, auth.password} {
+		if s == nil {
+			continue
+		}
+		if _, err := s.get(); err != nil {
+			return nil, err
+		}
+	}
+	return &http.Client{Transport: auth, Timeout: timeout}, nil
+}
+
+func newTLSConfig(config utils.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if len(config.CAFile) != 0 {
+		ca, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate in CA file %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(config.CertFile) != 0 {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// secret is either a static value, or the content of a file which is read
+// again once the file is modified.
+type secret struct {
+	value string
+	file  string
+
+	lock    sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+func (s *secret) get() (string, error) {
+	if len(s.file) == 0 {
+		return s.value, nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return "", fmt.Errorf("cannot read %s: %v", s.file, err)
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return s.value, nil
+	}
+	content, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		return "", fmt.Errorf("cannot read %s: %v", s.file, err)
+	}
+	s.value = strings.TrimSpace(string(content))
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return s.value, nil
+}
+
+// authRoundTripper sets the extra headers and the credentials of the requests.
+type authRoundTripper struct {
+	headers     map[string]string
+	bearerToken *secret
+	username    string
+	password    *secret
+	next        http.RoundTripper
+}
+
+func (rt *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request, so the headers are set on a copy.
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+len(rt.headers)+1)
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	for k, v := range rt.headers {
+		r.Header.Set(k, v)
+	}
+	if rt.bearerToken != nil {
+		token, err := rt.bearerToken.get()
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	if rt.password != nil {
+		password, err := rt.password.get()
+		if err != nil {
+			return nil, err
+		}
+		r.SetBasicAuth(rt.username, password)
+	}
+	return rt.next.RoundTrip(r)
+}
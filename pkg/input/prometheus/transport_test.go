@@ -0,0 +1,146 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prometheus
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/angao/recommender/pkg/utils"
+)
+
+// headerServer records the headers of the last request.
+func headerServer(header *http.Header) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*header = r.Header
+	}))
+}
+
+func TestHTTPClientHeaders(t *testing.T) {
+	var header http.Header
+	server := headerServer(&header)
+	defer server.Close()
+
+	client, err := NewHTTPClient(utils.PrometheusConfig{
+		Timeout:   "10s",
+		BasicAuth: &utils.BasicAuth{Username: "user", Password: "secret"},
+		Headers:   map[string]string{"X-Scope-OrgID": "tenant-1"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if got := header.Get("X-Scope-OrgID"); got != "tenant-1" {
+		t.Errorf("X-Scope-OrgID: got %q", got)
+	}
+	if got := header.Get("Authorization"); got != "Basic dXNlcjpzZWNyZXQ=" {
+		t.Errorf("Authorization: got %q", got)
+	}
+	if len(req.Header) != 0 {
+		t.Errorf("expected the request not to be modified, got %v", req.Header)
+	}
+}
+
+func TestHTTPClientBearerTokenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prometheus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var header http.Header
+	server := headerServer(&header)
+	defer server.Close()
+	client, err := NewHTTPClient(utils.PrometheusConfig{Timeout: "10s", BearerTokenFile: tokenFile})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	get := func() string {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		return header.Get("Authorization")
+	}
+	if got := get(); got != "Bearer first" {
+		t.Errorf("got %q, want the first token", got)
+	}
+	// The rotated token is read once the file is modified.
+	if err := ioutil.WriteFile(tokenFile, []byte("second"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(tokenFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(); got != "Bearer second" {
+		t.Errorf("got %q, want the rotated token", got)
+	}
+
+	if _, err := NewHTTPClient(utils.PrometheusConfig{Timeout: "10s", BearerTokenFile: filepath.Join(dir, "missing")}); err == nil {
+		t.Errorf("expected an error for a missing token file")
+	}
+}
+
+func TestHTTPClientCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "prometheus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewHTTPClient(utils.PrometheusConfig{Timeout: "10s"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.Get(server.URL); err == nil {
+		t.Errorf("expected the unknown CA to be rejected")
+	}
+	client, err = NewHTTPClient(utils.PrometheusConfig{Timeout: "10s", TLSConfig: utils.TLSConfig{CAFile: caFile}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+}
@@ -27,7 +27,8 @@ type Sample struct {
 }
 
 // Timeseries represents a metric with given labels, with its values possibly changing in time.
+// Instant queries yield a single sample, range queries one sample per step.
 type Timeseries struct {
-	Labels map[string]string
-	Sample Sample
+	Labels  map[string]string
+	Samples []Sample
 }
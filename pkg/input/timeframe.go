@@ -0,0 +1,93 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package input
+
+import (
+	"time"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+	"github.com/angao/recommender/pkg/utils"
+	"github.com/angao/recommender/pkg/utils/cron"
+)
+
+const (
+	// The backoff before retrying a failed timeframe computation doubles with
+	// every failed attempt, from minRetryBackoff up to maxRetryBackoff.
+	minRetryBackoff = time.Minute
+	maxRetryBackoff = time.Hour
+)
+
+// window is a period of usage a timeframe recommendation is computed from.
+type window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// recurringWindows returns the occurrences of the recurring timeframe which
+// finished within the history ending at end. Overlapping occurrences are
+// merged into one window.
+func recurringWindows(timeframe *v1alpha1.Timeframe, history time.Duration, end time.Time) ([]window, error) {
+	schedule, err := cron.Parse(timeframe.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := utils.ParseDuration(timeframe.Duration)
+	if err != nil {
+		return nil, err
+	}
+	// The schedule fires in the time zone of the timeframe.
+	end = end.In(timeframe.Location())
+	windows := make([]window, 0)
+	for _, start := range schedule.Between(end.Add(-history-duration), end.Add(-duration)) {
+		w := window{Start: start, End: start.Add(duration)}
+		if n := len(windows); n > 0 && !w.Start.After(windows[n-1].End) {
+			windows[n-1].End = w.End
+			continue
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// latestWindows returns the latest max windows, and the number of the
+// windows left out.
+func latestWindows(windows []window, max int) ([]window, int) {
+	if len(windows) <= max {
+		return windows, 0
+	}
+	return windows[len(windows)-max:], len(windows) - max
+}
+
+// setTimeframeFailed records the failure of the timeframe's computation and
+// schedules its retry.
+func setTimeframeFailed(timeframe *v1alpha1.Timeframe, err error, now time.Time) {
+	timeframe.Status = v1alpha1.StatusFailed
+	timeframe.Error = err.Error()
+	timeframe.NextAttempt = now.Add(retryBackoff(timeframe.Attempts))
+}
+
+// retryBackoff returns the backoff after the given number of failed attempts.
+func retryBackoff(attempts int) time.Duration {
+	backoff := minRetryBackoff
+	for i := 1; i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package input
+
+import (
+	"testing"
+	"time"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+)
+
+func TestRecurringWindows(t *testing.T) {
+	timeframe := &v1alpha1.Timeframe{Schedule: "0 9 * * 1", Duration: "2h"}
+	// Tuesday, the Monday occurrence one day before has finished.
+	end := time.Date(2018, 10, 16, 10, 0, 0, 0, time.Local)
+	windows, err := recurringWindows(timeframe, 30*24*time.Hour, end)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(windows) != 5 {
+		t.Fatalf("expected 5 windows, got %d", len(windows))
+	}
+	last := windows[len(windows)-1]
+	if want := time.Date(2018, 10, 15, 9, 0, 0, 0, time.Local); !last.Start.Equal(want) || !last.End.Equal(want.Add(2*time.Hour)) {
+		t.Errorf("unexpected last window %v - %v", last.Start, last.End)
+	}
+
+	// An occurrence which has not finished yet is not included.
+	end = time.Date(2018, 10, 15, 10, 0, 0, 0, time.Local)
+	windows, _ = recurringWindows(timeframe, 30*24*time.Hour, end)
+	if last := windows[len(windows)-1]; !last.End.Before(end) {
+		t.Errorf("unfinished occurrence included: %v - %v", last.Start, last.End)
+	}
+}
+
+func TestRecurringWindowsTimeZone(t *testing.T) {
+	timeframe := &v1alpha1.Timeframe{Schedule: "0 20 * * *", Duration: "1h", TimeZone: "Asia/Shanghai"}
+	end := time.Date(2018, 10, 16, 13, 0, 0, 0, time.UTC)
+	windows, err := recurringWindows(timeframe, 24*time.Hour, end)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// 20:00 in Shanghai is 12:00 UTC.
+	if want := time.Date(2018, 10, 16, 12, 0, 0, 0, time.UTC); len(windows) != 1 || !windows[0].Start.Equal(want) {
+		t.Errorf("expected a window starting at %v, got %v", want, windows)
+	}
+}
+
+func TestRecurringWindowsMergeOverlaps(t *testing.T) {
+	timeframe := &v1alpha1.Timeframe{Schedule: "0 * * * *", Duration: "90m"}
+	end := time.Date(2018, 10, 16, 12, 0, 0, 0, time.Local)
+	windows, err := recurringWindows(timeframe, 6*time.Hour, end)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(windows) != 1 {
+		t.Fatalf("expected the occurrences to be merged into 1 window, got %d", len(windows))
+	}
+}
+
+func TestLatestWindows(t *testing.T) {
+	timeframe := &v1alpha1.Timeframe{Schedule: "0 9 * * *", Duration: "1h"}
+	end := time.Date(2018, 10, 16, 12, 0, 0, 0, time.Local)
+	windows, err := recurringWindows(timeframe, 10*24*time.Hour, end)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	latest, dropped := latestWindows(windows, 3)
+	if len(latest) != 3 || dropped != len(windows)-3 {
+		t.Fatalf("got %d windows and %d dropped out of %d, want 3", len(latest), dropped, len(windows))
+	}
+	if !latest[2].End.Equal(windows[len(windows)-1].End) {
+		t.Errorf("expected the latest windows to be kept, got %v", latest)
+	}
+	if _, dropped := latestWindows(windows, len(windows)); dropped != 0 {
+		t.Errorf("expected no window to be dropped, got %d", dropped)
+	}
+}
+
+func TestTimeframeDue(t *testing.T) {
+	now := time.Date(2018, 10, 16, 10, 0, 0, 0, time.Local)
+	for _, c := range []struct {
+		status      string
+		end         time.Time
+		attempts    int
+		nextAttempt time.Time
+		due         bool
+		newAttempts int
+	}{
+		{status: v1alpha1.StatusScheduled, end: now.Add(time.Hour)},
+		{status: v1alpha1.StatusScheduled, end: now.Add(-time.Minute), due: true, newAttempts: 1},
+		{status: v1alpha1.StatusOn, end: now.Add(time.Hour)},
+		{status: v1alpha1.StatusPending, end: now, due: true, newAttempts: 1},
+		{status: v1alpha1.StatusOff, end: now.Add(-time.Hour)},
+		{status: v1alpha1.StatusSucceeded, end: now.Add(-time.Hour), attempts: 1},
+		{status: v1alpha1.StatusRunning, end: now.Add(-time.Hour), attempts: 1, due: true, newAttempts: 2},
+		{status: v1alpha1.StatusRunning, end: now.Add(-time.Hour), attempts: v1alpha1.MaxTimeframeAttempts},
+		{status: v1alpha1.StatusFailed, end: now.Add(-time.Hour), attempts: 2, nextAttempt: now.Add(time.Minute)},
+		{status: v1alpha1.StatusFailed, end: now.Add(-time.Hour), attempts: 2, nextAttempt: now, due: true, newAttempts: 3},
+		{status: v1alpha1.StatusFailed, end: now.Add(-time.Hour), attempts: v1alpha1.MaxTimeframeAttempts, nextAttempt: now},
+	} {
+		timeframe := &v1alpha1.Timeframe{
+			Status:      c.status,
+			Start:       c.end.Add(-time.Hour),
+			End:         c.end,
+			Attempts:    c.attempts,
+			NextAttempt: c.nextAttempt,
+		}
+		if due := timeframeDue(timeframe, 30*24*time.Hour, now); due != c.due {
+			t.Errorf("%s timeframe ending %v after %d attempts: expected due %v, got %v", c.status, c.end, c.attempts, c.due, due)
+		} else if due && timeframe.Attempts != c.newAttempts {
+			t.Errorf("%s timeframe after %d attempts: expected attempt %d, got %d", c.status, c.attempts, c.newAttempts, timeframe.Attempts)
+		}
+		if c.status == v1alpha1.StatusRunning && !c.due && timeframe.Status != v1alpha1.StatusFailed {
+			t.Errorf("interrupted timeframe after %d attempts: expected it to fail, got %s", c.attempts, timeframe.Status)
+		}
+	}
+}
+
+func TestRecurringTimeframeDue(t *testing.T) {
+	now := time.Date(2018, 10, 16, 10, 0, 0, 0, time.Local)
+	lastOccurrence := time.Date(2018, 10, 15, 11, 0, 0, 0, time.Local)
+	timeframe := &v1alpha1.Timeframe{Schedule: "0 9 * * 1", Duration: "2h", Status: v1alpha1.StatusSucceeded, LastOccurrence: lastOccurrence}
+	if timeframeDue(timeframe, 30*24*time.Hour, now) {
+		t.Errorf("recurring timeframe without a new occurrence should not be due")
+	}
+	// A new occurrence is computed even after the retries of the previous one were exhausted.
+	timeframe.Status = v1alpha1.StatusFailed
+	timeframe.Attempts = v1alpha1.MaxTimeframeAttempts
+	timeframe.LastOccurrence = lastOccurrence.AddDate(0, 0, -7)
+	if !timeframeDue(timeframe, 30*24*time.Hour, now) {
+		t.Fatalf("recurring timeframe with a new occurrence should be due")
+	}
+	if !timeframe.LastOccurrence.Equal(lastOccurrence) || timeframe.Attempts != 1 {
+		t.Errorf("unexpected last occurrence %v and attempts %d", timeframe.LastOccurrence, timeframe.Attempts)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		0:  time.Minute,
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		4:  8 * time.Minute,
+		10: time.Hour,
+	} {
+		if got := retryBackoff(attempts); got != want {
+			t.Errorf("backoff after %d attempts: got %v, want %v", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+	"github.com/angao/recommender/pkg/model"
+)
+
+// GetResourceBounds returns the bounds of the resource recommended for the
+// container. Resources missing from the container's own policy fall back to
+// the default container policy. Returns nil if no bounds apply.
+func GetResourceBounds(containerName string, resource model.ResourceName, policy *v1alpha1.ResourcePolicy) *v1alpha1.ResourceBounds {
+	if policy == nil {
+		return nil
+	}
+	var defaultBounds *v1alpha1.ResourceBounds
+	for _, containerPolicy := range policy.ContainerPolicies {
+		bounds, ok := containerPolicy.Resources[string(resource)]
+		if !ok {
+			continue
+		}
+		if containerPolicy.ContainerName == containerName {
+			return &bounds
+		}
+		if containerPolicy.ContainerName == v1alpha1.DefaultContainerResourcePolicy {
+			defaultBounds = &bounds
+		}
+	}
+	return defaultBounds
+}
+
+// ApplyResourceBounds adds the margin to the recommended amount and caps it
+// within the allowed range. Opted out resources are recommended as 0.
+func ApplyResourceBounds(amount model.ResourceAmount, bounds *v1alpha1.ResourceBounds) model.ResourceAmount {
+	if bounds == nil {
+		return amount
+	}
+	if bounds.Off {
+		return 0
+	}
+	amount = model.ResourceAmountFromFloat(float64(amount) * (1 + bounds.Margin/100))
+	return CapResourceAmount(amount, bounds)
+}
+
+// CapResourceAmount caps the amount within the allowed range without adding
+// the margin. Opted out resources are recommended as 0.
+func CapResourceAmount(amount model.ResourceAmount, bounds *v1alpha1.ResourceBounds) model.ResourceAmount {
+	if bounds == nil {
+		return amount
+	}
+	if bounds.Off {
+		return 0
+	}
+	if bounds.MinAllowed > 0 && amount < model.ResourceAmount(bounds.MinAllowed) {
+		amount = model.ResourceAmount(bounds.MinAllowed)
+	}
+	if bounds.MaxAllowed > 0 && amount > model.ResourceAmount(bounds.MaxAllowed) {
+		amount = model.ResourceAmount(bounds.MaxAllowed)
+	}
+	return amount
+}
+
+// ValidateResourcePolicy checks that container names are unique and bounds are consistent.
+func ValidateResourcePolicy(policy *v1alpha1.ResourcePolicy) error {
+	containerNames := make(map[string]bool)
+	for _, containerPolicy := range policy.ContainerPolicies {
+		if len(containerPolicy.ContainerName) == 0 {
+			return fmt.Errorf("container_name cannot be empty")
+		}
+		if containerNames[containerPolicy.ContainerName] {
+			return fmt.Errorf("duplicate policy of container %s", containerPolicy.ContainerName)
+		}
+		containerNames[containerPolicy.ContainerName] = true
+		for resource, bounds := range containerPolicy.Resources {
+			if !model.IsValidResourceName(model.ResourceName(resource)) {
+				return fmt.Errorf("container %s: unknown resource %q", containerPolicy.ContainerName, resource)
+			}
+			if bounds.Margin < 0 || bounds.MinAllowed < 0 || bounds.MaxAllowed < 0 {
+				return fmt.Errorf("container %s: %s bounds cannot be negative", containerPolicy.ContainerName, resource)
+			}
+			if bounds.MaxAllowed > 0 && bounds.MinAllowed > bounds.MaxAllowed {
+				return fmt.Errorf("container %s: %s min_allowed is greater than max_allowed", containerPolicy.ContainerName, resource)
+			}
+		}
+	}
+	return nil
+}
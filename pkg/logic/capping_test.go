@@ -0,0 +1,79 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+	"github.com/angao/recommender/pkg/model"
+)
+
+var testResourcePolicy = &v1alpha1.ResourcePolicy{
+	ContainerPolicies: []v1alpha1.ContainerResourcePolicy{
+		{
+			ContainerName: v1alpha1.DefaultContainerResourcePolicy,
+			Resources: map[string]v1alpha1.ResourceBounds{
+				"cpu":    {Margin: 15, MinAllowed: 100},
+				"memory": {MaxAllowed: 1000},
+			},
+		},
+		{
+			ContainerName: "sidecar",
+			Resources: map[string]v1alpha1.ResourceBounds{
+				"cpu": {Off: true},
+			},
+		},
+	},
+}
+
+func TestApplyResourceBounds(t *testing.T) {
+	cases := []struct {
+		container string
+		resource  model.ResourceName
+		amount    model.ResourceAmount
+		want      model.ResourceAmount
+	}{
+		{"web", model.ResourceCPU, 3, 100},
+		{"web", model.ResourceCPU, 1000, 1150},
+		{"web", model.ResourceMemory, 5000, 1000},
+		{"web", model.ResourceDiskReadIO, 5000, 5000},
+		{"sidecar", model.ResourceCPU, 1000, 0},
+		// Resources missing from the container policy fall back to the default one.
+		{"sidecar", model.ResourceMemory, 5000, 1000},
+	}
+	for _, c := range cases {
+		bounds := GetResourceBounds(c.container, c.resource, testResourcePolicy)
+		if got := ApplyResourceBounds(c.amount, bounds); got != c.want {
+			t.Errorf("%s/%s: got %v, want %v", c.container, c.resource, got, c.want)
+		}
+	}
+}
+
+func TestValidateResourcePolicy(t *testing.T) {
+	if err := ValidateResourcePolicy(testResourcePolicy); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	invalid := &v1alpha1.ResourcePolicy{
+		ContainerPolicies: []v1alpha1.ContainerResourcePolicy{
+			{ContainerName: "web", Resources: map[string]v1alpha1.ResourceBounds{"cpu": {MinAllowed: 10, MaxAllowed: 5}}},
+		},
+	}
+	if err := ValidateResourcePolicy(invalid); err == nil {
+		t.Errorf("expected error for min_allowed > max_allowed")
+	}
+}
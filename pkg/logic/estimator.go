@@ -0,0 +1,127 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"math"
+	"time"
+
+	"github.com/angao/recommender/pkg/model"
+)
+
+// ResourceEstimator computes the recommended amount of a single resource
+// from the usage aggregated for a container.
+type ResourceEstimator interface {
+	GetResourceEstimation(state *model.AggregateContainerState, resource model.ResourceName) model.ResourceAmount
+}
+
+// NewMaxEstimator returns a new maxEstimator.
+func NewMaxEstimator() ResourceEstimator {
+	return &maxEstimator{}
+}
+
+// NewPercentileEstimator returns a new percentileEstimator that uses provided percentiles.
+func NewPercentileEstimator(percentiles map[model.ResourceName]float64) ResourceEstimator {
+	return &percentileEstimator{percentiles}
+}
+
+// NewStdDevEstimator returns a new stdDevEstimator recommending mean + stdDevs * stddev.
+func NewStdDevEstimator(stdDevs float64) ResourceEstimator {
+	return &stdDevEstimator{stdDevs}
+}
+
+// NewMarginEstimator returns a new marginEstimator recommending peak * margin.
+func NewMarginEstimator(margin float64) ResourceEstimator {
+	return &marginEstimator{margin}
+}
+
+// Simple implementation of the ResourceEstimator interface. It returns the
+// peak usage observed so far.
+type maxEstimator struct{}
+
+func (e *maxEstimator) GetResourceEstimation(state *model.AggregateContainerState, resource model.ResourceName) model.ResourceAmount {
+	return state.GetPeak(resource)
+}
+
+// Returns specific percentiles of the usage distribution, falling back to
+// the peak when no samples were recorded in the histogram.
+type percentileEstimator struct {
+	percentiles map[model.ResourceName]float64
+}
+
+func (e *percentileEstimator) GetResourceEstimation(state *model.AggregateContainerState, resource model.ResourceName) model.ResourceAmount {
+	usage := state.GetHistogram(resource)
+	if usage == nil || usage.IsEmpty() {
+		return state.GetPeak(resource)
+	}
+	return model.ResourceAmountFromFloat(usage.Percentile(e.percentiles[resource]))
+}
+
+// Returns the mean usage plus a number of standard deviations, falling back to
+// the peak when no samples were recorded in the histogram.
+type stdDevEstimator struct {
+	stdDevs float64
+}
+
+func (e *stdDevEstimator) GetResourceEstimation(state *model.AggregateContainerState, resource model.ResourceName) model.ResourceAmount {
+	usage := state.GetHistogram(resource)
+	if usage == nil || usage.IsEmpty() {
+		return state.GetPeak(resource)
+	}
+	return model.ResourceAmountFromFloat(usage.Mean() + e.stdDevs*usage.StdDev())
+}
+
+// Returns the peak usage multiplied by a margin.
+type marginEstimator struct {
+	margin float64
+}
+
+func (e *marginEstimator) GetResourceEstimation(state *model.AggregateContainerState, resource model.ResourceName) model.ResourceAmount {
+	return model.ResourceAmountFromFloat(float64(state.GetPeak(resource)) * e.margin)
+}
+
+// Returns a non-negative real number that heuristically measures how much
+// confidence the history aggregated in the AggregateContainerState provides.
+// For a workload producing a steady stream of samples over N days at the rate
+// of one sample per SampleInterval, the confidence is N.
+// This is used to widen the bounds of recommendations based on little data.
+func getConfidence(s *model.AggregateContainerState) float64 {
+	if s.TotalSamplesCount == 0 || model.SampleInterval <= 0 {
+		return 0
+	}
+	day := float64(time.Hour * 24)
+	// Distance between the first and the last observed sample time, measured in days.
+	lifespanInDays := float64(s.LastSampleStart.Sub(s.FirstSampleStart)) / day
+	// Total count of samples normalized such that it equals the number of days for
+	// frequency of one sample per SampleInterval.
+	samplesAmount := float64(s.TotalSamplesCount) * float64(model.SampleInterval) / day
+	return math.Min(lifespanInDays, samplesAmount)
+}
+
+// Scales the estimated amount by a multiplier that depends on the confidence:
+//
+//	amount * min(1 + multiplier / confidence, maxBoundFactor)^exponent
+//
+// The more confident the recommendation is, the closer the result is to the
+// original amount.
+func scaleByConfidence(amount model.ResourceAmount, confidence, multiplier, exponent float64) model.ResourceAmount {
+	if confidence <= 0 {
+		confidence = minConfidence
+	}
+	factor := math.Min(1.+multiplier/confidence, maxBoundFactor)
+	return model.ResourceAmountFromFloat(float64(amount) * math.Pow(factor, exponent))
+}
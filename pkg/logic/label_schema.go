@@ -0,0 +1,76 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+)
+
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// labelMatcher matches a PromQL label matcher such as name!="POD", the value
+// is a double-quoted string with backslash escapes.
+const labelMatcher = `[a-zA-Z_][a-zA-Z0-9_]*\s*(=~|!~|!=|=)\s*"([^"\\]|\\.)*"`
+
+// selectorRE matches a comma-separated list of label matchers, which may be empty.
+var selectorRE = regexp.MustCompile(`^\s*(` + labelMatcher + `(\s*,\s*` + labelMatcher + `)*\s*,?\s*)?$`)
+
+// MergeLabelSchema returns the global label schema overridden by the fields set in the application schema.
+func MergeLabelSchema(global v1alpha1.LabelSchema, override *v1alpha1.LabelSchema) *v1alpha1.LabelSchema {
+	merged := global
+	if override == nil {
+		return &merged
+	}
+	if len(override.Application) != 0 {
+		merged.Application = override.Application
+	}
+	if len(override.Container) != 0 {
+		merged.Container = override.Container
+	}
+	if len(override.Instance) != 0 {
+		merged.Instance = override.Instance
+	}
+	if len(override.Selector) != 0 {
+		merged.Selector = override.Selector
+	}
+	return &merged
+}
+
+// ValidateLabelSchema checks that the labels of the schema are set and are
+// valid Prometheus label names, and that the selector is a list of label
+// matchers.
+func ValidateLabelSchema(schema *v1alpha1.LabelSchema) error {
+	labels := map[string]string{"application": schema.Application, "container": schema.Container}
+	if len(schema.Instance) == 0 {
+		return fmt.Errorf("instance labels cannot be empty")
+	}
+	for i, label := range schema.Instance {
+		labels[fmt.Sprintf("instance[%d]", i)] = label
+	}
+	for field, label := range labels {
+		if !labelNameRE.MatchString(label) {
+			return fmt.Errorf("%s: invalid label name %q", field, label)
+		}
+	}
+	if !selectorRE.MatchString(schema.Selector) {
+		return fmt.Errorf("selector: %q is not a comma-separated list of label matchers", schema.Selector)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+)
+
+func TestValidateLabelSchemaSelector(t *testing.T) {
+	for _, c := range []struct {
+		selector string
+		valid    bool
+	}{
+		{selector: "", valid: true},
+		{selector: `container!="POD"`, valid: true},
+		{selector: `pod_name=~"^.*$",container_name!="POD",image!="",name=~"^k8s_.*"`, valid: true},
+		{selector: ` container != "POD" , image!~"a\"b", `, valid: true},
+		{selector: `container!="POD"}`, valid: false},
+		{selector: `container!="POD"} or up{job=""`, valid: false},
+		{selector: `container="POD`, valid: false},
+		{selector: `container==POD`, valid: false},
+		{selector: `,`, valid: false},
+	} {
+		schema := &v1alpha1.LabelSchema{
+			Application: "app",
+			Container:   "container",
+			Instance:    []string{"pod"},
+			Selector:    c.selector,
+		}
+		if err := ValidateLabelSchema(schema); (err == nil) != c.valid {
+			t.Errorf("%s: got error %v, want valid %v", c.selector, err, c.valid)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+	"github.com/angao/recommender/pkg/model"
+)
+
+const (
+	// defaultStdDevs is used by the stddev policy when k is not set.
+	defaultStdDevs = 2.0
+	// defaultMargin is used by the margin policy when the margin is not set.
+	defaultMargin = 1.2
+	// defaultRequestPercentile is the usage percentile recommended as
+	// requests when the request percentile is not set.
+	defaultRequestPercentile = 0.9
+)
+
+// requestResources are the resources requests are recommended for.
+var requestResources = []model.ResourceName{model.ResourceCPU, model.ResourceMemory}
+
+// defaultPercentiles are the usage percentiles recommended for resources
+// which are not listed in the percentile policy.
+var defaultPercentiles = map[model.ResourceName]float64{
+	model.ResourceCPU:               0.95,
+	model.ResourceMemory:            0.99,
+	model.ResourceDiskReadIO:        0.95,
+	model.ResourceDiskWriteIO:       0.95,
+	model.ResourceNetworkReceiveIO:  0.95,
+	model.ResourceNetworkTransmitIO: 0.95,
+}
+
+// PolicyFactory creates the ResourceEstimator implementing a recommendation
+// policy with the given parameters.
+type PolicyFactory func(policy *v1alpha1.RecommendationPolicy) (ResourceEstimator, error)
+
+var (
+	policiesLock sync.RWMutex
+	policies     = make(map[string]PolicyFactory)
+)
+
+func init() {
+	RegisterPolicy(v1alpha1.PolicyMax, newMaxPolicy)
+	RegisterPolicy(v1alpha1.PolicyPercentile, newPercentilePolicy)
+	RegisterPolicy(v1alpha1.PolicyStdDev, newStdDevPolicy)
+	RegisterPolicy(v1alpha1.PolicyMargin, newMarginPolicy)
+}
+
+// RegisterPolicy makes a recommendation policy available by the provided name.
+// If RegisterPolicy is called twice with the same name, the latter factory wins.
+func RegisterPolicy(name string, factory PolicyFactory) {
+	policiesLock.Lock()
+	defer policiesLock.Unlock()
+	policies[name] = factory
+}
+
+// Policies returns the sorted names of all registered policies.
+func Policies() []string {
+	policiesLock.RLock()
+	defer policiesLock.RUnlock()
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewEstimator returns the ResourceEstimator implementing the given policy.
+func NewEstimator(policy *v1alpha1.RecommendationPolicy) (ResourceEstimator, error) {
+	policiesLock.RLock()
+	factory, ok := policies[policy.Name]
+	policiesLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown policy %q, must be one of %v", policy.Name, Policies())
+	}
+	return factory(policy)
+}
+
+// policyEstimators are the estimators deriving the recommendations of a policy.
+type policyEstimators struct {
+	// limit estimates the target of every resource.
+	limit ResourceEstimator
+	// request estimates the requests, unless the QoS class is Guaranteed.
+	request  ResourceEstimator
+	qosClass string
+}
+
+func newPolicyEstimators(policy *v1alpha1.RecommendationPolicy) (*policyEstimators, error) {
+	limit, err := NewEstimator(policy)
+	if err != nil {
+		return nil, err
+	}
+	requestPercentile := policy.RequestPercentile
+	if requestPercentile == 0 {
+		requestPercentile = defaultRequestPercentile
+	}
+	if requestPercentile < 0 || requestPercentile > 1 {
+		return nil, fmt.Errorf("request percentile must be in (0, 1]: %v", requestPercentile)
+	}
+	qosClass := policy.QoSClass
+	if len(qosClass) == 0 {
+		qosClass = v1alpha1.QoSClassBurstable
+	}
+	if qosClass != v1alpha1.QoSClassBurstable && qosClass != v1alpha1.QoSClassGuaranteed {
+		return nil, fmt.Errorf("unknown QoS class %q, must be %s or %s", qosClass, v1alpha1.QoSClassBurstable, v1alpha1.QoSClassGuaranteed)
+	}
+	percentiles := make(map[model.ResourceName]float64)
+	for _, resource := range requestResources {
+		percentiles[resource] = requestPercentile
+	}
+	return &policyEstimators{
+		limit:    limit,
+		request:  NewPercentileEstimator(percentiles),
+		qosClass: qosClass,
+	}, nil
+}
+
+// ValidatePolicy checks that the policy is registered and its parameters are valid.
+func ValidatePolicy(policy *v1alpha1.RecommendationPolicy) error {
+	_, err := newPolicyEstimators(policy)
+	return err
+}
+
+// MergePolicy returns the global policy overridden by the fields set in the application policy.
+func MergePolicy(global v1alpha1.RecommendationPolicy, override *v1alpha1.RecommendationPolicy) *v1alpha1.RecommendationPolicy {
+	merged := global
+	if override == nil {
+		return &merged
+	}
+	if len(override.Name) != 0 {
+		merged.Name = override.Name
+	}
+	if len(override.Percentiles) != 0 {
+		merged.Percentiles = make(map[string]float64)
+		for resource, percentile := range global.Percentiles {
+			merged.Percentiles[resource] = percentile
+		}
+		for resource, percentile := range override.Percentiles {
+			merged.Percentiles[resource] = percentile
+		}
+	}
+	if override.StdDevs != 0 {
+		merged.StdDevs = override.StdDevs
+	}
+	if override.Margin != 0 {
+		merged.Margin = override.Margin
+	}
+	if override.RequestPercentile != 0 {
+		merged.RequestPercentile = override.RequestPercentile
+	}
+	if len(override.QoSClass) != 0 {
+		merged.QoSClass = override.QoSClass
+	}
+	return &merged
+}
+
+func newMaxPolicy(policy *v1alpha1.RecommendationPolicy) (ResourceEstimator, error) {
+	return NewMaxEstimator(), nil
+}
+
+func newPercentilePolicy(policy *v1alpha1.RecommendationPolicy) (ResourceEstimator, error) {
+	percentiles := make(map[model.ResourceName]float64)
+	for resource, percentile := range defaultPercentiles {
+		percentiles[resource] = percentile
+	}
+	for resource, percentile := range policy.Percentiles {
+		if !model.IsValidResourceName(model.ResourceName(resource)) {
+			return nil, fmt.Errorf("unknown resource %q in percentiles", resource)
+		}
+		if percentile <= 0 || percentile > 1 {
+			return nil, fmt.Errorf("percentile of %s must be in (0, 1]: %v", resource, percentile)
+		}
+		percentiles[model.ResourceName(resource)] = percentile
+	}
+	return NewPercentileEstimator(percentiles), nil
+}
+
+func newStdDevPolicy(policy *v1alpha1.RecommendationPolicy) (ResourceEstimator, error) {
+	stdDevs := policy.StdDevs
+	if stdDevs == 0 {
+		stdDevs = defaultStdDevs
+	}
+	if stdDevs < 0 {
+		return nil, fmt.Errorf("stddevs cannot be negative: %v", stdDevs)
+	}
+	return NewStdDevEstimator(stdDevs), nil
+}
+
+func newMarginPolicy(policy *v1alpha1.RecommendationPolicy) (ResourceEstimator, error) {
+	margin := policy.Margin
+	if margin == 0 {
+		margin = defaultMargin
+	}
+	if margin < 0 {
+		return nil, fmt.Errorf("margin cannot be negative: %v", margin)
+	}
+	return NewMarginEstimator(margin), nil
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+	"github.com/angao/recommender/pkg/model"
+)
+
+func newTestState() *model.AggregateContainerState {
+	state := model.NewAggregateContainerState()
+	now := time.Now()
+	for i := 1; i <= 100; i++ {
+		state.AddSample(model.ResourceCPU, model.ResourceAmount(i*10), now)
+	}
+	return state
+}
+
+func TestPolicies(t *testing.T) {
+	state := newTestState()
+	cases := []struct {
+		policy   v1alpha1.RecommendationPolicy
+		min, max model.ResourceAmount
+	}{
+		{v1alpha1.RecommendationPolicy{Name: v1alpha1.PolicyMax}, 1000, 1000},
+		{v1alpha1.RecommendationPolicy{Name: v1alpha1.PolicyPercentile, Percentiles: map[string]float64{"cpu": 0.5}}, 500, 530},
+		{v1alpha1.RecommendationPolicy{Name: v1alpha1.PolicyStdDev, StdDevs: 1}, 780, 820},
+		{v1alpha1.RecommendationPolicy{Name: v1alpha1.PolicyMargin, Margin: 1.5}, 1500, 1500},
+	}
+	for _, c := range cases {
+		estimator, err := NewEstimator(&c.policy)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.policy.Name, err)
+		}
+		got := estimator.GetResourceEstimation(state, model.ResourceCPU)
+		if got < c.min || got > c.max {
+			t.Errorf("%s: got %v, want in [%v, %v]", c.policy.Name, got, c.min, c.max)
+		}
+	}
+}
+
+func TestValidatePolicy(t *testing.T) {
+	invalid := []v1alpha1.RecommendationPolicy{
+		{Name: "unknown"},
+		{Name: v1alpha1.PolicyPercentile, Percentiles: map[string]float64{"cpu": 1.5}},
+		{Name: v1alpha1.PolicyPercentile, Percentiles: map[string]float64{"gpu": 0.9}},
+		{Name: v1alpha1.PolicyStdDev, StdDevs: -1},
+		{Name: v1alpha1.PolicyMax, RequestPercentile: 2},
+		{Name: v1alpha1.PolicyMax, QoSClass: "BestEffort"},
+	}
+	for _, policy := range invalid {
+		if err := ValidatePolicy(&policy); err == nil {
+			t.Errorf("expected %+v to be invalid", policy)
+		}
+	}
+}
+
+func TestMergePolicy(t *testing.T) {
+	global := v1alpha1.RecommendationPolicy{
+		Name:        v1alpha1.PolicyPercentile,
+		Percentiles: map[string]float64{"cpu": 0.9, "memory": 0.99},
+		StdDevs:     2,
+	}
+	merged := MergePolicy(global, &v1alpha1.RecommendationPolicy{Percentiles: map[string]float64{"cpu": 0.5}})
+	if merged.Name != v1alpha1.PolicyPercentile || merged.StdDevs != 2 {
+		t.Errorf("unset fields should fall back to the global policy: %+v", merged)
+	}
+	if merged.Percentiles["cpu"] != 0.5 || merged.Percentiles["memory"] != 0.99 {
+		t.Errorf("unexpected percentiles: %v", merged.Percentiles)
+	}
+	if global.Percentiles["cpu"] != 0.9 {
+		t.Errorf("global policy must not be modified")
+	}
+}
+
+func TestConfidence(t *testing.T) {
+	state := model.NewAggregateContainerState()
+	if got := getConfidence(state); got != 0 {
+		t.Errorf("empty state: got confidence %v, want 0", got)
+	}
+	// Two days of samples taken every SampleInterval.
+	start := time.Now()
+	for ts := start; !ts.After(start.Add(48 * time.Hour)); ts = ts.Add(model.SampleInterval) {
+		state.AddSample(model.ResourceCPU, 100, ts)
+	}
+	confidence := getConfidence(state)
+	if confidence < 1.99 || confidence > 2.01 {
+		t.Errorf("got confidence %v, want 2", confidence)
+	}
+	if got := scaleByConfidence(1000, confidence, lowerBoundMultiplier, lowerBoundExponent); got < 660 || got > 670 {
+		t.Errorf("lower bound: got %v, want ~666", got)
+	}
+	if got := scaleByConfidence(1000, confidence, upperBoundMultiplier, upperBoundExponent); got < 1495 || got > 1505 {
+		t.Errorf("upper bound: got %v, want ~1500", got)
+	}
+	// Without confidence the bounds are capped at maxBoundFactor times the target.
+	if got := scaleByConfidence(1000, 0, upperBoundMultiplier, upperBoundExponent); got != 10000 {
+		t.Errorf("capped upper bound: got %v, want 10000", got)
+	}
+	if got := scaleByConfidence(1000, 0, lowerBoundMultiplier, lowerBoundExponent); got != 100 {
+		t.Errorf("capped lower bound: got %v, want 100", got)
+	}
+}
+
+func TestRequests(t *testing.T) {
+	state := newTestState()
+	for _, c := range []struct {
+		qosClass string
+		want     model.ResourceAmount
+	}{
+		{v1alpha1.QoSClassBurstable, 500},
+		{v1alpha1.QoSClassGuaranteed, 1000},
+	} {
+		estimators, err := newPolicyEstimators(&v1alpha1.RecommendationPolicy{
+			Name:              v1alpha1.PolicyMax,
+			RequestPercentile: 0.5,
+			QoSClass:          c.qosClass,
+		})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.qosClass, err)
+		}
+		recommender := &resourceRecommender{estimators: estimators}
+		vpa := model.NewVpa(model.ApplicationID{Name: "app"})
+		vpa.SetAggregationContainerState(map[model.AggregateStateKey]*model.AggregateContainerState{
+			model.NewAggregateStateKey(model.ApplicationContainer{ContainerID: model.ContainerID{ApplicationID: vpa.ID, ContainerName: "web"}, Name: "web-0"}): state,
+		})
+		resources := recommender.GetRecommendedResources(vpa)
+		if len(resources) != 1 {
+			t.Fatalf("%s: got %d recommendations, want 1", c.qosClass, len(resources))
+		}
+		target, request := resources[0].Target[model.ResourceCPU], resources[0].Request[model.ResourceCPU]
+		if target != 1000 {
+			t.Errorf("%s: got target %v, want 1000", c.qosClass, target)
+		}
+		if request < c.want || request > c.want*21/20 {
+			t.Errorf("%s: got request %v, want ~%v", c.qosClass, request, c.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+	"github.com/angao/recommender/pkg/model"
+)
+
+// ValidateProjection checks that the multiplier is positive and the exponents
+// are non-negative and given for known resources.
+func ValidateProjection(multiplier float64, exponents map[string]float64) error {
+	if multiplier <= 0 {
+		return fmt.Errorf("multiplier must be positive, got %v", multiplier)
+	}
+	for resource, exponent := range exponents {
+		if !model.IsValidResourceName(model.ResourceName(resource)) {
+			return fmt.Errorf("unknown resource %s", resource)
+		}
+		if exponent < 0 {
+			return fmt.Errorf("exponent of %s must not be negative, got %v", resource, exponent)
+		}
+	}
+	return nil
+}
+
+// ProjectResources scales the recommendation of a container for the traffic
+// multiplied by multiplier. Every resource grows by multiplier^exponent,
+// with an exponent of 1 for the resources missing from exponents, e.g. an
+// exponent of 0 keeps the memory of a cache which doesn't grow with traffic.
+// The projected amounts are rounded up and capped by the resource policy of
+// the application, which already added its margin to the recommendation.
+// The usage peaks are scaled by the same factor but not capped, so the report
+// of the projected timeframe compares them to the baseline. The confidence is
+// kept.
+func ProjectResources(resource *v1alpha1.ContainerResource, multiplier float64, exponents map[string]float64, policy *v1alpha1.ResourcePolicy) *v1alpha1.ContainerResource {
+	projected := &v1alpha1.ContainerResource{
+		Name:                 resource.Name,
+		ApplicationID:        resource.ApplicationID,
+		UsagePeaks:           resource.UsagePeaks,
+		RecommendedResources: resource.RecommendedResources,
+	}
+	p := &projected.UsagePeaks
+	peaks := map[model.ResourceName]*int64{
+		model.ResourceCPU:               &p.CPUPeak,
+		model.ResourceMemory:            &p.MemoryPeak,
+		model.ResourceDiskReadIO:        &p.DiskReadIOPeak,
+		model.ResourceDiskWriteIO:       &p.DiskWriteIOPeak,
+		model.ResourceNetworkReceiveIO:  &p.NetworkReceiveIOPeak,
+		model.ResourceNetworkTransmitIO: &p.NetworkTransmitIOPeak,
+	}
+	r := &projected.RecommendedResources
+	for name, amounts := range map[model.ResourceName][]*int64{
+		model.ResourceCPU:               {&r.CPULimit, &r.CPURequest, &r.CPULowerBound, &r.CPUUpperBound},
+		model.ResourceMemory:            {&r.MemoryLimit, &r.MemoryRequest, &r.MemoryLowerBound, &r.MemoryUpperBound},
+		model.ResourceDiskReadIO:        {&r.DiskReadIOLimit, &r.DiskReadIOLowerBound, &r.DiskReadIOUpperBound},
+		model.ResourceDiskWriteIO:       {&r.DiskWriteIOLimit, &r.DiskWriteIOLowerBound, &r.DiskWriteIOUpperBound},
+		model.ResourceNetworkReceiveIO:  {&r.NetworkReceiveIOLimit, &r.NetworkReceiveIOLowerBound, &r.NetworkReceiveIOUpperBound},
+		model.ResourceNetworkTransmitIO: {&r.NetworkTransmitIOLimit, &r.NetworkTransmitIOLowerBound, &r.NetworkTransmitIOUpperBound},
+	} {
+		exponent, ok := exponents[string(name)]
+		if !ok {
+			exponent = 1
+		}
+		factor := math.Pow(multiplier, exponent)
+		peak := peaks[name]
+		*peak = int64(math.Ceil(float64(*peak) * factor))
+		bounds := GetResourceBounds(resource.Name, name, policy)
+		for _, amount := range amounts {
+			scaled := model.ResourceAmount(math.Ceil(float64(*amount) * factor))
+			*amount = int64(CapResourceAmount(scaled, bounds))
+		}
+	}
+	return projected
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+)
+
+func TestProjectResources(t *testing.T) {
+	resource := &v1alpha1.ContainerResource{Name: "app", ApplicationID: 1}
+	resource.CPULimit = 1000
+	resource.CPURequest = 500
+	resource.MemoryLimit = 1000
+	resource.DiskReadIOUpperBound = 10
+	resource.CPUPeak = 800
+	resource.MemoryPeak = 900
+	resource.Confidence = 2
+
+	projected := ProjectResources(resource, 4, map[string]float64{"memory": 0.5, "disk-read-io": 0}, nil)
+	if projected.CPULimit != 4000 || projected.CPURequest != 2000 {
+		t.Errorf("cpu should scale linearly, got limit %d and request %d", projected.CPULimit, projected.CPURequest)
+	}
+	if projected.MemoryLimit != 2000 {
+		t.Errorf("memory should scale by the square root, got %d", projected.MemoryLimit)
+	}
+	if projected.DiskReadIOUpperBound != 10 {
+		t.Errorf("disk read io should not scale, got %d", projected.DiskReadIOUpperBound)
+	}
+	if projected.CPUPeak != 3200 || projected.MemoryPeak != 1800 {
+		t.Errorf("peaks should scale like the limits, got cpu %d and memory %d", projected.CPUPeak, projected.MemoryPeak)
+	}
+	if projected.Confidence != 2 || projected.Name != "app" || projected.ApplicationID != 1 {
+		t.Errorf("unexpected projection %+v", projected)
+	}
+	if resource.CPULimit != 1000 {
+		t.Errorf("source recommendation should not change")
+	}
+}
+
+func TestProjectResourcesPolicy(t *testing.T) {
+	resource := &v1alpha1.ContainerResource{Name: "app"}
+	resource.CPULimit = 1000
+	resource.CPURequest = 500
+	resource.MemoryLimit = 1000
+	resource.DiskReadIOLimit = 10
+	policy := &v1alpha1.ResourcePolicy{
+		ContainerPolicies: []v1alpha1.ContainerResourcePolicy{
+			{
+				ContainerName: "app",
+				Resources: map[string]v1alpha1.ResourceBounds{
+					"cpu": {MaxAllowed: 3000, Margin: 50},
+				},
+			},
+			{
+				ContainerName: v1alpha1.DefaultContainerResourcePolicy,
+				Resources: map[string]v1alpha1.ResourceBounds{
+					"disk-read-io": {Off: true},
+					"memory":       {MinAllowed: 800},
+				},
+			},
+		},
+	}
+
+	projected := ProjectResources(resource, 4, map[string]float64{"memory": 0}, policy)
+	if projected.CPULimit != 3000 {
+		t.Errorf("cpu limit should be capped at the max allowed, got %d", projected.CPULimit)
+	}
+	if projected.CPURequest != 2000 {
+		t.Errorf("cpu request should scale without another margin, got %d", projected.CPURequest)
+	}
+	if projected.DiskReadIOLimit != 0 {
+		t.Errorf("opted out disk read io should be 0, got %d", projected.DiskReadIOLimit)
+	}
+
+	projected = ProjectResources(resource, 0.5, nil, policy)
+	if projected.MemoryLimit != 800 {
+		t.Errorf("memory should be raised to the min allowed, got %d", projected.MemoryLimit)
+	}
+}
+
+func TestValidateProjection(t *testing.T) {
+	if err := ValidateProjection(3, map[string]float64{"cpu": 1, "memory": 0.8}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, c := range []struct {
+		multiplier float64
+		exponents  map[string]float64
+	}{
+		{0, nil},
+		{-1, nil},
+		{2, map[string]float64{"gpu": 1}},
+		{2, map[string]float64{"cpu": -1}},
+	} {
+		if err := ValidateProjection(c.multiplier, c.exponents); err == nil {
+			t.Errorf("expected an error for %v and %v", c.multiplier, c.exponents)
+		}
+	}
+}
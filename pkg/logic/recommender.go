@@ -17,7 +17,26 @@ limitations under the License.
 package logic
 
 import (
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
 	"github.com/angao/recommender/pkg/model"
+	"github.com/angao/recommender/pkg/utils"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// With the confidence of one day, the lower bound is half and the
+	// upper bound twice the target. Both approach the target as the
+	// confidence grows.
+	lowerBoundMultiplier = 1.0
+	lowerBoundExponent   = -1.0
+	upperBoundMultiplier = 1.0
+	upperBoundExponent   = 1.0
+	// minConfidence is used in place of a zero confidence to keep the bounds finite.
+	minConfidence = 0.01
+	// maxBoundFactor caps the distance of the bounds from the target, so that
+	// the bounds of a container with few samples stay within 10 times of it.
+	maxBoundFactor = 10.0
 )
 
 // PodResourceRecommender computes resource recommendation for a Vpa object.
@@ -26,29 +45,79 @@ type ResourceRecommender interface {
 }
 
 type resourceRecommender struct {
+	// Global policy, used by applications which don't override it.
+	policy     v1alpha1.RecommendationPolicy
+	estimators *policyEstimators
 }
 
 // Returns recommended resources for a given Vpa object.
 func (r *resourceRecommender) GetRecommendedResources(vpa *model.Vpa) []model.RecommendedContainerResources {
 	containerNameToAggregateStateMap := vpa.AggregateStateByContainerName()
 	recommendedContainerResources := make([]model.RecommendedContainerResources, 0)
+	estimators := r.getEstimators(vpa)
 
 	for containerName, aggregatedContainerState := range containerNameToAggregateStateMap {
+		confidence := getConfidence(aggregatedContainerState)
 		containerResource := model.RecommendedContainerResources{
-			ContainerName:          containerName,
-			CPULimit:               aggregatedContainerState.AggregateCPU,
-			MemoryLimit:            aggregatedContainerState.AggregateMemory,
-			DiskReadIOLimit:        aggregatedContainerState.AggregateDiskReadIO,
-			DiskWriteIOLimit:       aggregatedContainerState.AggregateDiskWriteIO,
-			NetworkReceiveIOLimit:  aggregatedContainerState.AggregateNetworkReceiveIO,
-			NetworkTransmitIOLimit: aggregatedContainerState.AggregateNetworkTransmitIO,
+			ContainerName: containerName,
+			Target:        make(model.Resources),
+			Request:       make(model.Resources),
+			LowerBound:    make(model.Resources),
+			UpperBound:    make(model.Resources),
+			Confidence:    confidence,
+			Peak:          make(model.Resources),
+		}
+		for _, resource := range model.ResourceNames {
+			// Estimates the resource, derives the bounds from the confidence and
+			// applies the resource policy of the container to all of them.
+			bounds := GetResourceBounds(containerName, resource, vpa.ResourcePolicy)
+			target := estimators.limit.GetResourceEstimation(aggregatedContainerState, resource)
+			lowerBound := scaleByConfidence(target, confidence, lowerBoundMultiplier, lowerBoundExponent)
+			upperBound := scaleByConfidence(target, confidence, upperBoundMultiplier, upperBoundExponent)
+			containerResource.Target[resource] = ApplyResourceBounds(target, bounds)
+			containerResource.LowerBound[resource] = ApplyResourceBounds(lowerBound, bounds)
+			containerResource.UpperBound[resource] = ApplyResourceBounds(upperBound, bounds)
+			containerResource.Peak[resource] = aggregatedContainerState.GetPeak(resource)
+		}
+		for _, resource := range requestResources {
+			target := containerResource.Target[resource]
+			if estimators.qosClass == v1alpha1.QoSClassGuaranteed {
+				containerResource.Request[resource] = target
+				continue
+			}
+			bounds := GetResourceBounds(containerName, resource, vpa.ResourcePolicy)
+			request := ApplyResourceBounds(estimators.request.GetResourceEstimation(aggregatedContainerState, resource), bounds)
+			if request > target {
+				request = target
+			}
+			containerResource.Request[resource] = request
 		}
 		recommendedContainerResources = append(recommendedContainerResources, containerResource)
 	}
 	return recommendedContainerResources
 }
 
+// getEstimators returns the estimators of the policy chosen for the Vpa's application.
+func (r *resourceRecommender) getEstimators(vpa *model.Vpa) *policyEstimators {
+	if vpa.Policy == nil {
+		return r.estimators
+	}
+	estimators, err := newPolicyEstimators(MergePolicy(r.policy, vpa.Policy))
+	if err != nil {
+		glog.Errorf("Invalid policy of %s, using the global one. Reason: %+v", vpa.ID.Name, err)
+		return r.estimators
+	}
+	return estimators
+}
+
 // CreatePodResourceRecommender returns the primary recommender.
-func CreateResourceRecommender() ResourceRecommender {
-	return &resourceRecommender{}
+func CreateResourceRecommender(config utils.RecommenderConfig) (ResourceRecommender, error) {
+	estimators, err := newPolicyEstimators(&config.RecommendationPolicy)
+	if err != nil {
+		return nil, err
+	}
+	return &resourceRecommender{
+		policy:     config.RecommendationPolicy,
+		estimators: estimators,
+	}, nil
 }
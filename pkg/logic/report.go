@@ -0,0 +1,100 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"sort"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+)
+
+// BuildTimeframeReport compares the peak usage every container's timeframe
+// recommendation is computed from with the one of its baseline
+// recommendation, and lists the top applications by their largest ratio.
+// The peaks are compared as the limits include margins, bounds and the
+// update policy, which would hide the growth.
+func BuildTimeframeReport(name string, timeframeResources, baselineResources []*v1alpha1.ApplicationResource, top int) *v1alpha1.TimeframeReport {
+	baselines := make(map[string]*v1alpha1.ContainerResource)
+	for _, applicationResource := range baselineResources {
+		for _, resource := range applicationResource.ContainerResource {
+			baselines[applicationResource.Name+"/"+resource.Name] = resource
+		}
+	}
+
+	report := &v1alpha1.TimeframeReport{
+		Timeframe:    name,
+		Applications: make([]*v1alpha1.ApplicationReport, 0),
+		TopGrowth:    make([]*v1alpha1.ApplicationGrowth, 0),
+	}
+	for _, applicationResource := range timeframeResources {
+		if len(applicationResource.ContainerResource) == 0 {
+			continue
+		}
+		applicationReport := &v1alpha1.ApplicationReport{
+			Name:       applicationResource.Name,
+			Containers: make([]*v1alpha1.ContainerReport, 0),
+		}
+		var growth *v1alpha1.ApplicationGrowth
+		for _, resource := range applicationResource.ContainerResource {
+			containerReport := &v1alpha1.ContainerReport{
+				Name:      resource.Name,
+				Timeframe: resource.Peaks(),
+				Ratios:    make(map[string]float64),
+			}
+			if baseline, ok := baselines[applicationResource.Name+"/"+resource.Name]; ok {
+				containerReport.Baseline = baseline.Peaks()
+				for resourceName, peak := range containerReport.Timeframe {
+					baselinePeak := containerReport.Baseline[resourceName]
+					if baselinePeak == 0 {
+						continue
+					}
+					ratio := float64(peak) / float64(baselinePeak)
+					containerReport.Ratios[resourceName] = ratio
+					if growth == nil || ratio > growth.Ratio || (ratio == growth.Ratio && resourceName < growth.Resource) {
+						growth = &v1alpha1.ApplicationGrowth{
+							Name:      applicationResource.Name,
+							Container: resource.Name,
+							Resource:  resourceName,
+							Ratio:     ratio,
+						}
+					}
+				}
+			}
+			applicationReport.Containers = append(applicationReport.Containers, containerReport)
+		}
+		sort.Slice(applicationReport.Containers, func(i, j int) bool {
+			return applicationReport.Containers[i].Name < applicationReport.Containers[j].Name
+		})
+		report.Applications = append(report.Applications, applicationReport)
+		if growth != nil {
+			report.TopGrowth = append(report.TopGrowth, growth)
+		}
+	}
+	sort.Slice(report.Applications, func(i, j int) bool {
+		return report.Applications[i].Name < report.Applications[j].Name
+	})
+	sort.Slice(report.TopGrowth, func(i, j int) bool {
+		if report.TopGrowth[i].Ratio != report.TopGrowth[j].Ratio {
+			return report.TopGrowth[i].Ratio > report.TopGrowth[j].Ratio
+		}
+		return report.TopGrowth[i].Name < report.TopGrowth[j].Name
+	})
+	if len(report.TopGrowth) > top {
+		report.TopGrowth = report.TopGrowth[:top]
+	}
+	return report
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+)
+
+func containerWithPeaks(name string, cpu, memory int64) *v1alpha1.ContainerResource {
+	resource := &v1alpha1.ContainerResource{Name: name}
+	resource.CPUPeak, resource.MemoryPeak = cpu, memory
+	// The limits are capped and must not be compared.
+	resource.CPULimit, resource.MemoryLimit = 1000, 1000
+	return resource
+}
+
+func applicationWith(name string, containers ...*v1alpha1.ContainerResource) *v1alpha1.ApplicationResource {
+	return &v1alpha1.ApplicationResource{Name: name, ContainerResource: containers}
+}
+
+func TestBuildTimeframeReport(t *testing.T) {
+	baseline := []*v1alpha1.ApplicationResource{
+		applicationWith("web", containerWithPeaks("app", 1000, 2000)),
+		applicationWith("cart", containerWithPeaks("app", 500, 0)),
+		applicationWith("search", containerWithPeaks("app", 1000, 1000)),
+	}
+	timeframe := []*v1alpha1.ApplicationResource{
+		applicationWith("web", containerWithPeaks("app", 3000, 3000)),
+		applicationWith("cart", containerWithPeaks("app", 1000, 4000)),
+		applicationWith("search", containerWithPeaks("app", 1500, 1000)),
+		applicationWith("batch", containerWithPeaks("job", 100, 100)),
+		applicationWith("idle"),
+	}
+	for _, c := range []struct {
+		name         string
+		top          int
+		ratios       map[string]map[string]float64
+		noBaseline   []string
+		topGrowth    []string
+		applications int
+	}{
+		{
+			name: "ratios",
+			top:  10,
+			ratios: map[string]map[string]float64{
+				"web":    {"cpu": 3, "memory": 1.5},
+				"search": {"cpu": 1.5, "memory": 1},
+				// The zero memory baseline is left out.
+				"cart": {"cpu": 2},
+			},
+			noBaseline:   []string{"batch"},
+			topGrowth:    []string{"web", "cart", "search"},
+			applications: 4,
+		},
+		{
+			name:         "top",
+			top:          2,
+			topGrowth:    []string{"web", "cart"},
+			applications: 4,
+		},
+		{
+			name:         "no top",
+			top:          0,
+			applications: 4,
+		},
+	} {
+		report := BuildTimeframeReport("double11", timeframe, baseline, c.top)
+		if len(report.Applications) != c.applications {
+			t.Errorf("%s: got %d applications, want %d", c.name, len(report.Applications), c.applications)
+		}
+		for _, application := range report.Applications {
+			container := application.Containers[0]
+			for resource, want := range c.ratios[application.Name] {
+				if got, ok := container.Ratios[resource]; !ok || got != want {
+					t.Errorf("%s: %s %s ratio: got %v, want %v", c.name, application.Name, resource, got, want)
+				}
+			}
+			if want, ok := c.ratios[application.Name]; ok && len(container.Ratios) != len(want) {
+				t.Errorf("%s: %s ratios: got %v, want %v", c.name, application.Name, container.Ratios, want)
+			}
+			for _, name := range c.noBaseline {
+				if application.Name == name && (container.Baseline != nil || len(container.Ratios) != 0) {
+					t.Errorf("%s: %s without baseline: got baseline %v ratios %v", c.name, name, container.Baseline, container.Ratios)
+				}
+			}
+		}
+		if len(report.TopGrowth) != len(c.topGrowth) {
+			t.Fatalf("%s: got top growth %+v, want %v", c.name, report.TopGrowth, c.topGrowth)
+		}
+		for i, name := range c.topGrowth {
+			if report.TopGrowth[i].Name != name {
+				t.Errorf("%s: top growth %d: got %s, want %s", c.name, i, report.TopGrowth[i].Name, name)
+			}
+		}
+	}
+}
+
+func TestBuildProjectedTimeframeReport(t *testing.T) {
+	baseline := containerWithPeaks("app", 1000, 2000)
+	policy := &v1alpha1.ResourcePolicy{
+		ContainerPolicies: []v1alpha1.ContainerResourcePolicy{
+			{
+				ContainerName: "app",
+				Resources: map[string]v1alpha1.ResourceBounds{
+					"cpu": {MaxAllowed: 1500},
+				},
+			},
+		},
+	}
+	projected := ProjectResources(baseline, 2, map[string]float64{"memory": 0}, policy)
+
+	report := BuildTimeframeReport("double11", []*v1alpha1.ApplicationResource{applicationWith("web", projected)},
+		[]*v1alpha1.ApplicationResource{applicationWith("web", baseline)}, 10)
+	ratios := report.Applications[0].Containers[0].Ratios
+	// The peaks are not capped by the policy, unlike the cpu limit.
+	if ratios["cpu"] != 2 || ratios["memory"] != 1 {
+		t.Errorf("got ratios %v, want cpu 2 and memory 1", ratios)
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+)
+
+// MergeUpdatePolicy returns the global update policy overridden by the fields set in the application policy.
+func MergeUpdatePolicy(global v1alpha1.UpdatePolicy, override *v1alpha1.UpdatePolicy) *v1alpha1.UpdatePolicy {
+	merged := global
+	if override == nil {
+		return &merged
+	}
+	if len(override.Mode) != 0 {
+		merged.Mode = override.Mode
+	}
+	if override.Threshold != 0 {
+		merged.Threshold = override.Threshold
+	}
+	if override.Runs != 0 {
+		merged.Runs = override.Runs
+	}
+	return &merged
+}
+
+// ValidateUpdatePolicy checks the mode and the hysteresis parameters of the policy.
+func ValidateUpdatePolicy(policy *v1alpha1.UpdatePolicy) error {
+	switch policy.Mode {
+	case v1alpha1.UpdateModeRatchet, v1alpha1.UpdateModeReplace, v1alpha1.UpdateModeHysteresis:
+	default:
+		return fmt.Errorf("unknown update mode %q, must be one of %s, %s or %s",
+			policy.Mode, v1alpha1.UpdateModeRatchet, v1alpha1.UpdateModeReplace, v1alpha1.UpdateModeHysteresis)
+	}
+	if policy.Threshold < 0 {
+		return fmt.Errorf("threshold cannot be negative: %v", policy.Threshold)
+	}
+	if policy.Runs < 0 {
+		return fmt.Errorf("runs cannot be negative: %v", policy.Runs)
+	}
+	return nil
+}
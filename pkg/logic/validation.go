@@ -0,0 +1,210 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+	"github.com/angao/recommender/pkg/utils"
+	"github.com/angao/recommender/pkg/utils/cron"
+)
+
+// TimeframeCoverage returns the period of usage a timeframe is computed
+// from: the window of a one-off timeframe, or the history ending at now for
+// a recurring one.
+func TimeframeCoverage(timeframe *v1alpha1.Timeframe, history time.Duration, now time.Time) (time.Time, time.Time) {
+	if timeframe.IsRecurring() {
+		return now.Add(-history), now
+	}
+	return timeframe.Start, timeframe.End
+}
+
+// ValidateTimeframeWindow rejects a one-off timeframe of zero length.
+func ValidateTimeframeWindow(timeframe *v1alpha1.Timeframe) []*v1alpha1.TimeframeIssue {
+	issues := make([]*v1alpha1.TimeframeIssue, 0)
+	if !timeframe.IsRecurring() && timeframe.Start.Equal(timeframe.End) {
+		issues = append(issues, &v1alpha1.TimeframeIssue{
+			Level:   v1alpha1.IssueError,
+			Message: "the window is empty, start equals end",
+		})
+	}
+	return issues
+}
+
+// ValidateTimeframeRetention compares the coverage of a timeframe with the
+// earliest sample Prometheus retains, zero if it has none. A coverage ended
+// before the earliest sample is rejected, one starting before it is warned
+// about. Nothing is checked for a coverage starting in the future.
+func ValidateTimeframeRetention(start, end, earliest, now time.Time) []*v1alpha1.TimeframeIssue {
+	issues := make([]*v1alpha1.TimeframeIssue, 0)
+	switch {
+	case !start.Before(now):
+	case earliest.IsZero():
+		issues = append(issues, &v1alpha1.TimeframeIssue{
+			Level:   v1alpha1.IssueWarning,
+			Message: fmt.Sprintf("Prometheus has no samples since %s", start.Format(time.RFC3339)),
+		})
+	case !end.After(earliest):
+		issues = append(issues, &v1alpha1.TimeframeIssue{
+			Level:   v1alpha1.IssueError,
+			Message: fmt.Sprintf("the window ends before the earliest sample Prometheus retains at %s", earliest.Format(time.RFC3339)),
+		})
+	case start.Before(earliest):
+		issues = append(issues, &v1alpha1.TimeframeIssue{
+			Level:   v1alpha1.IssueWarning,
+			Message: fmt.Sprintf("the window starts before the earliest sample Prometheus retains at %s", earliest.Format(time.RFC3339)),
+		})
+	}
+	return issues
+}
+
+// ValidateTimeframeOverlaps compares a timeframe with the other timeframes
+// sharing an application with it. A timeframe with the same window, or the
+// same schedule and duration, is a duplicate and rejected; an overlapping
+// window is warned about, including an occurrence of a recurring timeframe
+// within overlapHorizon from now overlapping a one-off window or an
+// occurrence of another schedule. Timeframes switched off or projected are
+// not computed and ignored.
+func ValidateTimeframeOverlaps(timeframe *v1alpha1.Timeframe, others []*v1alpha1.Timeframe, applications []*v1alpha1.Application, now time.Time) []*v1alpha1.TimeframeIssue {
+	issues := make([]*v1alpha1.TimeframeIssue, 0)
+	for _, other := range others {
+		if other.ID == timeframe.ID || other.Name == timeframe.Name || other.Status == v1alpha1.StatusOff || other.Status == v1alpha1.StatusProjected {
+			continue
+		}
+		if !sharesScope(timeframe, other, applications) {
+			continue
+		}
+		switch {
+		case timeframe.IsRecurring() && other.IsRecurring() && timeframe.Schedule == other.Schedule && timeframe.Duration == other.Duration:
+			issues = append(issues, &v1alpha1.TimeframeIssue{
+				Level:     v1alpha1.IssueError,
+				Timeframe: other.Name,
+				Message:   fmt.Sprintf("duplicates the schedule of %s", other.Name),
+			})
+		case timeframe.IsRecurring() || other.IsRecurring():
+			if at := recurringOverlap(timeframe, other, now); !at.IsZero() {
+				issues = append(issues, &v1alpha1.TimeframeIssue{
+					Level:     v1alpha1.IssueWarning,
+					Timeframe: other.Name,
+					Message:   fmt.Sprintf("an occurrence at %s overlaps %s", at.Format(time.RFC3339), other.Name),
+				})
+			}
+		case timeframe.Start.Equal(other.Start) && timeframe.End.Equal(other.End):
+			issues = append(issues, &v1alpha1.TimeframeIssue{
+				Level:     v1alpha1.IssueError,
+				Timeframe: other.Name,
+				Message:   fmt.Sprintf("duplicates the window of %s", other.Name),
+			})
+		case timeframe.Start.Before(other.End) && other.Start.Before(timeframe.End):
+			issues = append(issues, &v1alpha1.TimeframeIssue{
+				Level:     v1alpha1.IssueWarning,
+				Timeframe: other.Name,
+				Message:   fmt.Sprintf("overlaps the window of %s", other.Name),
+			})
+		}
+	}
+	return issues
+}
+
+const (
+	// overlapHorizon bounds the occurrences of two schedules compared.
+	overlapHorizon = 366 * 24 * time.Hour
+	// maxOverlapOccurrences bounds the occurrences of a schedule compared
+	// with another one, e.g. for a schedule firing every minute.
+	maxOverlapOccurrences = 1000
+)
+
+// recurringOverlap returns the start of the first occurrence of a recurring
+// timeframe overlapping the other timeframe, zero if none does. At least one
+// of them is recurring. The occurrences of two recurring timeframes are
+// compared from now on, within overlapHorizon.
+func recurringOverlap(a, b *v1alpha1.Timeframe, now time.Time) time.Time {
+	if !a.IsRecurring() {
+		return firstOccurrence(b, a.Start, a.End)
+	}
+	if !b.IsRecurring() {
+		return firstOccurrence(a, b.Start, b.End)
+	}
+	schedule, duration, err := parseRecurrence(a)
+	if err != nil {
+		return time.Time{}
+	}
+	end := now.Add(overlapHorizon)
+	t := now.In(a.Location()).Add(-duration)
+	for i := 0; i < maxOverlapOccurrences; i++ {
+		if t = schedule.Next(t); t.IsZero() || t.After(end) {
+			break
+		}
+		if at := firstOccurrence(b, t, t.Add(duration)); !at.IsZero() {
+			return at
+		}
+	}
+	return time.Time{}
+}
+
+// firstOccurrence returns the start of the first occurrence of the recurring
+// timeframe overlapping the period from start to end, zero if none does.
+func firstOccurrence(timeframe *v1alpha1.Timeframe, start, end time.Time) time.Time {
+	schedule, duration, err := parseRecurrence(timeframe)
+	if err != nil {
+		return time.Time{}
+	}
+	// The schedule fires in the time zone of the timeframe.
+	t := schedule.Next(start.In(timeframe.Location()).Add(-duration))
+	if t.IsZero() || !t.Before(end) {
+		return time.Time{}
+	}
+	return t
+}
+
+func parseRecurrence(timeframe *v1alpha1.Timeframe) (*cron.Schedule, time.Duration, error) {
+	schedule, err := cron.Parse(timeframe.Schedule)
+	if err != nil {
+		return nil, 0, err
+	}
+	duration, err := utils.ParseDuration(timeframe.Duration)
+	if err != nil {
+		return nil, 0, err
+	}
+	return schedule, duration, nil
+}
+
+// sharesScope returns true if an application is in the scope of both
+// timeframes, or both include every application.
+func sharesScope(a, b *v1alpha1.Timeframe, applications []*v1alpha1.Application) bool {
+	if a.IncludesAll() && b.IncludesAll() {
+		return true
+	}
+	for _, application := range applications {
+		if a.Includes(application) && b.Includes(application) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasIssueErrors returns true if one of the issues rejects the timeframe.
+func HasIssueErrors(issues []*v1alpha1.TimeframeIssue) bool {
+	for _, issue := range issues {
+		if issue.Level == v1alpha1.IssueError {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+)
+
+func levels(issues []*v1alpha1.TimeframeIssue) []string {
+	levels := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		levels = append(levels, issue.Level+":"+issue.Timeframe)
+	}
+	return levels
+}
+
+func TestValidateTimeframeOverlaps(t *testing.T) {
+	start := time.Date(2018, 11, 10, 23, 0, 0, 0, time.UTC)
+	applications := []*v1alpha1.Application{
+		{Name: "web", Labels: map[string]string{"team": "shop"}},
+		{Name: "batch", Labels: map[string]string{"team": "data"}},
+	}
+	others := []*v1alpha1.Timeframe{
+		{ID: 1, Name: "same", Start: start, End: start.Add(2 * time.Hour), Status: v1alpha1.StatusSucceeded},
+		{ID: 2, Name: "overlap", Start: start.Add(time.Hour), End: start.Add(3 * time.Hour), Status: v1alpha1.StatusScheduled},
+		{ID: 3, Name: "adjacent", Start: start.Add(2 * time.Hour), End: start.Add(4 * time.Hour), Status: v1alpha1.StatusScheduled},
+		{ID: 4, Name: "off", Start: start, End: start.Add(2 * time.Hour), Status: v1alpha1.StatusOff},
+		{ID: 5, Name: "data", Start: start, End: start.Add(2 * time.Hour), Applications: []string{"batch"}},
+		{ID: 6, Name: "weekly", Schedule: "0 9 * * 1", Duration: "2h"},
+	}
+
+	timeframe := &v1alpha1.Timeframe{Name: "double11", Start: start, End: start.Add(2 * time.Hour), Selector: map[string]string{"team": "shop"}}
+	got := levels(ValidateTimeframeOverlaps(timeframe, others, applications, start))
+	want := []string{"error:same", "warning:overlap"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("one-off: got %v, want %v", got, want)
+	}
+
+	// Updating a timeframe doesn't compare it with itself.
+	timeframe = &v1alpha1.Timeframe{ID: 6, Name: "weekly", Schedule: "0 9 * * 1", Duration: "2h"}
+	if got := levels(ValidateTimeframeOverlaps(timeframe, others, applications, start)); len(got) != 0 {
+		t.Errorf("update: got %v, want none", got)
+	}
+	timeframe = &v1alpha1.Timeframe{Name: "monday", Schedule: "0 9 * * 1", Duration: "2h", Applications: []string{"web"}}
+	if got := levels(ValidateTimeframeOverlaps(timeframe, others, applications, start)); len(got) != 1 || got[0] != "error:weekly" {
+		t.Errorf("recurring: got %v, want [error:weekly]", got)
+	}
+
+	// 2018-11-12 is a Monday.
+	monday := time.Date(2018, 11, 12, 10, 0, 0, 0, time.Local)
+	others = []*v1alpha1.Timeframe{
+		{ID: 1, Name: "weekly", Schedule: "0 9 * * 1", Duration: "2h"},
+		{ID: 2, Name: "launch", Start: monday, End: monday.Add(time.Hour)},
+		{ID: 3, Name: "evening", Start: monday.Add(2 * time.Hour), End: monday.Add(3 * time.Hour)},
+	}
+	// 2019-04-01 is the next first day of a month on a Monday.
+	timeframe = &v1alpha1.Timeframe{Name: "monthly", Schedule: "30 9 1 * *", Duration: "1h"}
+	if got := levels(ValidateTimeframeOverlaps(timeframe, others, applications, start)); len(got) != 1 || got[0] != "warning:weekly" {
+		t.Errorf("schedules: got %v, want [warning:weekly]", got)
+	}
+	timeframe = &v1alpha1.Timeframe{Name: "daily", Schedule: "0 9 * * *", Duration: "1h30m"}
+	got = levels(ValidateTimeframeOverlaps(timeframe, others, applications, start))
+	want = []string{"warning:weekly", "warning:launch"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("recurring and one-off: got %v, want %v", got, want)
+	}
+}
+
+func TestValidateTimeframeRetention(t *testing.T) {
+	now := time.Date(2018, 11, 20, 0, 0, 0, 0, time.UTC)
+	earliest := now.AddDate(0, 0, -15)
+	for _, c := range []struct {
+		start, end time.Time
+		earliest   time.Time
+		want       string
+	}{
+		{now.AddDate(0, 0, -10), now.AddDate(0, 0, -9), earliest, ""},
+		{now.AddDate(0, 0, -20), now.AddDate(0, 0, -10), earliest, v1alpha1.IssueWarning},
+		{now.AddDate(0, 0, -20), now.AddDate(0, 0, -19), earliest, v1alpha1.IssueError},
+		{now.AddDate(0, 0, -20), now.AddDate(0, 0, -19), time.Time{}, v1alpha1.IssueWarning},
+		{now.Add(time.Hour), now.Add(2 * time.Hour), time.Time{}, ""},
+	} {
+		issues := ValidateTimeframeRetention(c.start, c.end, c.earliest, now)
+		got := ""
+		if len(issues) > 0 {
+			got = issues[0].Level
+		}
+		if got != c.want {
+			t.Errorf("%v - %v with earliest %v: got %q, want %q", c.start, c.end, c.earliest, got, c.want)
+		}
+	}
+}
+
+func TestValidateTimeframeWindow(t *testing.T) {
+	start := time.Date(2018, 11, 10, 23, 0, 0, 0, time.UTC)
+	if issues := ValidateTimeframeWindow(&v1alpha1.Timeframe{Start: start, End: start}); !HasIssueErrors(issues) {
+		t.Errorf("expected an empty window to be rejected")
+	}
+	if issues := ValidateTimeframeWindow(&v1alpha1.Timeframe{Schedule: "@daily", Duration: "1h"}); len(issues) != 0 {
+		t.Errorf("unexpected issues for a recurring timeframe: %v", issues)
+	}
+}
@@ -16,49 +16,268 @@ limitations under the License.
 
 package model
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+	"github.com/angao/recommender/pkg/utils/histogram"
+)
+
+var (
+	// HistogramDecayHalfLife is the amount of time it takes a historical
+	// usage sample to lose half of its weight.
+	HistogramDecayHalfLife = time.Hour * 24
+	// SampleInterval is the expected interval between two usage samples of
+	// a container, i.e. the resolution of the metrics queries.
+	SampleInterval = time.Minute * 5
+	// CPUHistogramOptions are options to be used by histograms that store
+	// CPU measures expressed in millicores.
+	CPUHistogramOptions = mustExponentialHistogramOptions(1e6, 10, "CPU")
+	// MemoryHistogramOptions are options to be used by histograms that
+	// store memory measures expressed in bytes.
+	MemoryHistogramOptions = mustExponentialHistogramOptions(1e12, 1e7, "memory")
+	// DiskIOHistogramOptions are options to be used by histograms that
+	// store disk operations per second.
+	DiskIOHistogramOptions = mustExponentialHistogramOptions(1e6, 1, "disk io")
+	// NetworkIOHistogramOptions are options to be used by histograms that
+	// store network bytes per second.
+	NetworkIOHistogramOptions = mustExponentialHistogramOptions(1e11, 1e3, "network io")
+)
+
+const (
+	// The ratio between the sizes of two consecutive histogram buckets, i.e.
+	// every bucket is 5% larger than the previous one.
+	histogramBucketSizeGrowth = 0.05
+	// Minimal weight of a histogram bucket to be considered non-empty.
+	histogramEpsilon = 0.0001
+	// Weight of a single usage sample.
+	sampleWeight = 1.0
+	// Length of the windows the peaks are kept for, so that a peak expires
+	// once its window leaves the history.
+	peakWindow = time.Hour * 24
+)
+
+func mustExponentialHistogramOptions(maxValue, firstBucketSize float64, resource string) histogram.HistogramOptions {
+	options, err := histogram.NewExponentialHistogramOptions(maxValue, firstBucketSize, 1.+histogramBucketSizeGrowth, histogramEpsilon)
+	if err != nil {
+		panic("Invalid " + resource + " histogram options")
+	}
+	return options
+}
+
 // ContainerNameToAggregateStateMap maps a container name to AggregateContainerState
 // that aggregates state of containers with that name.
 type ContainerNameToAggregateStateMap map[string]*AggregateContainerState
 
 // AggregateContainerState holds input signals aggregated from a set of containers.
 // It can be used as an input to compute the recommendation.
-// The CPU and memory distributions use decaying histograms by default
+// The resource distributions use decaying histograms by default
 // (see NewAggregateContainerState()).
 // Implements ContainerStateAggregator interface.
 type AggregateContainerState struct {
+	// Peak usage of every resource observed so far.
 	AggregateCPU               ResourceAmount
 	AggregateMemory            ResourceAmount
 	AggregateDiskReadIO        ResourceAmount
 	AggregateDiskWriteIO       ResourceAmount
 	AggregateNetworkReceiveIO  ResourceAmount
 	AggregateNetworkTransmitIO ResourceAmount
+	// Distribution of usage samples of every resource.
+	AggregateCPUUsage               histogram.Histogram
+	AggregateMemoryUsage            histogram.Histogram
+	AggregateDiskReadIOUsage        histogram.Histogram
+	AggregateDiskWriteIOUsage       histogram.Histogram
+	AggregateNetworkReceiveIOUsage  histogram.Histogram
+	AggregateNetworkTransmitIOUsage histogram.Histogram
+	// Peak usage of every resource within each peakWindow, keyed by the
+	// Unix time the window starts at. The peaks above are the highest of them.
+	WindowPeaks map[ResourceName]map[int64]ResourceAmount
+	// Note: first/last sample timestamps and the total number of samples
+	// are only based on CPU usage samples.
+	FirstSampleStart  time.Time
+	LastSampleStart   time.Time
+	TotalSamplesCount int
+}
+
+// addWindowPeak records the amount as the peak of the resource within the
+// window starting at the given Unix time, if it is higher than the current one.
+func (a *AggregateContainerState) addWindowPeak(resource ResourceName, window int64, amount ResourceAmount) {
+	peaks, ok := a.WindowPeaks[resource]
+	if !ok {
+		peaks = make(map[int64]ResourceAmount)
+		a.WindowPeaks[resource] = peaks
+	}
+	if peak, ok := peaks[window]; !ok || peak < amount {
+		peaks[window] = amount
+	}
+}
+
+// ExpirePeaks drops the peaks of the windows which ended before since, and
+// lowers the peak of every resource to the highest of the remaining windows.
+func (a *AggregateContainerState) ExpirePeaks(since time.Time) {
+	for _, resource := range ResourceNames {
+		peak, _ := a.resource(resource)
+		*peak = 0
+		for window, amount := range a.WindowPeaks[resource] {
+			if !time.Unix(window, 0).Add(peakWindow).After(since) {
+				delete(a.WindowPeaks[resource], window)
+				continue
+			}
+			if *peak < amount {
+				*peak = amount
+			}
+		}
+	}
+}
+
+// resource returns the peak and the usage histogram kept for the given resource.
+func (a *AggregateContainerState) resource(resource ResourceName) (*ResourceAmount, histogram.Histogram) {
+	switch resource {
+	case ResourceCPU:
+		return &a.AggregateCPU, a.AggregateCPUUsage
+	case ResourceMemory:
+		return &a.AggregateMemory, a.AggregateMemoryUsage
+	case ResourceDiskReadIO:
+		return &a.AggregateDiskReadIO, a.AggregateDiskReadIOUsage
+	case ResourceDiskWriteIO:
+		return &a.AggregateDiskWriteIO, a.AggregateDiskWriteIOUsage
+	case ResourceNetworkReceiveIO:
+		return &a.AggregateNetworkReceiveIO, a.AggregateNetworkReceiveIOUsage
+	case ResourceNetworkTransmitIO:
+		return &a.AggregateNetworkTransmitIO, a.AggregateNetworkTransmitIOUsage
+	}
+	return nil, nil
+}
+
+// AddSample records a usage sample of the given resource taken at the given time.
+func (a *AggregateContainerState) AddSample(resource ResourceName, amount ResourceAmount, timestamp time.Time) {
+	peak, usage := a.resource(resource)
+	if peak == nil {
+		return
+	}
+	if *peak < amount {
+		*peak = amount
+	}
+	a.addWindowPeak(resource, timestamp.Truncate(peakWindow).Unix(), amount)
+	usage.AddSample(float64(amount), sampleWeight, timestamp)
+	if resource == ResourceCPU {
+		if a.FirstSampleStart.IsZero() || timestamp.Before(a.FirstSampleStart) {
+			a.FirstSampleStart = timestamp
+		}
+		if timestamp.After(a.LastSampleStart) {
+			a.LastSampleStart = timestamp
+		}
+		a.TotalSamplesCount++
+	}
+}
+
+// GetPeak returns the highest usage of the given resource observed so far.
+func (a *AggregateContainerState) GetPeak(resource ResourceName) ResourceAmount {
+	peak, _ := a.resource(resource)
+	if peak == nil {
+		return 0
+	}
+	return *peak
+}
+
+// GetHistogram returns the usage distribution of the given resource.
+func (a *AggregateContainerState) GetHistogram(resource ResourceName) histogram.Histogram {
+	_, usage := a.resource(resource)
+	return usage
 }
 
 // MergeContainerState merges two AggregateContainerStates.
 func (a *AggregateContainerState) MergeContainerState(other *AggregateContainerState) {
-	if a.AggregateCPU < other.AggregateCPU {
-		a.AggregateCPU = other.AggregateCPU
+	for _, resource := range ResourceNames {
+		peak, usage := a.resource(resource)
+		otherPeak, otherUsage := other.resource(resource)
+		if *peak < *otherPeak {
+			*peak = *otherPeak
+		}
+		if otherUsage != nil {
+			usage.Merge(otherUsage)
+		}
+		for window, amount := range other.WindowPeaks[resource] {
+			a.addWindowPeak(resource, window, amount)
+		}
 	}
-	if a.AggregateMemory < other.AggregateMemory {
-		a.AggregateMemory = other.AggregateMemory
+	if a.FirstSampleStart.IsZero() ||
+		(!other.FirstSampleStart.IsZero() && other.FirstSampleStart.Before(a.FirstSampleStart)) {
+		a.FirstSampleStart = other.FirstSampleStart
 	}
-	if a.AggregateDiskReadIO < other.AggregateDiskReadIO {
-		a.AggregateDiskReadIO = other.AggregateDiskReadIO
+	if other.LastSampleStart.After(a.LastSampleStart) {
+		a.LastSampleStart = other.LastSampleStart
 	}
-	if a.AggregateDiskWriteIO < other.AggregateDiskWriteIO {
-		a.AggregateDiskWriteIO = other.AggregateDiskWriteIO
+	a.TotalSamplesCount += other.TotalSamplesCount
+}
+
+// SaveToCheckpoint serializes the AggregateContainerState.
+func (a *AggregateContainerState) SaveToCheckpoint() (*v1alpha1.ContainerStateCheckpoint, error) {
+	checkpoint := &v1alpha1.ContainerStateCheckpoint{
+		Peaks:             make(map[string]int64),
+		WindowPeaks:       make(map[string]map[int64]int64),
+		Histograms:        make(map[string]*v1alpha1.HistogramCheckpoint),
+		FirstSampleStart:  a.FirstSampleStart,
+		LastSampleStart:   a.LastSampleStart,
+		TotalSamplesCount: a.TotalSamplesCount,
 	}
-	if a.AggregateNetworkReceiveIO < other.AggregateNetworkReceiveIO {
-		a.AggregateNetworkReceiveIO = other.AggregateNetworkReceiveIO
+	for _, resource := range ResourceNames {
+		peak, usage := a.resource(resource)
+		histogramCheckpoint, err := usage.SaveToCheckpoint()
+		if err != nil {
+			return nil, fmt.Errorf("cannot save %s histogram: %v", resource, err)
+		}
+		checkpoint.Peaks[string(resource)] = int64(*peak)
+		windowPeaks := make(map[int64]int64, len(a.WindowPeaks[resource]))
+		for window, amount := range a.WindowPeaks[resource] {
+			windowPeaks[window] = int64(amount)
+		}
+		checkpoint.WindowPeaks[string(resource)] = windowPeaks
+		checkpoint.Histograms[string(resource)] = histogramCheckpoint
 	}
-	if a.AggregateNetworkTransmitIO < other.AggregateNetworkTransmitIO {
-		a.AggregateNetworkTransmitIO = other.AggregateNetworkTransmitIO
+	return checkpoint, nil
+}
+
+// LoadFromCheckpoint merges the state stored in the checkpoint into the AggregateContainerState.
+// The peak of a checkpoint saved without window peaks is kept as the peak of
+// the window of its last sample.
+func (a *AggregateContainerState) LoadFromCheckpoint(checkpoint *v1alpha1.ContainerStateCheckpoint) error {
+	other := NewAggregateContainerState()
+	for _, resource := range ResourceNames {
+		peak, usage := other.resource(resource)
+		*peak = ResourceAmount(checkpoint.Peaks[string(resource)])
+		if windowPeaks, ok := checkpoint.WindowPeaks[string(resource)]; ok {
+			for window, amount := range windowPeaks {
+				other.addWindowPeak(resource, window, ResourceAmount(amount))
+			}
+		} else if *peak > 0 {
+			other.addWindowPeak(resource, checkpoint.LastSampleStart.Truncate(peakWindow).Unix(), *peak)
+		}
+		if histogramCheckpoint, ok := checkpoint.Histograms[string(resource)]; ok {
+			if err := usage.LoadFromCheckpoint(histogramCheckpoint); err != nil {
+				return fmt.Errorf("cannot load %s histogram: %v", resource, err)
+			}
+		}
 	}
+	other.FirstSampleStart = checkpoint.FirstSampleStart
+	other.LastSampleStart = checkpoint.LastSampleStart
+	other.TotalSamplesCount = checkpoint.TotalSamplesCount
+	a.MergeContainerState(other)
+	return nil
 }
 
 // NewAggregateContainerState returns a new, empty AggregateContainerState.
 func NewAggregateContainerState() *AggregateContainerState {
-	return &AggregateContainerState{}
+	return &AggregateContainerState{
+		WindowPeaks:                     make(map[ResourceName]map[int64]ResourceAmount),
+		AggregateCPUUsage:               histogram.NewDecayingHistogram(CPUHistogramOptions, HistogramDecayHalfLife),
+		AggregateMemoryUsage:            histogram.NewDecayingHistogram(MemoryHistogramOptions, HistogramDecayHalfLife),
+		AggregateDiskReadIOUsage:        histogram.NewDecayingHistogram(DiskIOHistogramOptions, HistogramDecayHalfLife),
+		AggregateDiskWriteIOUsage:       histogram.NewDecayingHistogram(DiskIOHistogramOptions, HistogramDecayHalfLife),
+		AggregateNetworkReceiveIOUsage:  histogram.NewDecayingHistogram(NetworkIOHistogramOptions, HistogramDecayHalfLife),
+		AggregateNetworkTransmitIOUsage: histogram.NewDecayingHistogram(NetworkIOHistogramOptions, HistogramDecayHalfLife),
+	}
 }
 
 // AggregateStateByContainerName takes a set of AggregateContainerStates and merge them
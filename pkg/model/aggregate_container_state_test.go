@@ -0,0 +1,55 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpirePeaks(t *testing.T) {
+	day := time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)
+	state := NewAggregateContainerState()
+	state.AddSample(ResourceMemory, 1000, day.Add(time.Hour))
+	state.AddSample(ResourceMemory, 300, day.Add(49*time.Hour))
+	if peak := state.GetPeak(ResourceMemory); peak != 1000 {
+		t.Fatalf("got peak %v, want 1000", peak)
+	}
+
+	// The peaks survive a checkpoint.
+	checkpoint, err := state.SaveToCheckpoint()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	restored := NewAggregateContainerState()
+	if err := restored.LoadFromCheckpoint(checkpoint); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	restored.ExpirePeaks(day.Add(12 * time.Hour))
+	if peak := restored.GetPeak(ResourceMemory); peak != 1000 {
+		t.Errorf("peak of a window within the history: got %v, want 1000", peak)
+	}
+	restored.ExpirePeaks(day.Add(24 * time.Hour))
+	if peak := restored.GetPeak(ResourceMemory); peak != 300 {
+		t.Errorf("peak after its window expired: got %v, want 300", peak)
+	}
+	restored.ExpirePeaks(day.Add(96 * time.Hour))
+	if peak := restored.GetPeak(ResourceMemory); peak != 0 {
+		t.Errorf("peak after all windows expired: got %v, want 0", peak)
+	}
+}
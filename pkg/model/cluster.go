@@ -85,7 +85,10 @@ func (cluster *ClusterState) MakeAggregateStateKey(app *ApplicationID, container
 	}
 }
 
-func (cluster *ClusterState) AddOrUpdateVPA(id ApplicationID) {
+// AddOrUpdateVPA adds the VPA of the application in the cluster, or the one
+// merged over all clusters if the cluster is empty.
+func (cluster *ClusterState) AddOrUpdateVPA(application *v1alpha1.Application, clusterName string) {
+	id := ApplicationID{Name: application.Name, Cluster: clusterName}
 	_, exist := cluster.Vpas[id]
 	if exist {
 		cluster.DeleteVPA(id)
@@ -93,6 +96,8 @@ func (cluster *ClusterState) AddOrUpdateVPA(id ApplicationID) {
 	}
 	if !exist {
 		vpa := NewVpa(id)
+		vpa.Policy = application.Policy
+		vpa.ResourcePolicy = application.ResourcePolicy
 		cluster.Vpas[id] = vpa
 	}
 }
@@ -129,9 +134,16 @@ func (cluster *ClusterState) AddOrUpdateTimeframeVPA(name string) {
 	}
 	if !exist {
 		vpaMap := make(map[ApplicationID]*Vpa)
-		for appName := range cluster.Applications {
+		timeframe := cluster.Timeframes[name]
+		for appName, application := range cluster.Applications {
+			// Only the applications in the scope of the timeframe are queried.
+			if timeframe != nil && !timeframe.Includes(application) {
+				continue
+			}
 			applicationID := ApplicationID{Name: appName}
 			vpa := NewVpa(applicationID)
+			vpa.Policy = application.Policy
+			vpa.ResourcePolicy = application.ResourcePolicy
 			vpaMap[applicationID] = vpa
 		}
 		cluster.TimeframeVpas[name] = vpaMap
@@ -159,6 +171,27 @@ func NewAggregateStateKey(applicationContainer ApplicationContainer) AggregateSt
 	}
 }
 
+// NewCheckpointStateKey returns the AggregateStateKey of the state restored
+// from the checkpoint of the application's container. It never collides with
+// the keys of states read from metrics, which carry the container's name.
+func NewCheckpointStateKey(applicationName, containerName string) AggregateStateKey {
+	return aggregateStateKey{
+		applicationName: applicationName,
+		containerName:   containerName,
+	}
+}
+
+// NewClusterStateKey returns the key of the state read from the cluster in
+// the VPA merged over all clusters, which tells apart the containers of the
+// same name in different clusters.
+func NewClusterStateKey(clusterName string, key AggregateStateKey) AggregateStateKey {
+	return aggregateStateKey{
+		applicationName: key.ApplicationName(),
+		containerName:   key.ContainerName(),
+		name:            clusterName + "/" + key.Name(),
+	}
+}
+
 func (k aggregateStateKey) ApplicationName() string {
 	return k.applicationName
 }
@@ -45,6 +45,26 @@ const (
 	MaxResourceAmount = ResourceAmount(1e14)
 )
 
+// ResourceNames lists every resource monitored by recommender.
+var ResourceNames = []ResourceName{
+	ResourceCPU,
+	ResourceMemory,
+	ResourceDiskReadIO,
+	ResourceDiskWriteIO,
+	ResourceNetworkReceiveIO,
+	ResourceNetworkTransmitIO,
+}
+
+// IsValidResourceName returns true if the resource is monitored by recommender.
+func IsValidResourceName(resource ResourceName) bool {
+	for _, name := range ResourceNames {
+		if name == resource {
+			return true
+		}
+	}
+	return false
+}
+
 // CPUAmountFromCores converts CPU cores to a ResourceAmount.
 func CPUAmountFromCores(cores float64) ResourceAmount {
 	return ResourceAmountFromFloat(cores * 1000.0)
@@ -85,6 +105,9 @@ func ResourceAmountFromFloat(amount float64) ResourceAmount {
 
 type ApplicationID struct {
 	Name string
+	// Cluster is the cluster of a per-cluster VPA, empty for the VPA merged
+	// over all clusters.
+	Cluster string
 }
 
 // ContainerID contains information needed to identify a Container within a cluster.
@@ -16,24 +16,44 @@ limitations under the License.
 
 package model
 
+import (
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+)
+
 // Vpa (Vertical Pod Autoscaler) object is responsible for vertical scaling of
 // Pods matching a given label selector.
 type Vpa struct {
 	ID             ApplicationID
 	Recommendation []RecommendedContainerResources
+	// Policy overrides the global recommendation policy, nil means using the global one.
+	Policy *v1alpha1.RecommendationPolicy
+	// ResourcePolicy adjusts the recommendations of the containers.
+	ResourcePolicy *v1alpha1.ResourcePolicy
 	// All container aggregations that contribute to this VPA.
 	aggregateContainerStates aggregateContainerStatesMap
 }
 
+// RecommendedContainerResources is the recommendation of resources for a
+// single container.
 type RecommendedContainerResources struct {
 	// Name of the container.
-	ContainerName          string
-	CPULimit               ResourceAmount
-	MemoryLimit            ResourceAmount
-	DiskReadIOLimit        ResourceAmount
-	DiskWriteIOLimit       ResourceAmount
-	NetworkReceiveIOLimit  ResourceAmount
-	NetworkTransmitIOLimit ResourceAmount
+	ContainerName string
+	// Recommended amount of resources.
+	Target Resources
+	// Recommended requests of the resources Kubernetes schedules by, which
+	// never exceed the target.
+	Request Resources
+	// Minimum recommended amount of resources. Running the container with
+	// less resources is likely to have significant impact on performance.
+	LowerBound Resources
+	// Maximum recommended amount of resources. Any resources allocated beyond
+	// this value are likely wasted.
+	UpperBound Resources
+	// Confidence is the number of days of usage data the recommendation is
+	// based on, limited by the number of samples collected in that period.
+	Confidence float64
+	// Peak usage of the resources the recommendation is computed from.
+	Peak Resources
 }
 
 // NewVpa returns a new Vpa with a given ID and pod selector. Doesn't set the
@@ -17,11 +17,13 @@ limitations under the License.
 package routines
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
 	"github.com/angao/recommender/pkg/client"
 	"github.com/angao/recommender/pkg/input"
+	"github.com/angao/recommender/pkg/input/prometheus"
 	"github.com/angao/recommender/pkg/logic"
 	"github.com/angao/recommender/pkg/model"
 	"github.com/angao/recommender/pkg/server"
@@ -39,7 +41,10 @@ const (
 // Recommender recommend resources for certain containers, based on utilization periodically got from metrics api.
 type Recommender interface {
 	// RunOnce performs one iteration of recommender duties followed by update of recommendations in VPA objects.
-	RunOnce()
+	// The usage not read when the context is done is left out of the run.
+	RunOnce(ctx context.Context)
+	// RunTimeframes computes only the recommendations of the timeframes which have become due.
+	RunTimeframes(ctx context.Context)
 	// GetClusterState returns ClusterState used by Recommender
 	GetClusterState() *model.ClusterState
 	// GetClusterStateFeeder returns ClusterStateFeeder used by Recommender
@@ -60,16 +65,32 @@ func (r *recommender) GetClusterStateFeeder() input.ClusterStateFeeder {
 	return r.clusterStateFeeder
 }
 
-func (r *recommender) RunOnce() {
+func (r *recommender) RunOnce(ctx context.Context) {
 	glog.V(3).Infof("Recommender Run")
 	r.clusterStateFeeder.LoadApplications()
 	r.clusterStateFeeder.LoadTimeframes()
 	r.clusterStateFeeder.LoadVPAs()
 	r.clusterStateFeeder.LoadTimeframeVPAs()
-	r.clusterStateFeeder.LoadMetrics()
-	r.clusterStateFeeder.LoadTimeframeMetrics()
+	r.clusterStateFeeder.LoadMetrics(ctx)
+	r.clusterStateFeeder.LoadTimeframeMetrics(ctx)
 	r.updateVPAs()
+	r.updateTimeframeVPAs()
 	r.clusterStateFeeder.UpdateResources()
+	r.clusterStateFeeder.UpdateTimeframeResources()
+	r.clusterStateFeeder.SaveCheckpoints()
+}
+
+func (r *recommender) RunTimeframes(ctx context.Context) {
+	glog.V(4).Infof("Recommender Run Timeframes")
+	r.clusterStateFeeder.LoadApplications()
+	r.clusterStateFeeder.LoadTimeframes()
+	if len(r.clusterState.Timeframes) == 0 {
+		return
+	}
+	r.clusterStateFeeder.LoadTimeframeVPAs()
+	r.clusterStateFeeder.LoadTimeframeMetrics(ctx)
+	r.updateTimeframeVPAs()
+	r.clusterStateFeeder.UpdateTimeframeResources()
 }
 
 func (r *recommender) updateVPAs() {
@@ -77,6 +98,9 @@ func (r *recommender) updateVPAs() {
 		resources := r.resourceRecommender.GetRecommendedResources(vpa)
 		vpa.Recommendation = resources
 	}
+}
+
+func (r *recommender) updateTimeframeVPAs() {
 	for _, timeframeVPA := range r.clusterState.TimeframeVpas {
 		for _, vpa := range timeframeVPA {
 			resources := r.resourceRecommender.GetRecommendedResources(vpa)
@@ -89,16 +113,48 @@ func (r *recommender) updateVPAs() {
 // which can be run in order to provide continuous resource recommendations for containers.
 // It requires cluster configuration object and duration between recommender intervals.
 func NewRecommender(globalConfig *utils.GlobalConfig) Recommender {
+	halfLife, err := utils.ParseDuration(globalConfig.RecommenderConfig.HistogramHalfLife)
+	if err != nil {
+		glog.Fatalf("invalid histogram half life: %v", err)
+	}
+	model.HistogramDecayHalfLife = halfLife
+	// Config has been validated, so the step is known to be well formed.
+	model.SampleInterval, _ = utils.ParseDuration(globalConfig.PrometheusConfig.Step)
+
+	resourceRecommender, err := logic.CreateResourceRecommender(globalConfig.RecommenderConfig)
+	if err != nil {
+		glog.Fatalf("invalid recommendation policy: %v", err)
+	}
+	if err := logic.ValidateUpdatePolicy(&globalConfig.RecommenderConfig.UpdatePolicy); err != nil {
+		glog.Fatalf("invalid update policy: %v", err)
+	}
+	// The feeder and the controller share the provider, hence the HTTP client
+	// and the QPS limit, of every cluster.
+	providers := make([]prometheus.Provider, 0)
+	for _, cluster := range globalConfig.MetricSources() {
+		prometheusConfig := cluster.PrometheusConfig
+		if err := logic.ValidateLabelSchema(&prometheusConfig.LabelSchema); err != nil {
+			glog.Fatalf("invalid label schema of cluster %q: %v", cluster.Name, err)
+		}
+		if _, err := prometheus.ParseQueryTemplates(prometheusConfig.Queries); err != nil {
+			glog.Fatalf("invalid query template of cluster %q: %v", cluster.Name, err)
+		}
+		if _, err := prometheus.NewHTTPClient(prometheusConfig); err != nil {
+			glog.Fatalf("invalid prometheus client config of cluster %q: %v", cluster.Name, err)
+		}
+		providers = append(providers, prometheus.NewPrometheusHistoryProvider(prometheusConfig))
+	}
+
 	store := datastore.New(Driver, globalConfig.DatabaseConfig)
 	clusterState := model.NewClusterState()
 	recommender := &recommender{
 		clusterState:        clusterState,
-		clusterStateFeeder:  input.NewClusterStateFeeder(store, globalConfig, clusterState),
-		resourceRecommender: logic.CreateResourceRecommender(),
+		clusterStateFeeder:  input.NewClusterStateFeeder(store, globalConfig, clusterState, providers),
+		resourceRecommender: resourceRecommender,
 	}
 	glog.V(3).Infof("New Recommender created %+v", recommender)
 
-	s := server.NewController(store)
+	s := server.NewController(store, globalConfig, providers)
 	startHTTPServer(s, globalConfig.ExtraConfig.APIPort)
 
 	return recommender
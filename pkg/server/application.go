@@ -23,6 +23,7 @@ import (
 	"strings"
 
 	"github.com/angao/recommender/pkg/apis/v1alpha1"
+	"github.com/angao/recommender/pkg/logic"
 	"github.com/gin-gonic/gin"
 	"github.com/golang/glog"
 )
@@ -55,7 +56,7 @@ func (h *httpController) CreateApplication(c *gin.Context) {
 		return
 	}
 
-	if err := ValidateApplication(application); err != nil {
+	if err := h.validateApplication(application); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
 			"message": err.Error(),
@@ -112,6 +113,62 @@ func (h *httpController) ListApplications(c *gin.Context) {
 	})
 }
 
+func (h *httpController) UpdateApplication(c *gin.Context) {
+	application := new(v1alpha1.Application)
+	if err := c.ShouldBindJSON(application); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := h.validateApplication(application); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	app, err := h.store.GetApplication(application.Name)
+	if err != nil {
+		glog.Errorf("UpdateApplication Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	if app == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    404,
+			"message": fmt.Sprintf("%s not found", application.Name),
+		})
+		return
+	}
+
+	app.Policy = application.Policy
+	app.ResourcePolicy = application.ResourcePolicy
+	app.UpdatePolicy = application.UpdatePolicy
+	app.Labels = application.Labels
+	app.LabelSchema = application.LabelSchema
+	app.Clusters = application.Clusters
+	err = h.store.UpdateApplication(app)
+	if err != nil {
+		glog.Errorf("UpdateApplication Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+	})
+}
+
 func (h *httpController) DeleteApplication(c *gin.Context) {
 	name := c.Param("name")
 	application, err := h.store.GetApplication(name)
@@ -151,3 +208,41 @@ func ValidateApplication(application *v1alpha1.Application) error {
 	}
 	return nil
 }
+
+// validateApplication also checks the application policies, merged with the global ones.
+func (h *httpController) validateApplication(application *v1alpha1.Application) error {
+	if err := ValidateApplication(application); err != nil {
+		return err
+	}
+	if application.Policy != nil {
+		policy := logic.MergePolicy(h.globalConfig.RecommenderConfig.RecommendationPolicy, application.Policy)
+		if err := logic.ValidatePolicy(policy); err != nil {
+			return fmt.Errorf("policy: %v", err)
+		}
+	}
+	if application.ResourcePolicy != nil {
+		if err := logic.ValidateResourcePolicy(application.ResourcePolicy); err != nil {
+			return fmt.Errorf("resource_policy: %v", err)
+		}
+	}
+	if application.UpdatePolicy != nil {
+		policy := logic.MergeUpdatePolicy(h.globalConfig.RecommenderConfig.UpdatePolicy, application.UpdatePolicy)
+		if err := logic.ValidateUpdatePolicy(policy); err != nil {
+			return fmt.Errorf("update_policy: %v", err)
+		}
+	}
+	if application.LabelSchema != nil {
+		for _, cluster := range h.globalConfig.MetricSources() {
+			schema := logic.MergeLabelSchema(cluster.PrometheusConfig.LabelSchema, application.LabelSchema)
+			if err := logic.ValidateLabelSchema(schema); err != nil {
+				return fmt.Errorf("label_schema: %v", err)
+			}
+		}
+	}
+	for _, cluster := range application.Clusters {
+		if !h.globalConfig.HasCluster(cluster) {
+			return fmt.Errorf("clusters: unknown cluster %q", cluster)
+		}
+	}
+	return nil
+}
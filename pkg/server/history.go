@@ -0,0 +1,223 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+)
+
+func (h *httpController) GetResourceHistory(c *gin.Context) {
+	name := c.Param("name")
+	location, err := requestLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	since := time.Time{}
+	if s := c.Query("since"); s != "" {
+		t, err := parseQueryTime("since", s, location)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": err.Error(),
+			})
+			return
+		}
+		since = t
+	}
+	cluster, err := h.requestCluster(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	histories, err := h.store.ListRecommendationHistory(name, cluster, since)
+	if err != nil {
+		glog.Errorf("GetResourceHistory Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	if histories == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": fmt.Sprintf("%s not found", name),
+		})
+		return
+	}
+	localizeHistories(location, histories)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    histories,
+	})
+}
+
+func (h *httpController) GetResourceDiff(c *gin.Context) {
+	name := c.Param("name")
+	location, err := requestLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	from, err := parseQueryTime("from", c.Query("from"), location)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	to := time.Now()
+	if s := c.Query("to"); s != "" {
+		to, err = parseQueryTime("to", s, location)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "from must not be after to",
+		})
+		return
+	}
+
+	cluster, err := h.requestCluster(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	fromHistories, err := h.store.GetRecommendationHistoryAt(name, cluster, from)
+	if err != nil {
+		glog.Errorf("GetResourceDiff Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	if fromHistories == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": fmt.Sprintf("%s not found", name),
+		})
+		return
+	}
+	toHistories, err := h.store.GetRecommendationHistoryAt(name, cluster, to)
+	if err != nil {
+		glog.Errorf("GetResourceDiff Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	localizeHistories(location, fromHistories)
+	localizeHistories(location, toHistories)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    diffRecommendations(fromHistories, toHistories),
+	})
+}
+
+// localizeHistories shows the times of the histories in the location, if it is not nil.
+func localizeHistories(location *time.Location, histories []*v1alpha1.RecommendationHistory) {
+	if location == nil {
+		return
+	}
+	for _, history := range histories {
+		history.Created = history.Created.In(location)
+	}
+}
+
+// diffRecommendations pairs the recommendations of the same container and
+// computes the change of every recommended amount. A container missing on
+// one side is compared with zero amounts.
+func diffRecommendations(from, to []*v1alpha1.RecommendationHistory) []*v1alpha1.RecommendationDiff {
+	diffs := make(map[string]*v1alpha1.RecommendationDiff)
+	names := make([]string, 0)
+	get := func(name string) *v1alpha1.RecommendationDiff {
+		diff, ok := diffs[name]
+		if !ok {
+			diff = &v1alpha1.RecommendationDiff{Name: name}
+			diffs[name] = diff
+			names = append(names, name)
+		}
+		return diff
+	}
+	for _, history := range from {
+		get(history.Name).From = history
+	}
+	for _, history := range to {
+		get(history.Name).To = history
+	}
+
+	sort.Strings(names)
+	result := make([]*v1alpha1.RecommendationDiff, 0, len(names))
+	for _, name := range names {
+		diff := diffs[name]
+		fromValues := new(v1alpha1.RecommendedResources).Values()
+		if diff.From != nil {
+			fromValues = diff.From.Values()
+		}
+		toValues := new(v1alpha1.RecommendedResources).Values()
+		if diff.To != nil {
+			toValues = diff.To.Values()
+		}
+		diff.Changes = make(map[string]*v1alpha1.ResourceChange)
+		for key, fromValue := range fromValues {
+			change := &v1alpha1.ResourceChange{
+				From:  fromValue,
+				To:    toValues[key],
+				Delta: toValues[key] - fromValue,
+			}
+			if fromValue != 0 {
+				change.Ratio = float64(change.Delta) / float64(fromValue) * 100
+			}
+			diff.Changes[key] = change
+		}
+		result = append(result, diff)
+	}
+	return result
+}
@@ -0,0 +1,319 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+	"github.com/angao/recommender/pkg/utils"
+	"github.com/angao/recommender/pkg/utils/ical"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+)
+
+// Actions of the imported timeframes.
+const (
+	ImportCreate    = "create"
+	ImportUpdate    = "update"
+	ImportUnchanged = "unchanged"
+	ImportSkipped   = "skipped"
+)
+
+// maxImportOccurrences bounds the timeframes imported from a recurring event.
+const maxImportOccurrences = 1000
+
+// maxTimeframeName is the length of the name column of t_timeframe.
+const maxTimeframeName = 64
+
+// ImportedTimeframe is a timeframe imported from an event occurrence.
+type ImportedTimeframe struct {
+	Name   string    `json:"name"`
+	UID    string    `json:"uid"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Action string    `json:"action"`
+	Reason string    `json:"reason,omitempty"`
+	// Issues are the warnings of the validation of the timeframe.
+	Issues []*v1alpha1.TimeframeIssue `json:"issues,omitempty"`
+}
+
+// ImportTimeframes creates or updates a one-off timeframe for every occurrence
+// of the events of an iCalendar file. Recurring events are expanded within
+// the from and to query parameters, by default from the history window ago
+// to a year from now. With dry_run=true nothing is written.
+func (h *httpController) ImportTimeframes(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+	status := c.DefaultQuery("status", v1alpha1.StatusOn)
+	if status != v1alpha1.StatusOn && status != v1alpha1.StatusOff {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "status must be 'on' or 'off'",
+		})
+		return
+	}
+	from, to, err := h.importPeriod(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	events, err := ical.Parse(bytes.NewReader(body))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": fmt.Sprintf("invalid calendar: %v", err),
+		})
+		return
+	}
+
+	imported := make([]*ImportedTimeframe, 0)
+	timeframes := make(map[string]*ImportedTimeframe)
+	for _, occurrence := range expandEvents(events, from, to) {
+		if occurrence.Action == ImportSkipped {
+			imported = append(imported, occurrence)
+			continue
+		}
+		if previous, ok := timeframes[occurrence.Name]; ok {
+			occurrence.Action = ImportSkipped
+			occurrence.Reason = fmt.Sprintf("name is already used by the event %s", previous.UID)
+			imported = append(imported, occurrence)
+			continue
+		}
+		timeframes[occurrence.Name] = occurrence
+		if err := h.importTimeframe(c.Request.Context(), occurrence, status, dryRun); err != nil {
+			glog.Errorf("ImportTimeframes Internal Server Error: %#v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": err.Error(),
+			})
+			return
+		}
+		imported = append(imported, occurrence)
+	}
+	if location, _ := requestLocation(c); location != nil {
+		for _, occurrence := range imported {
+			occurrence.Start, occurrence.End = occurrence.Start.In(location), occurrence.End.In(location)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    imported,
+	})
+}
+
+// importPeriod returns the period the events are expanded in.
+func (h *httpController) importPeriod(c *gin.Context) (time.Time, time.Time, error) {
+	history, err := utils.ParseDuration(h.globalConfig.ExtraConfig.History)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	location, err := requestLocation(c)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	now := time.Now()
+	from, to := now.Add(-history), now.AddDate(1, 0, 0)
+	if s := c.Query("from"); s != "" {
+		if from, err = parseQueryTime("from", s, location); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	if s := c.Query("to"); s != "" {
+		if to, err = parseQueryTime("to", s, location); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from cannot be after to")
+	}
+	return from, to, nil
+}
+
+// importTimeframe creates the timeframe of the occurrence, or updates the
+// existing timeframe with the same name, and records the action taken. The
+// timeframe is validated like a created or updated one: it is skipped if it
+// is rejected and the warnings are recorded.
+func (h *httpController) importTimeframe(ctx context.Context, occurrence *ImportedTimeframe, status string, dryRun bool) error {
+	timeframe, err := h.store.GetTimeframe(occurrence.Name)
+	if err != nil {
+		return err
+	}
+	start, end := occurrence.Start.In(time.Local), occurrence.End.In(time.Local)
+	if timeframe == nil {
+		if status == v1alpha1.StatusOn {
+			status = switchedOnStatus(false, end)
+		}
+		timeframe := &v1alpha1.Timeframe{
+			Name:        occurrence.Name,
+			Start:       start,
+			End:         end,
+			Status:      status,
+			Description: fmt.Sprintf("imported from %s", occurrence.UID),
+		}
+		// The timeframe keeps the time zone of the event, floating events and
+		// events in a custom VTIMEZONE are local.
+		if location := occurrence.Start.Location(); location != time.Local {
+			if _, err := time.LoadLocation(location.String()); err == nil {
+				timeframe.TimeZone = location.String()
+			}
+		}
+		if ok, err := h.validateImported(ctx, occurrence, timeframe); !ok || err != nil {
+			return err
+		}
+		occurrence.Action = ImportCreate
+		if dryRun {
+			return nil
+		}
+		return h.store.CreateTimeframe(timeframe)
+	}
+	switch {
+	case timeframe.IsRecurring():
+		occurrence.Action = ImportSkipped
+		occurrence.Reason = "a recurring timeframe has the same name"
+		return nil
+	case timeframe.Status == v1alpha1.StatusProjected:
+		occurrence.Action = ImportSkipped
+		occurrence.Reason = fmt.Sprintf("a timeframe projected from %s has the same name", timeframe.ProjectedFrom)
+		return nil
+	case timeframe.Start.Equal(start) && timeframe.End.Equal(end):
+		occurrence.Action = ImportUnchanged
+		return nil
+	}
+	update := &v1alpha1.Timeframe{
+		ID:    timeframe.ID,
+		Name:  timeframe.Name,
+		Start: start,
+		End:   end,
+	}
+	// The recommendations of the previous period are computed again.
+	if timeframe.Status != v1alpha1.StatusOff {
+		update.Status = switchedOnStatus(false, end)
+	}
+	if ok, err := h.validateImported(ctx, occurrence, update); !ok || err != nil {
+		return err
+	}
+	occurrence.Action = ImportUpdate
+	if dryRun {
+		return nil
+	}
+	return h.store.UpdateTimeframe(update)
+}
+
+// validateImported validates the timeframe of the occurrence. It returns
+// false and skips the occurrence if the timeframe is rejected, and records
+// the warnings otherwise.
+func (h *httpController) validateImported(ctx context.Context, occurrence *ImportedTimeframe, timeframe *v1alpha1.Timeframe) (bool, error) {
+	issues, err := h.validateTimeframe(ctx, timeframe)
+	if err != nil {
+		return false, err
+	}
+	for _, issue := range issues {
+		if issue.Level == v1alpha1.IssueError {
+			occurrence.Action = ImportSkipped
+			occurrence.Reason = issue.Message
+			return false, nil
+		}
+	}
+	if len(issues) != 0 {
+		occurrence.Issues = issues
+	}
+	return true, nil
+}
+
+var nameSeparatorRE = regexp.MustCompile(`\s+`)
+
+// expandEvents returns the occurrences of the events overlapping the period
+// from start to end. An event with a RECURRENCE-ID replaces an occurrence of
+// the recurring event with the same UID and is an occurrence itself, unless
+// it is cancelled. The events which can't be imported are returned once as
+// skipped.
+func expandEvents(events []*ical.Event, start, end time.Time) []*ImportedTimeframe {
+	overrides := make(map[string][]*ical.Event)
+	for _, event := range events {
+		if !event.RecurrenceID.IsZero() {
+			overrides[event.UID] = append(overrides[event.UID], event)
+		}
+	}
+	imported := make([]*ImportedTimeframe, 0)
+	for _, event := range events {
+		if len(event.Skipped) != 0 {
+			timeframe := &ImportedTimeframe{
+				UID:    event.UID,
+				Start:  event.Start,
+				End:    event.End,
+				Action: ImportSkipped,
+				Reason: event.Skipped,
+			}
+			if !event.Start.IsZero() {
+				timeframe.Name = timeframeName(event, event.Start)
+			}
+			imported = append(imported, timeframe)
+			continue
+		}
+		var eventOverrides []*ical.Event
+		if event.RecurrenceID.IsZero() {
+			eventOverrides = overrides[event.UID]
+		}
+		for _, occurrence := range ical.Occurrences(event, eventOverrides, start, end, maxImportOccurrences) {
+			timeframe := &ImportedTimeframe{
+				Name:  timeframeName(event, occurrence.Start),
+				UID:   event.UID,
+				Start: occurrence.Start,
+				End:   occurrence.End,
+			}
+			if !occurrence.End.After(occurrence.Start) {
+				timeframe.Action = ImportSkipped
+				timeframe.Reason = "the event has no duration"
+			}
+			imported = append(imported, timeframe)
+		}
+	}
+	return imported
+}
+
+// timeframeName names the timeframe of an occurrence after the summary of
+// the event, or its UID, and the day the occurrence starts.
+func timeframeName(event *ical.Event, start time.Time) string {
+	name := nameSeparatorRE.ReplaceAllString(strings.TrimSpace(event.Summary), "-")
+	if len(name) == 0 {
+		name = event.UID
+	}
+	suffix := start.Format("-20060102")
+	if runes := []rune(name); len(runes)+len(suffix) > maxTimeframeName {
+		name = string(runes[:maxTimeframeName-len(suffix)])
+	}
+	return name + suffix
+}
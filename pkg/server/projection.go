@@ -0,0 +1,187 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+	"github.com/angao/recommender/pkg/logic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+)
+
+// ProjectionForm describes the projection of a timeframe's recommendations
+// into a new timeframe. Multipliers override the global Multiplier for the
+// named applications, Exponents scale the multipliers per resource.
+type ProjectionForm struct {
+	Name        string             `json:"name"`
+	Multiplier  float64            `json:"multiplier"`
+	Multipliers map[string]float64 `json:"multipliers"`
+	Exponents   map[string]float64 `json:"exponents"`
+	Description string             `json:"description"`
+}
+
+func (h *httpController) ProjectTimeframe(c *gin.Context) {
+	source := c.Param("name")
+	location, err := requestLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	form := new(ProjectionForm)
+	if err := c.ShouldBindJSON(form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	if form.Multiplier == 0 {
+		form.Multiplier = 1
+	}
+	if err := validateProjection(form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	timeframe, err := h.store.GetTimeframe(source)
+	if err != nil {
+		glog.Errorf("ProjectTimeframe Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	if timeframe == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    404,
+			"message": fmt.Sprintf("%s not found", source),
+		})
+		return
+	}
+	frame, err := h.store.GetTimeframe(form.Name)
+	if err != nil {
+		glog.Errorf("ProjectTimeframe Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	if frame != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "timeframe has already exist",
+		})
+		return
+	}
+	applicationResources, err := h.store.ListTimeframeApplicationResource(source)
+	if err != nil {
+		glog.Errorf("ProjectTimeframe Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	applications := make(map[string]bool)
+	for _, applicationResource := range applicationResources {
+		applications[applicationResource.Name] = true
+	}
+	for name := range form.Multipliers {
+		if !applications[name] {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": fmt.Sprintf("application %s not found", name),
+			})
+			return
+		}
+	}
+
+	resources := make([]*v1alpha1.ContainerResource, 0)
+	for _, applicationResource := range applicationResources {
+		multiplier, ok := form.Multipliers[applicationResource.Name]
+		if !ok {
+			multiplier = form.Multiplier
+		}
+		application, err := h.store.GetApplication(applicationResource.Name)
+		if err != nil {
+			glog.Errorf("ProjectTimeframe Internal Server Error: %#v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": err.Error(),
+			})
+			return
+		}
+		var policy *v1alpha1.ResourcePolicy
+		if application != nil {
+			policy = application.ResourcePolicy
+		}
+		for _, resource := range applicationResource.ContainerResource {
+			resources = append(resources, logic.ProjectResources(resource, multiplier, form.Exponents, policy))
+		}
+	}
+	projected := &v1alpha1.Timeframe{
+		Name:          form.Name,
+		Start:         timeframe.Start,
+		End:           timeframe.End,
+		Status:        v1alpha1.StatusProjected,
+		TimeZone:      timeframe.TimeZone,
+		ProjectedFrom: source,
+		Description:   form.Description,
+	}
+	err = h.store.CreateProjectedTimeframe(projected, resources)
+	if err != nil {
+		glog.Errorf("ProjectTimeframe Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	localizeTimeframes(location, projected)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    projected,
+	})
+}
+
+func validateProjection(form *ProjectionForm) error {
+	if len(form.Name) == 0 {
+		return fmt.Errorf("name field cannot be empty")
+	}
+	if err := logic.ValidateProjection(form.Multiplier, form.Exponents); err != nil {
+		return err
+	}
+	for name, multiplier := range form.Multipliers {
+		if err := logic.ValidateProjection(multiplier, nil); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/angao/recommender/pkg/logic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+)
+
+// defaultTopGrowth is the number of applications listed by their growth if top is not given.
+const defaultTopGrowth = 10
+
+func (h *httpController) GetTimeframeReport(c *gin.Context) {
+	name := c.Param("name")
+	top := defaultTopGrowth
+	if s := c.Query("top"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "top must be a non-negative integer",
+			})
+			return
+		}
+		top = n
+	}
+	timeframe, err := h.store.GetTimeframe(name)
+	if err != nil {
+		glog.Errorf("GetTimeframeReport Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	if timeframe == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    404,
+			"message": fmt.Sprintf("%s not found", name),
+		})
+		return
+	}
+	timeframeResources, err := h.store.ListTimeframeApplicationResource(name)
+	if err != nil {
+		glog.Errorf("GetTimeframeReport Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	baselineResources, err := h.store.ListApplicationResource("")
+	if err != nil {
+		glog.Errorf("GetTimeframeReport Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    logic.BuildTimeframeReport(name, timeframeResources, baselineResources, top),
+	})
+}
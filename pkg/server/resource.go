@@ -26,10 +26,28 @@ import (
 	"github.com/golang/glog"
 )
 
+// requestCluster returns the cluster of the cluster query parameter, empty
+// for the recommendations merged over all clusters.
+func (h *httpController) requestCluster(c *gin.Context) (string, error) {
+	cluster := c.Query("cluster")
+	if len(cluster) != 0 && !h.globalConfig.HasCluster(cluster) {
+		return "", fmt.Errorf("unknown cluster %q", cluster)
+	}
+	return cluster, nil
+}
+
 func (h *httpController) GetResource(c *gin.Context) {
 	name := c.Param("name")
 	glog.V(4).Infof("GetResource name: %s", name)
-	resource, err := h.store.GetApplicationResource(name)
+	cluster, err := h.requestCluster(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	resource, err := h.store.GetApplicationResource(name, cluster)
 	if err != nil {
 		glog.Errorf("Internal Server Error: %#v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -53,7 +71,15 @@ func (h *httpController) GetResource(c *gin.Context) {
 }
 
 func (h *httpController) ListResource(c *gin.Context) {
-	resources, err := h.store.ListApplicationResource()
+	cluster, err := h.requestCluster(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	resources, err := h.store.ListApplicationResource(cluster)
 	if err != nil {
 		glog.Errorf("Internal Server Error: %#v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -124,8 +150,10 @@ func (h *httpController) CreateResource(c *gin.Context) {
 		return
 	}
 	resource := &v1alpha1.ContainerResource{
-		CPULimit:    application.CPULimit,
-		MemoryLimit: application.MemoryLimit,
+		RecommendedResources: v1alpha1.RecommendedResources{
+			CPULimit:    application.CPULimit,
+			MemoryLimit: application.MemoryLimit,
+		},
 	}
 	err := h.store.CreateContainerResource(resource)
 	if err != nil {
@@ -17,7 +17,9 @@ limitations under the License.
 package server
 
 import (
+	"github.com/angao/recommender/pkg/input/prometheus"
 	"github.com/angao/recommender/pkg/store"
+	"github.com/angao/recommender/pkg/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -26,6 +28,7 @@ type Controller interface {
 	CreateApplication(c *gin.Context)
 	GetApplication(c *gin.Context)
 	ListApplications(c *gin.Context)
+	UpdateApplication(c *gin.Context)
 	DeleteApplication(c *gin.Context)
 
 	GetResource(c *gin.Context)
@@ -35,20 +38,36 @@ type Controller interface {
 	ListTimeframeResource(c *gin.Context)
 	DeleteTimeframeResource(c *gin.Context)
 	GetTimeframeResource(c *gin.Context)
+	GetResourceHistory(c *gin.Context)
+	GetResourceDiff(c *gin.Context)
 
 	CreateTimeframe(c *gin.Context)
 	GetTimeframe(c *gin.Context)
 	UpdateTimeframe(c *gin.Context)
 	ListTimeframes(c *gin.Context)
 	DeleteTimeframe(c *gin.Context)
+	RerunTimeframe(c *gin.Context)
+	GetTimeframeReport(c *gin.Context)
+	ProjectTimeframe(c *gin.Context)
+	ImportTimeframes(c *gin.Context)
+	ValidateTimeframe(c *gin.Context)
 }
 
 type httpController struct {
-	store store.Store
+	store        store.Store
+	globalConfig *utils.GlobalConfig
+	// providers probe the samples the Prometheus of every cluster retains
+	// when validating timeframes.
+	providers []prometheus.Provider
 }
 
-func NewController(store store.Store) Controller {
+// NewController creates the controller of the HTTP API. The providers of the
+// clusters are shared with the feeder, so that their QPS limits cover the
+// queries of both.
+func NewController(store store.Store, globalConfig *utils.GlobalConfig, providers []prometheus.Provider) Controller {
 	return &httpController{
-		store: store,
+		store:        store,
+		globalConfig: globalConfig,
+		providers:    providers,
 	}
 }
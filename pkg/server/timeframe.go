@@ -23,24 +23,44 @@ import (
 	"time"
 
 	"github.com/angao/recommender/pkg/apis/v1alpha1"
+	"github.com/angao/recommender/pkg/logic"
+	"github.com/angao/recommender/pkg/utils"
+	"github.com/angao/recommender/pkg/utils/cron"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang/glog"
 )
 
 // Layout parse time
-const Layout = "2006-01-02 15:04:05"
+const Layout = utils.TimeLayout
 
 type TimeframeForm struct {
 	ID          int64  `json:"id"`
 	Name        string `json:"name"`
 	Start       string `form:"start"`
 	End         string `form:"end"`
+	Schedule    string `json:"schedule"`
+	Duration    string `json:"duration"`
 	Status      string `json:"status"`
 	Description string `form:"description"`
+	// TimeZone is the IANA time zone of the timeframe, Start and End without
+	// an offset are in it.
+	TimeZone string `json:"time_zone"`
+	// Applications and Selector scope the timeframe, nil leaves them unchanged on update.
+	Applications []string          `json:"applications"`
+	Selector     map[string]string `json:"selector"`
 }
 
 func (h *httpController) GetTimeframe(c *gin.Context) {
 	name := c.Param("name")
+	location, err := requestLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
 	timeframe, err := h.store.GetTimeframe(name)
 	if err != nil {
 		glog.Errorf("GetTimeframe Internal Server Error: %#v", err)
@@ -50,6 +70,7 @@ func (h *httpController) GetTimeframe(c *gin.Context) {
 		})
 		return
 	}
+	localizeTimeframes(location, timeframe)
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
@@ -67,7 +88,7 @@ func (h *httpController) CreateTimeframe(c *gin.Context) {
 		return
 	}
 
-	timeframe, err := ParseAndValidate(timeframeForm, "add")
+	timeframe, err := ParseAndValidate(timeframeForm, "add", "")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
@@ -75,6 +96,13 @@ func (h *httpController) CreateTimeframe(c *gin.Context) {
 		})
 		return
 	}
+	if err := h.validateTimeframeApplications(timeframe); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
 
 	frame, err := h.store.GetTimeframe(timeframe.Name)
 	if err != nil {
@@ -92,6 +120,23 @@ func (h *httpController) CreateTimeframe(c *gin.Context) {
 		})
 		return
 	}
+	issues, err := h.validateTimeframe(c.Request.Context(), timeframe)
+	if err != nil {
+		glog.Errorf("CreateTimeframe Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	if logic.HasIssueErrors(issues) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "invalid timeframe",
+			"data":    issues,
+		})
+		return
+	}
 
 	err = h.store.CreateTimeframe(timeframe)
 	if err != nil {
@@ -105,10 +150,19 @@ func (h *httpController) CreateTimeframe(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
+		"data":    issues,
 	})
 }
 
 func (h *httpController) ListTimeframes(c *gin.Context) {
+	location, err := requestLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
 	timeframes, err := h.store.ListTimeframe()
 	if err != nil {
 		glog.Errorf("ListTimeframes Internal Server Error: %#v", err)
@@ -118,6 +172,7 @@ func (h *httpController) ListTimeframes(c *gin.Context) {
 		})
 		return
 	}
+	localizeTimeframes(location, timeframes...)
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
@@ -134,7 +189,27 @@ func (h *httpController) UpdateTimeframe(c *gin.Context) {
 		})
 		return
 	}
-	timeframe, err := ParseAndValidate(timeframeForm, "update")
+	stored, err := h.store.GetTimeframeByID(timeframeForm.ID)
+	if err != nil {
+		glog.Errorf("UpdateTimeframe Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	var zone string
+	if stored != nil {
+		if stored.Status == v1alpha1.StatusProjected {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": fmt.Sprintf("%s is projected from %s", stored.Name, stored.ProjectedFrom),
+			})
+			return
+		}
+		zone = stored.TimeZone
+	}
+	timeframe, err := ParseAndValidate(timeframeForm, "update", zone)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
@@ -142,8 +217,15 @@ func (h *httpController) UpdateTimeframe(c *gin.Context) {
 		})
 		return
 	}
+	if err := h.validateTimeframeApplications(timeframe); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
 
-	timeframeCopy, err := h.store.GetTimeframe(timeframe.Name)
+	frame, err := h.store.GetTimeframe(timeframe.Name)
 	if err != nil {
 		glog.Errorf("UpdateTimeframe Internal Server Error: %#v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -152,13 +234,41 @@ func (h *httpController) UpdateTimeframe(c *gin.Context) {
 		})
 		return
 	}
-	if timeframeCopy != nil && timeframeCopy.ID != timeframe.ID {
+	if frame != nil && frame.ID != timeframe.ID {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
 			"message": "name is already exist",
 		})
 		return
 	}
+	issues, err := h.validateTimeframe(c.Request.Context(), timeframe)
+	if err != nil {
+		glog.Errorf("UpdateTimeframe Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	if logic.HasIssueErrors(issues) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "invalid timeframe",
+			"data":    issues,
+		})
+		return
+	}
+	if timeframe.Status == v1alpha1.StatusOn {
+		end := timeframe.End
+		recurring := len(timeframe.Schedule) != 0
+		if stored != nil {
+			if end.IsZero() {
+				end = stored.End
+			}
+			recurring = recurring || stored.IsRecurring()
+		}
+		timeframe.Status = switchedOnStatus(recurring, end)
+	}
 	err = h.store.UpdateTimeframe(timeframe)
 	if err != nil {
 		glog.Errorf("UpdateTimeframe Internal Server Error: %#v", err)
@@ -171,6 +281,7 @@ func (h *httpController) UpdateTimeframe(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
+		"data":    issues,
 	})
 }
 
@@ -207,10 +318,20 @@ func (h *httpController) DeleteTimeframe(c *gin.Context) {
 	})
 }
 
-func ParseAndValidate(form *TimeframeForm, flag string) (*v1alpha1.Timeframe, error) {
+// ParseAndValidate parses the form of the flag, "add" or "update". The start
+// and end are in the time zone of the form, or in defaultZone if it has none.
+func ParseAndValidate(form *TimeframeForm, flag string, defaultZone string) (*v1alpha1.Timeframe, error) {
+	zone := form.TimeZone
+	if len(zone) == 0 {
+		zone = defaultZone
+	}
+	location, err := utils.LoadLocation(zone)
+	if err != nil {
+		return nil, err
+	}
 	if flag == "add" {
-		if len(form.Name) == 0 || len(form.Start) == 0 || len(form.End) == 0 {
-			return nil, errors.New("name, start or end field cannot be empty")
+		if len(form.Name) == 0 {
+			return nil, errors.New("name field cannot be empty")
 		}
 		status := form.Status
 		if len(form.Status) == 0 {
@@ -219,23 +340,53 @@ func ParseAndValidate(form *TimeframeForm, flag string) (*v1alpha1.Timeframe, er
 		if status != "on" && status != "off" {
 			return nil, errors.New("status must be 'on' or 'off'")
 		}
-		start, err := time.ParseInLocation(Layout, form.Start, time.Local)
+		if len(form.Schedule) != 0 || len(form.Duration) != 0 {
+			if len(form.Schedule) == 0 || len(form.Duration) == 0 {
+				return nil, errors.New("schedule and duration must be set together")
+			}
+			if err := validateRecurrence(form); err != nil {
+				return nil, err
+			}
+			if status == v1alpha1.StatusOn {
+				status = switchedOnStatus(true, time.Time{})
+			}
+			return &v1alpha1.Timeframe{
+				Name:         form.Name,
+				Schedule:     form.Schedule,
+				Duration:     form.Duration,
+				Status:       status,
+				TimeZone:     form.TimeZone,
+				Applications: form.Applications,
+				Selector:     form.Selector,
+				Description:  form.Description,
+			}, nil
+		}
+		if len(form.Start) == 0 || len(form.End) == 0 {
+			return nil, errors.New("start and end, or schedule and duration fields cannot be empty")
+		}
+		start, err := utils.ParseTime(form.Start, location)
 		if err != nil {
 			return nil, err
 		}
-		end, err := time.ParseInLocation(Layout, form.End, time.Local)
+		end, err := utils.ParseTime(form.End, location)
 		if err != nil {
 			return nil, err
 		}
 		if start.After(end) {
 			return nil, errors.New("start cannot be after end")
 		}
+		if status == v1alpha1.StatusOn {
+			status = switchedOnStatus(false, end)
+		}
 		return &v1alpha1.Timeframe{
-			Name:        form.Name,
-			Start:       start,
-			End:         end,
-			Status:      status,
-			Description: form.Description,
+			Name:         form.Name,
+			Start:        start,
+			End:          end,
+			Status:       status,
+			TimeZone:     form.TimeZone,
+			Applications: form.Applications,
+			Selector:     form.Selector,
+			Description:  form.Description,
 		}, nil
 	}
 	if flag == "update" {
@@ -248,19 +399,27 @@ func ParseAndValidate(form *TimeframeForm, flag string) (*v1alpha1.Timeframe, er
 			timeframe.Name = form.Name
 		}
 		if len(form.Start) != 0 {
-			start, err := time.ParseInLocation(Layout, form.Start, time.Local)
+			start, err := utils.ParseTime(form.Start, location)
 			if err != nil {
 				return nil, err
 			}
 			timeframe.Start = start
 		}
 		if len(form.End) != 0 {
-			end, err := time.ParseInLocation(Layout, form.End, time.Local)
+			end, err := utils.ParseTime(form.End, location)
 			if err != nil {
 				return nil, err
 			}
 			timeframe.End = end
 		}
+		if err := validateRecurrence(form); err != nil {
+			return nil, err
+		}
+		timeframe.Schedule = form.Schedule
+		timeframe.TimeZone = form.TimeZone
+		timeframe.Duration = form.Duration
+		timeframe.Applications = form.Applications
+		timeframe.Selector = form.Selector
 		if len(form.Status) != 0 {
 			if form.Status != "on" && form.Status != "off" {
 				return nil, errors.New("status must be 'on' or 'off'")
@@ -271,3 +430,140 @@ func ParseAndValidate(form *TimeframeForm, flag string) (*v1alpha1.Timeframe, er
 	}
 	return nil, nil
 }
+
+// validateRecurrence validates the schedule and the duration of a recurring timeframe, if they are set.
+func validateRecurrence(form *TimeframeForm) error {
+	if len(form.Schedule) != 0 {
+		if _, err := cron.Parse(form.Schedule); err != nil {
+			return fmt.Errorf("invalid schedule: %v", err)
+		}
+	}
+	if len(form.Duration) != 0 {
+		if duration, err := utils.ParseDuration(form.Duration); err != nil || duration <= 0 {
+			return fmt.Errorf("duration must be a positive duration: %q", form.Duration)
+		}
+	}
+	return nil
+}
+
+// switchedOnStatus returns the status of a timeframe switched on. A one-off
+// timeframe switched on before it ends is computed once it ends.
+func switchedOnStatus(recurring bool, end time.Time) string {
+	if !recurring && end.After(time.Now()) {
+		return v1alpha1.StatusScheduled
+	}
+	return v1alpha1.StatusPending
+}
+
+// requestLocation returns the location of the tz query parameter, nil if
+// there is none. Query times without an offset are in it, and the times of
+// the response are shown in it.
+func requestLocation(c *gin.Context) (*time.Location, error) {
+	tz := c.Query("tz")
+	if len(tz) == 0 {
+		return nil, nil
+	}
+	return utils.LoadLocation(tz)
+}
+
+// parseQueryTime parses a query time, in the local time zone if location is nil.
+func parseQueryTime(name, value string, location *time.Location) (time.Time, error) {
+	if location == nil {
+		location = time.Local
+	}
+	t, err := utils.ParseTime(value, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be formatted as RFC3339 or %s", name, Layout)
+	}
+	return t, nil
+}
+
+// localizeTimeframes shows the times of the timeframes in the location, or
+// in their own time zones if it is nil.
+func localizeTimeframes(location *time.Location, timeframes ...*v1alpha1.Timeframe) {
+	for _, timeframe := range timeframes {
+		if timeframe == nil {
+			continue
+		}
+		if location == nil {
+			timeframe.In(timeframe.Location())
+			continue
+		}
+		timeframe.In(location)
+	}
+}
+
+func (h *httpController) RerunTimeframe(c *gin.Context) {
+	name := c.Param("name")
+	location, err := requestLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	timeframe, err := h.store.GetTimeframe(name)
+	if err != nil {
+		glog.Errorf("RerunTimeframe Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	if timeframe == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    404,
+			"message": fmt.Sprintf("%s not found", name),
+		})
+		return
+	}
+	if timeframe.Status == v1alpha1.StatusRunning {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": fmt.Sprintf("%s is running", name),
+		})
+		return
+	}
+	if timeframe.Status == v1alpha1.StatusProjected {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": fmt.Sprintf("%s is projected from %s", name, timeframe.ProjectedFrom),
+		})
+		return
+	}
+	// The timeframe is computed again with fresh attempts on the next check.
+	timeframe.Status = switchedOnStatus(timeframe.IsRecurring(), timeframe.End)
+	timeframe.Error = ""
+	timeframe.Attempts = 0
+	err = h.store.UpdateTimeframes([]*v1alpha1.Timeframe{timeframe})
+	if err != nil {
+		glog.Errorf("RerunTimeframe Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	localizeTimeframes(location, timeframe)
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    timeframe,
+	})
+}
+
+// validateTimeframeApplications checks that the applications named by the timeframe exist.
+func (h *httpController) validateTimeframeApplications(timeframe *v1alpha1.Timeframe) error {
+	for _, name := range timeframe.Applications {
+		application, err := h.store.GetApplication(name)
+		if err != nil {
+			return err
+		}
+		if application == nil {
+			return fmt.Errorf("application %s not found", name)
+		}
+	}
+	return nil
+}
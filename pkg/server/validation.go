@@ -0,0 +1,195 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+	"github.com/angao/recommender/pkg/logic"
+	"github.com/angao/recommender/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+)
+
+// ValidateTimeframe reports the issues of a timeframe form without saving
+// it. A form with an id is validated as an update.
+func (h *httpController) ValidateTimeframe(c *gin.Context) {
+	timeframeForm := new(TimeframeForm)
+	if err := c.ShouldBindJSON(timeframeForm); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
+	flag := "add"
+	if timeframeForm.ID != 0 {
+		flag = "update"
+	}
+	issues, err := h.validateTimeframeForm(c.Request.Context(), timeframeForm, flag)
+	if err != nil {
+		glog.Errorf("ValidateTimeframe Internal Server Error: %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"valid":  !logic.HasIssueErrors(issues),
+			"issues": issues,
+		},
+	})
+}
+
+// validateTimeframeForm reports the form errors as issues, followed by the
+// issues of the timeframe the form describes.
+func (h *httpController) validateTimeframeForm(ctx context.Context, form *TimeframeForm, flag string) ([]*v1alpha1.TimeframeIssue, error) {
+	// The start and end of an update without a time zone are in the time
+	// zone of the stored timeframe.
+	var zone string
+	if flag == "update" {
+		stored, err := h.store.GetTimeframeByID(form.ID)
+		if err != nil {
+			return nil, err
+		}
+		if stored != nil {
+			if stored.Status == v1alpha1.StatusProjected {
+				message := fmt.Sprintf("%s is projected from %s", stored.Name, stored.ProjectedFrom)
+				return []*v1alpha1.TimeframeIssue{{Level: v1alpha1.IssueError, Timeframe: stored.Name, Message: message}}, nil
+			}
+			zone = stored.TimeZone
+		}
+	}
+	timeframe, err := ParseAndValidate(form, flag, zone)
+	if err != nil {
+		return []*v1alpha1.TimeframeIssue{{Level: v1alpha1.IssueError, Message: err.Error()}}, nil
+	}
+	if err := h.validateTimeframeApplications(timeframe); err != nil {
+		return []*v1alpha1.TimeframeIssue{{Level: v1alpha1.IssueError, Message: err.Error()}}, nil
+	}
+	frame, err := h.store.GetTimeframe(timeframe.Name)
+	if err != nil {
+		return nil, err
+	}
+	if frame != nil && frame.ID != timeframe.ID {
+		return []*v1alpha1.TimeframeIssue{{Level: v1alpha1.IssueError, Timeframe: frame.Name, Message: "name is already exist"}}, nil
+	}
+	return h.validateTimeframe(ctx, timeframe)
+}
+
+// validateTimeframe checks the window of the timeframe, its overlaps with the
+// other timeframes and the samples Prometheus retains for it. An update is
+// merged into the timeframe it updates first. The samples are probed until
+// the context is done.
+func (h *httpController) validateTimeframe(ctx context.Context, timeframe *v1alpha1.Timeframe) ([]*v1alpha1.TimeframeIssue, error) {
+	timeframes, err := h.store.ListTimeframe()
+	if err != nil {
+		return nil, err
+	}
+	applications, err := h.store.ListApplication()
+	if err != nil {
+		return nil, err
+	}
+	if timeframe.ID != 0 {
+		for _, existing := range timeframes {
+			if existing.ID == timeframe.ID {
+				timeframe = mergeTimeframe(existing, timeframe)
+				break
+			}
+		}
+	}
+
+	now := time.Now()
+	issues := logic.ValidateTimeframeWindow(timeframe)
+	issues = append(issues, logic.ValidateTimeframeOverlaps(timeframe, timeframes, applications, now)...)
+	history, err := utils.ParseDuration(h.globalConfig.ExtraConfig.History)
+	if err != nil {
+		return nil, err
+	}
+	start, end := logic.TimeframeCoverage(timeframe, history, now)
+	if !start.Before(now) || !start.Before(end) {
+		return issues, nil
+	}
+	until := end
+	if until.After(now) {
+		until = now
+	}
+	// The usage of the timeframe is read from all clusters, so the latest of
+	// their earliest samples bounds it, and none if a cluster has none.
+	var earliest time.Time
+	for i, provider := range h.providers {
+		sample, err := provider.EarliestSample(ctx, start, until)
+		if err != nil {
+			glog.Warningf("Cannot probe the samples of timeframe %s: %v", timeframe.Name, err)
+			return append(issues, &v1alpha1.TimeframeIssue{
+				Level:   v1alpha1.IssueWarning,
+				Message: fmt.Sprintf("cannot probe the samples Prometheus retains: %v", err),
+			}), nil
+		}
+		if sample.IsZero() {
+			earliest = sample
+			break
+		}
+		if i == 0 || sample.After(earliest) {
+			earliest = sample
+		}
+	}
+	return append(issues, logic.ValidateTimeframeRetention(start, end, earliest, now)...), nil
+}
+
+// mergeTimeframe returns the timeframe after the update, which only changes
+// the fields it sets.
+func mergeTimeframe(timeframe, update *v1alpha1.Timeframe) *v1alpha1.Timeframe {
+	merged := *timeframe
+	if len(update.Name) != 0 {
+		merged.Name = update.Name
+	}
+	if !update.Start.IsZero() {
+		merged.Start = update.Start
+	}
+	if !update.End.IsZero() {
+		merged.End = update.End
+	}
+	if len(update.Schedule) != 0 {
+		merged.Schedule = update.Schedule
+	}
+	if len(update.Duration) != 0 {
+		merged.Duration = update.Duration
+	}
+	if len(update.TimeZone) != 0 {
+		merged.TimeZone = update.TimeZone
+	}
+	if len(update.Status) != 0 {
+		merged.Status = update.Status
+	}
+	if update.Applications != nil {
+		merged.Applications, merged.Scoped = update.Applications, update.Scoped
+	}
+	if update.Selector != nil {
+		merged.Selector = update.Selector
+	}
+	return &merged
+}
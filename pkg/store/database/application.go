@@ -44,11 +44,26 @@ func (db *datastore) ListApplication() ([]*v1alpha1.Application, error) {
 }
 
 func (db *datastore) UpdateApplication(application *v1alpha1.Application) error {
-	_, err := db.Engine.ID(application.ID).Update(application)
+	_, err := db.Engine.ID(application.ID).MustCols("policy", "resource_policy", "update_policy", "labels", "label_schema", "clusters").Update(application)
 	return err
 }
 
+// DeleteApplication also deletes the checkpoints of the application.
 func (db *datastore) DeleteApplication(application *v1alpha1.Application) error {
-	_, err := db.Engine.Id(application.ID).Delete(application)
-	return err
+	session := db.Engine.NewSession()
+	defer session.Close()
+
+	session.Begin()
+
+	_, err := session.Id(application.ID).Delete(application)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+	_, err = session.Where("application_id = ?", application.ID).Delete(new(v1alpha1.Checkpoint))
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+	return session.Commit()
 }
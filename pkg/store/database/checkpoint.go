@@ -0,0 +1,74 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+)
+
+func (db *datastore) ListCheckpoints() ([]*v1alpha1.Checkpoint, error) {
+	checkpoints := make([]*v1alpha1.Checkpoint, 0)
+	err := db.Engine.Find(&checkpoints)
+	return checkpoints, err
+}
+
+// SaveCheckpoints replaces all checkpoints of the application in the cluster with the given ones.
+func (db *datastore) SaveCheckpoints(applicationID int64, cluster string, checkpoints []*v1alpha1.Checkpoint) error {
+	session := db.Engine.NewSession()
+	defer session.Close()
+
+	session.Begin()
+
+	_, err := session.Where("application_id = ?", applicationID).And("cluster = ?", cluster).Delete(new(v1alpha1.Checkpoint))
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+	for _, checkpoint := range checkpoints {
+		checkpoint.ApplicationID = applicationID
+		checkpoint.Cluster = cluster
+		_, err = session.Insert(checkpoint)
+		if err != nil {
+			session.Rollback()
+			return err
+		}
+	}
+	return session.Commit()
+}
+
+// DeleteStaleClusters deletes the recommendations and checkpoints of the application in the clusters
+// other than the given ones, e.g. removed from the configuration or from the application's clusters.
+func (db *datastore) DeleteStaleClusters(applicationID int64, clusters []string) error {
+	session := db.Engine.NewSession()
+	defer session.Close()
+
+	session.Begin()
+
+	_, err := session.Where("application_id = ?", applicationID).And("timeframe_id = 0").And("cluster != ''").
+		NotIn("cluster", clusters).Delete(new(v1alpha1.ContainerResource))
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+	_, err = session.Where("application_id = ?", applicationID).And("cluster != ''").
+		NotIn("cluster", clusters).Delete(new(v1alpha1.Checkpoint))
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+	return session.Commit()
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"time"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+
+	"github.com/go-xorm/xorm"
+)
+
+// addRecommendationHistory writes the next version of the container's
+// recommendation, if the recommended amounts changed since the last one.
+func addRecommendationHistory(session *xorm.Session, resource *v1alpha1.ContainerResource) error {
+	last := new(v1alpha1.RecommendationHistory)
+	has, err := session.Where("application_id = ?", resource.ApplicationID).
+		And("timeframe_id = ?", resource.TimeframeID).And("cluster = ?", resource.Cluster).And("name = ?", resource.Name).
+		Desc("version").Limit(1).Get(last)
+	if err != nil {
+		return err
+	}
+	if has && sameAmounts(&last.RecommendedResources, &resource.RecommendedResources) {
+		return nil
+	}
+	_, err = session.Insert(&v1alpha1.RecommendationHistory{
+		Name:                 resource.Name,
+		ApplicationID:        resource.ApplicationID,
+		TimeframeID:          resource.TimeframeID,
+		Cluster:              resource.Cluster,
+		Version:              last.Version + 1,
+		RecommendedResources: resource.RecommendedResources,
+	})
+	return err
+}
+
+// sameAmounts tells whether the two recommendations recommend the same
+// amounts, the confidence is not compared.
+func sameAmounts(r1, r2 *v1alpha1.RecommendedResources) bool {
+	values := r2.Values()
+	for name, value := range r1.Values() {
+		if values[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// PruneRecommendationHistory deletes the versions created before the given
+// time which a later version created before it too supersedes, so that the
+// recommendation at any time since then is kept.
+func (db *datastore) PruneRecommendationHistory(before time.Time) error {
+	_, err := db.Engine.Exec("DELETE h FROM t_recommendation_history h JOIN t_recommendation_history n "+
+		"ON n.application_id = h.application_id AND n.timeframe_id = h.timeframe_id AND n.cluster = h.cluster "+
+		"AND n.name = h.name AND n.version > h.version AND n.created < ? WHERE h.created < ?", before, before)
+	return err
+}
+
+func (db *datastore) ListRecommendationHistory(name, cluster string, since time.Time) ([]*v1alpha1.RecommendationHistory, error) {
+	application := new(v1alpha1.Application)
+	b, err := db.Engine.Where("name = ?", name).Limit(1).Get(application)
+	if err != nil {
+		return nil, err
+	}
+	if !b {
+		return nil, nil
+	}
+	histories := make([]*v1alpha1.RecommendationHistory, 0)
+	err = db.Engine.Where("application_id = ?", application.ID).And("timeframe_id = 0").And("cluster = ?", cluster).
+		And("created >= ?", since).Asc("created", "id").Find(&histories)
+	return histories, err
+}
+
+func (db *datastore) GetRecommendationHistoryAt(name, cluster string, at time.Time) ([]*v1alpha1.RecommendationHistory, error) {
+	application := new(v1alpha1.Application)
+	b, err := db.Engine.Where("name = ?", name).Limit(1).Get(application)
+	if err != nil {
+		return nil, err
+	}
+	if !b {
+		return nil, nil
+	}
+	histories := make([]*v1alpha1.RecommendationHistory, 0)
+	err = db.Engine.Where("application_id = ?", application.ID).And("timeframe_id = 0").And("cluster = ?", cluster).
+		And("created <= ?", at).Desc("version").Find(&histories)
+	if err != nil {
+		return nil, err
+	}
+	// Keep the latest version of every container.
+	latest := make([]*v1alpha1.RecommendationHistory, 0)
+	seen := make(map[string]bool)
+	for _, history := range histories {
+		if !seen[history.Name] {
+			seen[history.Name] = true
+			latest = append(latest, history)
+		}
+	}
+	return latest, nil
+}
@@ -18,11 +18,12 @@ package datastore
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/angao/recommender/pkg/apis/v1alpha1"
 )
 
-func (db *datastore) GetApplicationResource(name string) (*v1alpha1.ApplicationResource, error) {
+func (db *datastore) GetApplicationResource(name, cluster string) (*v1alpha1.ApplicationResource, error) {
 	application := new(v1alpha1.Application)
 	containerResources := make([]*v1alpha1.ContainerResource, 0)
 	b, err := db.Engine.Where("name = ?", name).Limit(1).Get(application)
@@ -32,7 +33,7 @@ func (db *datastore) GetApplicationResource(name string) (*v1alpha1.ApplicationR
 	if !b {
 		return nil, nil
 	}
-	err = db.Engine.Where("application_id = ?", application.ID).And("timeframe_id = 0").Find(&containerResources)
+	err = db.Engine.Where("application_id = ?", application.ID).And("timeframe_id = 0").And("cluster = ?", cluster).Find(&containerResources)
 	if err != nil {
 		return nil, err
 	}
@@ -40,22 +41,27 @@ func (db *datastore) GetApplicationResource(name string) (*v1alpha1.ApplicationR
 	return &v1alpha1.ApplicationResource{
 		ID:                application.ID,
 		Name:              application.Name,
+		Cluster:           cluster,
 		ContainerResource: containerResources,
 	}, nil
 }
 
-func (db *datastore) ListApplicationResource() ([]*v1alpha1.ApplicationResource, error) {
+func (db *datastore) ListApplicationResource(cluster string) ([]*v1alpha1.ApplicationResource, error) {
 	applications := make([]*v1alpha1.Application, 0)
 	containerResources := make([]*v1alpha1.ContainerResource, 0)
 	err := db.Engine.Find(&applications)
 	if err != nil {
 		return nil, err
 	}
-	err = db.Engine.Where("timeframe_id = 0").Find(&containerResources)
+	err = db.Engine.Where("timeframe_id = 0").And("cluster = ?", cluster).Find(&containerResources)
 	if err != nil {
 		return nil, err
 	}
-	return combine(applications, containerResources), nil
+	applicationResources := combine(applications, containerResources)
+	for _, applicationResource := range applicationResources {
+		applicationResource.Cluster = cluster
+	}
+	return applicationResources, nil
 }
 
 func (db *datastore) AddOrUpdateContainerResource(resources []*v1alpha1.ContainerResource) error {
@@ -69,7 +75,7 @@ func (db *datastore) AddOrUpdateContainerResource(resources []*v1alpha1.Containe
 		var err error
 		if resource.TimeframeID == 0 {
 			has, err = session.Where("application_id = ?", resource.ApplicationID).
-				And("name = ?", resource.Name).And("timeframe_id = 0").Limit(1).Get(resourceCopy)
+				And("name = ?", resource.Name).And("timeframe_id = 0").And("cluster = ?", resource.Cluster).Limit(1).Get(resourceCopy)
 		} else {
 			has, err = session.Where("application_id = ?", resource.ApplicationID).
 				And("name = ?", resource.Name).And("timeframe_id = ?", resource.TimeframeID).Limit(1).Get(resourceCopy)
@@ -80,8 +86,9 @@ func (db *datastore) AddOrUpdateContainerResource(resources []*v1alpha1.Containe
 			return err
 		}
 		if has {
-			compare(resource, resourceCopy)
-			_, err = session.ID(resourceCopy.ID).Update(resource)
+			applyUpdatePolicy(resource, resourceCopy)
+			// All columns are written, so recommendations may also drop to 0.
+			_, err = session.ID(resourceCopy.ID).AllCols().Update(resource)
 			if err != nil {
 				session.Rollback()
 				return err
@@ -93,6 +100,10 @@ func (db *datastore) AddOrUpdateContainerResource(resources []*v1alpha1.Containe
 				return err
 			}
 		}
+		if err = addRecommendationHistory(session, resource); err != nil {
+			session.Rollback()
+			return err
+		}
 	}
 	return session.Commit()
 }
@@ -171,24 +182,113 @@ func (db *datastore) GetTimeframeApplicationResource(name, appName string) (*v1a
 	}, nil
 }
 
-func compare(r1, r2 *v1alpha1.ContainerResource) {
-	if r1.CPULimit < r2.CPULimit {
-		r1.CPULimit = r2.CPULimit
+// applyUpdatePolicy decides, according to the update policy of the new
+// recommendation, which values replace the stored recommendation. A timeframe
+// recommendation is computed once per occurrence and always replaces the
+// stored one.
+func applyUpdatePolicy(resource, stored *v1alpha1.ContainerResource) {
+	policy := resource.UpdatePolicy
+	if resource.TimeframeID != 0 {
+		policy = &v1alpha1.UpdatePolicy{Mode: v1alpha1.UpdateModeReplace}
 	}
-	if r1.MemoryLimit < r2.MemoryLimit {
-		r1.MemoryLimit = r2.MemoryLimit
+	if policy == nil {
+		policy = &v1alpha1.UpdatePolicy{Mode: v1alpha1.UpdateModeRatchet}
 	}
-	if r1.DiskReadIOLimit < r2.DiskReadIOLimit {
-		r1.DiskReadIOLimit = r2.DiskReadIOLimit
+	switch policy.Mode {
+	case v1alpha1.UpdateModeReplace:
+		resource.PendingRuns, resource.PendingDirection = 0, 0
+	case v1alpha1.UpdateModeHysteresis:
+		pendingRuns := 0
+		change, direction := relativeChange(resource, stored)
+		if change > policy.Threshold/100 {
+			// Only the runs changing the recommendation the same way count.
+			pendingRuns = 1
+			if direction == stored.PendingDirection {
+				pendingRuns = stored.PendingRuns + 1
+			}
+		} else {
+			direction = 0
+		}
+		if pendingRuns > 0 && pendingRuns >= policy.Runs {
+			resource.PendingRuns, resource.PendingDirection = 0, 0
+			return
+		}
+		// Hold the stored recommendation back, only the counter and the peaks change.
+		peaks := resource.UsagePeaks
+		*resource = *stored
+		resource.UsagePeaks = peaks
+		resource.PendingRuns, resource.PendingDirection = pendingRuns, direction
+		resource.UpdatePolicy = policy
+	default:
+		ratchet(resource, stored)
+		resource.PendingRuns, resource.PendingDirection = 0, 0
 	}
-	if r1.DiskWriteIOLimit < r2.DiskWriteIOLimit {
-		r1.DiskWriteIOLimit = r2.DiskWriteIOLimit
+}
+
+// relativeChange returns the largest relative change between the targets
+// and requests of the two recommendations, and its direction: 1 if r1 is
+// higher than r2, -1 if lower.
+func relativeChange(r1, r2 *v1alpha1.ContainerResource) (float64, int) {
+	change, direction := 0., 0
+	for _, r := range [][2]int64{
+		{r1.CPULimit, r2.CPULimit},
+		{r1.MemoryLimit, r2.MemoryLimit},
+		{r1.DiskReadIOLimit, r2.DiskReadIOLimit},
+		{r1.DiskWriteIOLimit, r2.DiskWriteIOLimit},
+		{r1.NetworkReceiveIOLimit, r2.NetworkReceiveIOLimit},
+		{r1.NetworkTransmitIOLimit, r2.NetworkTransmitIOLimit},
+		{r1.CPURequest, r2.CPURequest},
+		{r1.MemoryRequest, r2.MemoryRequest},
+	} {
+		value, stored := float64(r[0]), float64(r[1])
+		if value == stored {
+			continue
+		}
+		if stored == 0 {
+			return math.Inf(1), 1
+		}
+		if c := math.Abs(value-stored) / stored; c > change {
+			change, direction = c, 1
+			if value < stored {
+				direction = -1
+			}
+		}
 	}
-	if r1.NetworkReceiveIOLimit < r2.NetworkReceiveIOLimit {
-		r1.NetworkReceiveIOLimit = r2.NetworkReceiveIOLimit
+	return change, direction
+}
+
+// ratchet keeps the higher of the new and the stored targets and requests,
+// so they never decrease. The bounds and the confidence are taken from the
+// new recommendation, with the upper bounds raised to the kept targets.
+func ratchet(r1, r2 *v1alpha1.ContainerResource) {
+	for _, r := range [][3]*int64{
+		{&r1.CPULimit, &r2.CPULimit, &r1.CPUUpperBound},
+		{&r1.MemoryLimit, &r2.MemoryLimit, &r1.MemoryUpperBound},
+		{&r1.DiskReadIOLimit, &r2.DiskReadIOLimit, &r1.DiskReadIOUpperBound},
+		{&r1.DiskWriteIOLimit, &r2.DiskWriteIOLimit, &r1.DiskWriteIOUpperBound},
+		{&r1.NetworkReceiveIOLimit, &r2.NetworkReceiveIOLimit, &r1.NetworkReceiveIOUpperBound},
+		{&r1.NetworkTransmitIOLimit, &r2.NetworkTransmitIOLimit, &r1.NetworkTransmitIOUpperBound},
+	} {
+		target, storedTarget, upperBound := r[0], r[1], r[2]
+		if *target < *storedTarget {
+			*target = *storedTarget
+		}
+		if *upperBound < *target {
+			*upperBound = *target
+		}
 	}
-	if r1.NetworkTransmitIOLimit < r2.NetworkTransmitIOLimit {
-		r1.NetworkTransmitIOLimit = r2.NetworkTransmitIOLimit
+	// Requests follow the same rule and must not exceed the kept limits.
+	for _, r := range [][3]*int64{
+		{&r1.CPURequest, &r2.CPURequest, &r1.CPULimit},
+		{&r1.MemoryRequest, &r2.MemoryRequest, &r1.MemoryLimit},
+	} {
+		request, storedRequest, limit := r[0], r[1], r[2]
+		if *request < *storedRequest {
+			*request = *storedRequest
+		}
+		if *request > *limit {
+			*request = *limit
+		}
 	}
 }
 
@@ -0,0 +1,82 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package datastore
+
+import (
+	"testing"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
+)
+
+func TestApplyUpdatePolicy(t *testing.T) {
+	hysteresis := &v1alpha1.UpdatePolicy{Mode: v1alpha1.UpdateModeHysteresis, Threshold: 10, Runs: 2}
+	cases := []struct {
+		name        string
+		policy      *v1alpha1.UpdatePolicy
+		cpu         int64
+		pendingRuns int
+		direction   int
+		wantCPU     int64
+		wantPending int
+	}{
+		{"ratchet keeps the higher value", nil, 500, 0, 0, 1000, 0},
+		{"replace lets the value decrease", &v1alpha1.UpdatePolicy{Mode: v1alpha1.UpdateModeReplace}, 500, 0, 0, 500, 0},
+		{"hysteresis ignores small changes", hysteresis, 950, 1, -1, 1000, 0},
+		{"hysteresis holds the first large change back", hysteresis, 500, 0, 0, 1000, 1},
+		{"hysteresis applies a repeated large change", hysteresis, 500, 1, -1, 500, 0},
+		{"hysteresis restarts when the direction flips", hysteresis, 1500, 1, -1, 1000, 1},
+	}
+	for _, c := range cases {
+		stored := &v1alpha1.ContainerResource{ID: 1, PendingRuns: c.pendingRuns, PendingDirection: c.direction}
+		stored.CPULimit = 1000
+		resource := &v1alpha1.ContainerResource{UpdatePolicy: c.policy}
+		resource.CPULimit = c.cpu
+		applyUpdatePolicy(resource, stored)
+		if resource.CPULimit != c.wantCPU || resource.PendingRuns != c.wantPending {
+			t.Errorf("%s: got cpu %d pending %d, want cpu %d pending %d",
+				c.name, resource.CPULimit, resource.PendingRuns, c.wantCPU, c.wantPending)
+		}
+	}
+}
+
+func TestApplyUpdatePolicyTimeframe(t *testing.T) {
+	hysteresis := &v1alpha1.UpdatePolicy{Mode: v1alpha1.UpdateModeHysteresis, Threshold: 10, Runs: 3}
+	for _, policy := range []*v1alpha1.UpdatePolicy{nil, hysteresis} {
+		stored := &v1alpha1.ContainerResource{ID: 1, TimeframeID: 2, PendingRuns: 1, PendingDirection: -1}
+		stored.CPULimit = 1000
+		// The recomputed timeframe recommendation is lower.
+		resource := &v1alpha1.ContainerResource{TimeframeID: 2, UpdatePolicy: policy}
+		resource.CPULimit = 500
+		applyUpdatePolicy(resource, stored)
+		if resource.CPULimit != 500 || resource.PendingRuns != 0 {
+			t.Errorf("%v: got cpu %d pending %d, want cpu 500 pending 0", policy, resource.CPULimit, resource.PendingRuns)
+		}
+	}
+}
+
+func TestSameAmounts(t *testing.T) {
+	stored := v1alpha1.RecommendedResources{CPULimit: 1000, MemoryRequest: 512, Confidence: 1}
+	resource := stored
+	resource.Confidence = 2
+	if !sameAmounts(&stored, &resource) {
+		t.Errorf("expected a recommendation differing only by confidence to be the same")
+	}
+	resource.MemoryRequest = 1024
+	if sameAmounts(&stored, &resource) {
+		t.Errorf("expected a recommendation with another memory request to differ")
+	}
+}
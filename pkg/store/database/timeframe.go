@@ -17,12 +17,55 @@ limitations under the License.
 package datastore
 
 import (
+	"fmt"
+
 	"github.com/angao/recommender/pkg/apis/v1alpha1"
+
+	"github.com/go-xorm/xorm"
 )
 
 func (db *datastore) CreateTimeframe(frame *v1alpha1.Timeframe) error {
-	_, err := db.Engine.Insert(frame)
-	return err
+	session := db.Engine.NewSession()
+	defer session.Close()
+
+	session.Begin()
+
+	_, err := session.Insert(frame)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+	if err := saveTimeframeApplications(session, frame); err != nil {
+		session.Rollback()
+		return err
+	}
+	return session.Commit()
+}
+
+// CreateProjectedTimeframe creates the timeframe together with its recommendations.
+func (db *datastore) CreateProjectedTimeframe(frame *v1alpha1.Timeframe, resources []*v1alpha1.ContainerResource) error {
+	session := db.Engine.NewSession()
+	defer session.Close()
+
+	session.Begin()
+
+	_, err := session.Insert(frame)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+	for _, resource := range resources {
+		resource.TimeframeID = frame.ID
+		if _, err := session.Insert(resource); err != nil {
+			session.Rollback()
+			return err
+		}
+		if err := addRecommendationHistory(session, resource); err != nil {
+			session.Rollback()
+			return err
+		}
+	}
+	return session.Commit()
 }
 
 func (db *datastore) GetTimeframe(name string) (*v1alpha1.Timeframe, error) {
@@ -34,20 +77,69 @@ func (db *datastore) GetTimeframe(name string) (*v1alpha1.Timeframe, error) {
 	if !b {
 		return nil, nil
 	}
+	if err := db.loadTimeframeApplications([]*v1alpha1.Timeframe{timeframe}); err != nil {
+		return nil, err
+	}
+	return timeframe, nil
+}
+
+func (db *datastore) GetTimeframeByID(id int64) (*v1alpha1.Timeframe, error) {
+	timeframe := new(v1alpha1.Timeframe)
+	b, err := db.Engine.ID(id).Get(timeframe)
+	if err != nil {
+		return nil, err
+	}
+	if !b {
+		return nil, nil
+	}
+	if err := db.loadTimeframeApplications([]*v1alpha1.Timeframe{timeframe}); err != nil {
+		return nil, err
+	}
 	return timeframe, nil
 }
 
 func (db *datastore) ListTimeframe() ([]*v1alpha1.Timeframe, error) {
 	frames := make([]*v1alpha1.Timeframe, 0)
 	err := db.Engine.Find(&frames)
-	return frames, err
+	if err != nil {
+		return nil, err
+	}
+	if err := db.loadTimeframeApplications(frames); err != nil {
+		return nil, err
+	}
+	return frames, nil
 }
 
+// UpdateTimeframe replaces the applications of the timeframe if they are
+// not nil, and its selector if it is not nil.
 func (db *datastore) UpdateTimeframe(frame *v1alpha1.Timeframe) error {
-	_, err := db.Engine.ID(frame.ID).Update(frame)
-	return err
-}
+	session := db.Engine.NewSession()
+	defer session.Close()
 
+	session.Begin()
+
+	update := session.ID(frame.ID)
+	if frame.Selector != nil {
+		update = update.MustCols("selector")
+	}
+	_, err := update.Update(frame)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+	if frame.Applications != nil {
+		_, err = session.Where("timeframe_id = ?", frame.ID).Delete(new(v1alpha1.TimeframeApplication))
+		if err != nil {
+			session.Rollback()
+			return err
+		}
+		if err := saveTimeframeApplications(session, frame); err != nil {
+			session.Rollback()
+			return err
+		}
+	}
+	return session.Commit()
+}
 func (db *datastore) UpdateTimeframes(timeframes []*v1alpha1.Timeframe) error {
 	session := db.Engine.NewSession()
 	defer session.Close()
@@ -55,7 +147,11 @@ func (db *datastore) UpdateTimeframes(timeframes []*v1alpha1.Timeframe) error {
 	session.Begin()
 
 	for _, timeframe := range timeframes {
-		_, err := session.ID(timeframe.ID).Update(timeframe)
+		// Only the lifecycle columns are written, the other ones may have been
+		// updated through the API since the timeframes were loaded. The error
+		// and the attempts are cleared with the zero values.
+		_, err := session.ID(timeframe.ID).Cols("status", "error", "attempts", "next_attempt", "last_occurrence").
+			MustCols("status", "error", "attempts").Update(timeframe)
 		if err != nil {
 			session.Rollback()
 			return err
@@ -64,7 +160,82 @@ func (db *datastore) UpdateTimeframes(timeframes []*v1alpha1.Timeframe) error {
 	return session.Commit()
 }
 
+// DeleteTimeframe also deletes the applications of the timeframe.
 func (db *datastore) DeleteTimeframe(frame *v1alpha1.Timeframe) error {
-	_, err := db.Engine.ID(frame.ID).Delete(frame)
-	return err
+	session := db.Engine.NewSession()
+	defer session.Close()
+
+	session.Begin()
+
+	_, err := session.ID(frame.ID).Delete(frame)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+	_, err = session.Where("timeframe_id = ?", frame.ID).Delete(new(v1alpha1.TimeframeApplication))
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+	return session.Commit()
+}
+
+// saveTimeframeApplications inserts the applications of the timeframe into t_timeframe_application.
+func saveTimeframeApplications(session *xorm.Session, frame *v1alpha1.Timeframe) error {
+	for _, name := range frame.Applications {
+		application := new(v1alpha1.Application)
+		has, err := session.Where("name = ?", name).Limit(1).Get(application)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return fmt.Errorf("application %s not found", name)
+		}
+		_, err = session.Insert(&v1alpha1.TimeframeApplication{
+			TimeframeID:   frame.ID,
+			ApplicationID: application.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTimeframeApplications sets the names of the applications of the
+// timeframes, and marks the timeframes stored with applications as scoped.
+func (db *datastore) loadTimeframeApplications(frames []*v1alpha1.Timeframe) error {
+	if len(frames) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(frames))
+	for _, frame := range frames {
+		ids = append(ids, frame.ID)
+	}
+	timeframeApplications := make([]*v1alpha1.TimeframeApplication, 0)
+	err := db.Engine.In("timeframe_id", ids).Find(&timeframeApplications)
+	if err != nil || len(timeframeApplications) == 0 {
+		return err
+	}
+	applications := make([]*v1alpha1.Application, 0)
+	if err := db.Engine.Find(&applications); err != nil {
+		return err
+	}
+	names := make(map[int64]string)
+	for _, application := range applications {
+		names[application.ID] = application.Name
+	}
+	for _, frame := range frames {
+		for _, timeframeApplication := range timeframeApplications {
+			if timeframeApplication.TimeframeID != frame.ID {
+				continue
+			}
+			frame.Scoped = true
+			// Deleted applications are left out.
+			if name, ok := names[timeframeApplication.ApplicationID]; ok {
+				frame.Applications = append(frame.Applications, name)
+			}
+		}
+	}
+	return nil
 }
@@ -17,6 +17,8 @@ limitations under the License.
 package store
 
 import (
+	"time"
+
 	"github.com/angao/recommender/pkg/apis/v1alpha1"
 )
 
@@ -33,7 +35,9 @@ type Store interface {
 	DeleteApplication(application *v1alpha1.Application) error
 
 	// RecommendResource CRUD
-	GetApplicationResource(name string) (*v1alpha1.ApplicationResource, error)
+	// GetApplicationResource returns the recommendations of the application in the
+	// cluster, or the ones merged over all clusters if the cluster is empty.
+	GetApplicationResource(name, cluster string) (*v1alpha1.ApplicationResource, error)
 
 	CreateContainerResource(resource *v1alpha1.ContainerResource) error
 
@@ -41,7 +45,7 @@ type Store interface {
 
 	DeleteTimeframeResource(name string) error
 
-	ListApplicationResource() ([]*v1alpha1.ApplicationResource, error)
+	ListApplicationResource(cluster string) ([]*v1alpha1.ApplicationResource, error)
 
 	ListTimeframeApplicationResource(name string) ([]*v1alpha1.ApplicationResource, error)
 
@@ -49,11 +53,22 @@ type Store interface {
 
 	AddOrUpdateContainerResource(resource []*v1alpha1.ContainerResource) error
 
+	// Recommendation history of the application in the cluster, the timeframe recommendations are not included.
+	ListRecommendationHistory(name, cluster string, since time.Time) ([]*v1alpha1.RecommendationHistory, error)
+
+	// GetRecommendationHistoryAt returns the latest recommendation of every container at the given time.
+	GetRecommendationHistoryAt(name, cluster string, at time.Time) ([]*v1alpha1.RecommendationHistory, error)
+
+	// PruneRecommendationHistory deletes the history older than the given time, except the versions still current then.
+	PruneRecommendationHistory(before time.Time) error
+
 	// Timeframe CRUD
 	CreateTimeframe(frame *v1alpha1.Timeframe) error
 
 	GetTimeframe(name string) (*v1alpha1.Timeframe, error)
 
+	GetTimeframeByID(id int64) (*v1alpha1.Timeframe, error)
+
 	ListTimeframe() ([]*v1alpha1.Timeframe, error)
 
 	UpdateTimeframe(frame *v1alpha1.Timeframe) error
@@ -61,4 +76,15 @@ type Store interface {
 	DeleteTimeframe(frame *v1alpha1.Timeframe) error
 
 	UpdateTimeframes(timeframes []*v1alpha1.Timeframe) error
+
+	CreateProjectedTimeframe(frame *v1alpha1.Timeframe, resources []*v1alpha1.ContainerResource) error
+
+	// Checkpoint CRUD
+	ListCheckpoints() ([]*v1alpha1.Checkpoint, error)
+
+	SaveCheckpoints(applicationID int64, cluster string, checkpoints []*v1alpha1.Checkpoint) error
+
+	// DeleteStaleClusters deletes the recommendations and checkpoints of the application in the clusters
+	// other than the given ones. The recommendations merged over all clusters and of the timeframes are kept.
+	DeleteStaleClusters(applicationID int64, clusters []string) error
 }
@@ -19,6 +19,10 @@ package utils
 import (
 	"fmt"
 	"io/ioutil"
+	"regexp"
+	"time"
+
+	"github.com/angao/recommender/pkg/apis/v1alpha1"
 
 	"gopkg.in/yaml.v2"
 )
@@ -40,19 +44,120 @@ type DatabaseConfig struct {
 // PrometheusConfig defines which prometheus to connect
 type PrometheusConfig struct {
 	Address string `yaml:"address"`
+	// Step is the resolution of range queries, default is 5m
+	Step string `yaml:"step"`
+	// ChunkSize is the longest range of a single range query, longer ranges
+	// are split into chunks of this size, default is 1d
+	ChunkSize string `yaml:"chunkSize"`
+	// ChunkConcurrency is the number of chunks of a range queried at once, default is 4
+	ChunkConcurrency int `yaml:"chunkConcurrency"`
+	// BatchSize enables the batch mode if positive: every resource is queried
+	// once for up to this many applications instead of once per application
+	BatchSize int `yaml:"batchSize"`
+	// LabelSchema is the default label schema of all applications, default
+	// matches the series of cAdvisor with the system_mwType_serviceID label
+	LabelSchema v1alpha1.LabelSchema `yaml:"labelSchema"`
+	// Queries are the Go templates of the usage queries keyed by resource
+	// name, with the placeholders {{.Selector}}, {{.Range}} and {{.Offset}},
+	// default queries the recording rules of rates over 1m
+	Queries map[string]string `yaml:"queries"`
+	// Offset is the offset of the usage queries, e.g. 1m, default is none
+	Offset string `yaml:"offset"`
+	// Timeout is the timeout of a request to Prometheus, default is 2m
+	Timeout string `yaml:"timeout"`
+	// QPS limits the queries per second to this Prometheus, default is 0 for no limit
+	QPS float64 `yaml:"qps"`
+	// BearerToken is sent in the Authorization header
+	BearerToken string `yaml:"bearerToken"`
+	// BearerTokenFile is read for the bearer token, and read again once modified
+	BearerTokenFile string `yaml:"bearerTokenFile"`
+	// BasicAuth is the basic auth of the requests, exclusive with the bearer token
+	BasicAuth *BasicAuth `yaml:"basicAuth"`
+	// TLSConfig configures the TLS connections to Prometheus
+	TLSConfig TLSConfig `yaml:"tlsConfig"`
+	// Headers are extra headers of the requests, e.g. X-Scope-OrgID
+	Headers map[string]string `yaml:"headers"`
+	// ProxyURL is the proxy of the requests, default is the proxy of the environment
+	ProxyURL string `yaml:"proxyURL"`
+}
+
+// BasicAuth defines the basic auth credentials
+type BasicAuth struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// PasswordFile is read for the password, and read again once modified
+	PasswordFile string `yaml:"passwordFile"`
+}
+
+// TLSConfig defines how to verify the server and authenticate the client
+type TLSConfig struct {
+	// CAFile is the CA certificate the server is verified with, default is the system pool
+	CAFile string `yaml:"caFile"`
+	// CertFile and KeyFile are the client certificate and its key
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// ServerName is the name the server certificate is verified against
+	ServerName         string `yaml:"serverName"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
 }
 
 // ExtraConfig defines extra config
 type ExtraConfig struct {
 	APIPort int    `yaml:"apiPort"`
 	History string `yaml:"history"`
+	// HistoryRetention is how long the recommendation history is kept, default is 90d
+	HistoryRetention string `yaml:"historyRetention"`
+	// MaxTimeframeWindows is the number of the latest occurrences of a recurring
+	// timeframe its recommendation is computed from, default is 100
+	MaxTimeframeWindows int `yaml:"maxTimeframeWindows"`
+}
+
+// RecommenderConfig defines how usage samples are turned into recommendations
+type RecommenderConfig struct {
+	// HistogramHalfLife is the time after which a usage sample loses half of its weight, default is 24h
+	HistogramHalfLife string `yaml:"histogramHalfLife"`
+	// RecommendationPolicy is the default policy of all applications, default is percentile
+	v1alpha1.RecommendationPolicy `yaml:",inline"`
+	// UpdatePolicy is the default update policy of all applications, default is ratchet
+	UpdatePolicy v1alpha1.UpdatePolicy `yaml:"updatePolicy"`
+}
+
+// ClusterConfig defines a Kubernetes cluster and the Prometheus its metrics
+// are read from
+type ClusterConfig struct {
+	Name string `yaml:"name"`
+	// PrometheusConfig overrides the fields set in the global prometheusConfig
+	PrometheusConfig PrometheusConfig `yaml:"prometheusConfig"`
 }
 
 // GlobalConfig defines global config
 type GlobalConfig struct {
 	DatabaseConfig   DatabaseConfig   `yaml:"databaseConfig"`
 	PrometheusConfig PrometheusConfig `yaml:"prometheusConfig"`
-	ExtraConfig      ExtraConfig      `yaml:"extraConfig"`
+	// Clusters are the clusters the applications run in, each with its own
+	// Prometheus. If empty, the metrics are read from prometheusConfig only.
+	Clusters          []ClusterConfig   `yaml:"clusters"`
+	RecommenderConfig RecommenderConfig `yaml:"recommenderConfig"`
+	ExtraConfig       ExtraConfig       `yaml:"extraConfig"`
+}
+
+// MetricSources returns the clusters the metrics are read from, or a single
+// unnamed one with the global Prometheus config if no clusters are configured.
+func (g *GlobalConfig) MetricSources() []ClusterConfig {
+	if len(g.Clusters) == 0 {
+		return []ClusterConfig{{PrometheusConfig: g.PrometheusConfig}}
+	}
+	return g.Clusters
+}
+
+// HasCluster returns true if the cluster is configured.
+func (g *GlobalConfig) HasCluster(name string) bool {
+	for _, cluster := range g.Clusters {
+		if cluster.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
 // Format is stringify DatabaseConfig
@@ -87,5 +192,204 @@ func Unmarshal(filename string) (*GlobalConfig, error) {
 	if len(globalConfig.ExtraConfig.History) == 0 {
 		globalConfig.ExtraConfig.History = "30d"
 	}
+	if _, err := ParseDuration(globalConfig.ExtraConfig.History); err != nil {
+		return nil, fmt.Errorf("extraConfig.history: %v", err)
+	}
+	// setting default number of the occurrences of a recurring timeframe
+	if globalConfig.ExtraConfig.MaxTimeframeWindows == 0 {
+		globalConfig.ExtraConfig.MaxTimeframeWindows = 100
+	}
+	if globalConfig.ExtraConfig.MaxTimeframeWindows < 0 {
+		return nil, fmt.Errorf("extraConfig.maxTimeframeWindows must be positive: %d", globalConfig.ExtraConfig.MaxTimeframeWindows)
+	}
+	// setting default recommendation history retention
+	if len(globalConfig.ExtraConfig.HistoryRetention) == 0 {
+		globalConfig.ExtraConfig.HistoryRetention = "90d"
+	}
+	if retention, err := ParseDuration(globalConfig.ExtraConfig.HistoryRetention); err != nil || retention <= 0 {
+		return nil, fmt.Errorf("extraConfig.historyRetention must be a positive duration: %q", globalConfig.ExtraConfig.HistoryRetention)
+	}
+	if err := setPrometheusDefaults(&globalConfig.PrometheusConfig); err != nil {
+		return nil, fmt.Errorf("prometheusConfig.%v", err)
+	}
+	if err := unmarshalClusters(data, globalConfig); err != nil {
+		return nil, err
+	}
+	// setting default histogram decay half life
+	if len(globalConfig.RecommenderConfig.HistogramHalfLife) == 0 {
+		globalConfig.RecommenderConfig.HistogramHalfLife = "24h"
+	}
+	if halfLife, err := ParseDuration(globalConfig.RecommenderConfig.HistogramHalfLife); err != nil || halfLife <= 0 {
+		return nil, fmt.Errorf("recommenderConfig.histogramHalfLife must be a positive duration: %q", globalConfig.RecommenderConfig.HistogramHalfLife)
+	}
+	// setting default recommendation policy
+	if len(globalConfig.RecommenderConfig.Name) == 0 {
+		globalConfig.RecommenderConfig.Name = v1alpha1.PolicyPercentile
+	}
+	// setting default update policy
+	updatePolicy := &globalConfig.RecommenderConfig.UpdatePolicy
+	if len(updatePolicy.Mode) == 0 {
+		updatePolicy.Mode = v1alpha1.UpdateModeRatchet
+	}
+	if updatePolicy.Threshold == 0 {
+		updatePolicy.Threshold = 10
+	}
+	if updatePolicy.Runs == 0 {
+		updatePolicy.Runs = 3
+	}
 	return globalConfig, nil
 }
+
+var clusterNameRE = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// unmarshalClusters decodes the clusters again, each on top of the global
+// Prometheus config, so that a cluster only sets what differs, e.g. the address.
+func unmarshalClusters(data []byte, globalConfig *GlobalConfig) error {
+	raw := struct {
+		Clusters []struct {
+			Name             string        `yaml:"name"`
+			PrometheusConfig yaml.MapSlice `yaml:"prometheusConfig"`
+		} `yaml:"clusters"`
+	}{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	globalConfig.Clusters = make([]ClusterConfig, 0, len(raw.Clusters))
+	names := make(map[string]bool)
+	for i, cluster := range raw.Clusters {
+		if !clusterNameRE.MatchString(cluster.Name) {
+			return fmt.Errorf("clusters[%d].name must be a DNS label: %q", i, cluster.Name)
+		}
+		if names[cluster.Name] {
+			return fmt.Errorf("clusters[%d].name is duplicated: %q", i, cluster.Name)
+		}
+		names[cluster.Name] = true
+
+		config := copyPrometheusConfig(globalConfig.PrometheusConfig)
+		if len(cluster.PrometheusConfig) != 0 {
+			override, err := yaml.Marshal(cluster.PrometheusConfig)
+			if err != nil {
+				return err
+			}
+			if err := yaml.Unmarshal(override, &config); err != nil {
+				return fmt.Errorf("clusters[%d].prometheusConfig: %v", i, err)
+			}
+		}
+		if err := setPrometheusDefaults(&config); err != nil {
+			return fmt.Errorf("clusters[%d].prometheusConfig.%v", i, err)
+		}
+		// The usage samples of all clusters are aggregated at the same resolution.
+		if config.Step != globalConfig.PrometheusConfig.Step {
+			return fmt.Errorf("clusters[%d].prometheusConfig.step must be the global step %q", i, globalConfig.PrometheusConfig.Step)
+		}
+		globalConfig.Clusters = append(globalConfig.Clusters, ClusterConfig{Name: cluster.Name, PrometheusConfig: config})
+	}
+	return nil
+}
+
+// copyPrometheusConfig copies the maps and pointers of the config, which
+// decoding would otherwise modify in place.
+func copyPrometheusConfig(config PrometheusConfig) PrometheusConfig {
+	copied := config
+	if config.Queries != nil {
+		copied.Queries = make(map[string]string, len(config.Queries))
+		for k, v := range config.Queries {
+			copied.Queries[k] = v
+		}
+	}
+	if config.Headers != nil {
+		copied.Headers = make(map[string]string, len(config.Headers))
+		for k, v := range config.Headers {
+			copied.Headers[k] = v
+		}
+	}
+	if config.BasicAuth != nil {
+		basicAuth := *config.BasicAuth
+		copied.BasicAuth = &basicAuth
+	}
+	copied.LabelSchema.Instance = append([]string(nil), config.LabelSchema.Instance...)
+	return copied
+}
+
+// setPrometheusDefaults sets the defaults of the Prometheus config and validates it.
+func setPrometheusDefaults(config *PrometheusConfig) error {
+	// setting default prometheus range query resolution
+	if len(config.Step) == 0 {
+		config.Step = "5m"
+	}
+	if step, err := ParseDuration(config.Step); err != nil || step < time.Second {
+		return fmt.Errorf("step must be a duration of at least 1s: %q", config.Step)
+	}
+	// setting default range query chunks
+	if len(config.ChunkSize) == 0 {
+		config.ChunkSize = "1d"
+	}
+	step, _ := ParseDuration(config.Step)
+	if chunkSize, err := ParseDuration(config.ChunkSize); err != nil || chunkSize < step {
+		return fmt.Errorf("chunkSize must be a duration of at least the step: %q", config.ChunkSize)
+	}
+	if config.ChunkConcurrency == 0 {
+		config.ChunkConcurrency = 4
+	}
+	if config.ChunkConcurrency < 0 {
+		return fmt.Errorf("chunkConcurrency must be positive: %d", config.ChunkConcurrency)
+	}
+	if offset := config.Offset; len(offset) != 0 {
+		if _, err := ParseDuration(offset); err != nil {
+			return fmt.Errorf("offset: %v", err)
+		}
+	}
+	// setting default prometheus request timeout
+	if len(config.Timeout) == 0 {
+		config.Timeout = "2m"
+	}
+	if timeout, err := ParseDuration(config.Timeout); err != nil || timeout <= 0 {
+		return fmt.Errorf("timeout must be a positive duration: %q", config.Timeout)
+	}
+	if config.QPS < 0 {
+		return fmt.Errorf("qps must not be negative: %v", config.QPS)
+	}
+	if err := validatePrometheusAuth(config); err != nil {
+		return err
+	}
+	if config.BatchSize < 0 {
+		return fmt.Errorf("batchSize must not be negative: %d", config.BatchSize)
+	}
+	// setting default label schema
+	labelSchema := &config.LabelSchema
+	if len(labelSchema.Application) == 0 {
+		labelSchema.Application = "system_mwType_serviceID"
+	}
+	if len(labelSchema.Container) == 0 {
+		labelSchema.Container = "container_name"
+	}
+	if len(labelSchema.Instance) == 0 {
+		labelSchema.Instance = []string{"name"}
+	}
+	if len(labelSchema.Selector) == 0 {
+		labelSchema.Selector = `pod_name=~"^.*$",container_name!="POD",image!="",name=~"^k8s_.*"`
+	}
+	return nil
+}
+
+// validatePrometheusAuth checks that at most one way of authentication is configured.
+func validatePrometheusAuth(config *PrometheusConfig) error {
+	if len(config.BearerToken) != 0 && len(config.BearerTokenFile) != 0 {
+		return fmt.Errorf("bearerToken and bearerTokenFile are mutually exclusive")
+	}
+	if basicAuth := config.BasicAuth; basicAuth != nil {
+		if len(config.BearerToken) != 0 || len(config.BearerTokenFile) != 0 {
+			return fmt.Errorf("basicAuth and the bearer token are mutually exclusive")
+		}
+		if len(basicAuth.Username) == 0 {
+			return fmt.Errorf("basicAuth.username cannot be empty")
+		}
+		if len(basicAuth.Password) != 0 && len(basicAuth.PasswordFile) != 0 {
+			return fmt.Errorf("basicAuth.password and basicAuth.passwordFile are mutually exclusive")
+		}
+	}
+	if (len(config.TLSConfig.CertFile) == 0) != (len(config.TLSConfig.KeyFile) == 0) {
+		return fmt.Errorf("tlsConfig.certFile and tlsConfig.keyFile must be set together")
+	}
+	return nil
+}
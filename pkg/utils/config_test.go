@@ -0,0 +1,111 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func unmarshalString(t *testing.T, config string) (*GlobalConfig, error) {
+	f, err := ioutil.TempFile("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(config); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	return Unmarshal(f.Name())
+}
+
+func TestUnmarshalClusters(t *testing.T) {
+	globalConfig, err := unmarshalString(t, `
+prometheusConfig:
+  address: "http://prometheus:9090"
+  batchSize: 50
+  headers:
+    X-Scope-OrgID: "shared"
+  labelSchema:
+    container: "container"
+clusters:
+- name: bj
+- name: sh
+  prometheusConfig:
+    address: "http://prometheus.sh:9090"
+    headers:
+      X-Scope-OrgID: "sh"
+    labelSchema:
+      instance: ["namespace", "pod"]
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sources := globalConfig.MetricSources()
+	if len(sources) != 2 {
+		t.Fatalf("expected 2 clusters, got %d", len(sources))
+	}
+	bj, sh := sources[0].PrometheusConfig, sources[1].PrometheusConfig
+	if bj.Address != "http://prometheus:9090" || bj.BatchSize != 50 || bj.Step != "5m" {
+		t.Errorf("expected bj to inherit the global config, got %+v", bj)
+	}
+	if sh.Address != "http://prometheus.sh:9090" || sh.BatchSize != 50 || sh.Headers["X-Scope-OrgID"] != "sh" {
+		t.Errorf("expected sh to override the address and headers, got %+v", sh)
+	}
+	if sh.LabelSchema.Container != "container" || strings.Join(sh.LabelSchema.Instance, ",") != "namespace,pod" {
+		t.Errorf("expected sh to override the instance labels only, got %+v", sh.LabelSchema)
+	}
+	if globalConfig.PrometheusConfig.Headers["X-Scope-OrgID"] != "shared" || strings.Join(globalConfig.PrometheusConfig.LabelSchema.Instance, ",") != "name" {
+		t.Errorf("expected the global config not to be modified, got %+v", globalConfig.PrometheusConfig)
+	}
+	if !globalConfig.HasCluster("sh") || globalConfig.HasCluster("gz") {
+		t.Errorf("unexpected clusters %+v", globalConfig.Clusters)
+	}
+}
+
+func TestUnmarshalClustersErrors(t *testing.T) {
+	cases := []struct {
+		config string
+		err    string
+	}{
+		{"clusters:\n- name: Beijing\n", "clusters[0].name must be a DNS label"},
+		{"clusters:\n- name: bj\n- name: bj\n", "clusters[1].name is duplicated"},
+		{"clusters:\n- name: bj\n  prometheusConfig:\n    step: 1m\n", "clusters[0].prometheusConfig.step must be the global step"},
+		{"clusters:\n- name: bj\n  prometheusConfig:\n    batchSize: -1\n", "clusters[0].prometheusConfig.batchSize"},
+		{"clusters:\n- name: bj\n  prometheusConfig:\n    qps: -1\n", "clusters[0].prometheusConfig.qps must not be negative"},
+	}
+	for _, c := range cases {
+		_, err := unmarshalString(t, c.config)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: got error %v, want %s", c.config, err, c.err)
+		}
+	}
+}
+
+func TestMetricSourcesWithoutClusters(t *testing.T) {
+	globalConfig, err := unmarshalString(t, "prometheusConfig:\n  address: \"http://prometheus:9090\"\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sources := globalConfig.MetricSources()
+	if len(sources) != 1 || sources[0].Name != "" || sources[0].PrometheusConfig.Address != "http://prometheus:9090" {
+		t.Errorf("expected the global Prometheus only, got %+v", sources)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+const layout = "2006-01-02 15:04"
+
+func TestNext(t *testing.T) {
+	for _, c := range []struct {
+		spec, from, want string
+	}{
+		{"0 9 * * mon", "2018-10-16 12:00", "2018-10-22 09:00"},
+		{"0 9 * * 1", "2018-10-22 08:59", "2018-10-22 09:00"},
+		{"0 9 * * 1", "2018-10-22 09:00", "2018-10-29 09:00"},
+		{"30 2 * * *", "2018-10-16 12:00", "2018-10-17 02:30"},
+		{"*/15 * * * *", "2018-10-16 12:01", "2018-10-16 12:15"},
+		{"0 22 L * *", "2018-02-10 00:00", "2018-02-28 22:00"},
+		{"0 0 1,15 * 5", "2018-10-02 00:00", "2018-10-05 00:00"},
+		{"0 0 * * 7", "2018-10-16 00:00", "2018-10-21 00:00"},
+		{"@monthly", "2018-12-16 00:00", "2019-01-01 00:00"},
+		{"0 0 29 feb *", "2018-03-01 00:00", "2020-02-29 00:00"},
+	} {
+		schedule, err := Parse(c.spec)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.spec, err)
+			continue
+		}
+		from, _ := time.ParseInLocation(layout, c.from, time.UTC)
+		if got := schedule.Next(from).Format(layout); got != c.want {
+			t.Errorf("%q after %s: got %s, want %s", c.spec, c.from, got, c.want)
+		}
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	schedule, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		t.Errorf("expected no activation, got %v", next)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	schedule, _ := Parse("0 9 * * 1-5")
+	start := time.Date(2018, 10, 14, 9, 0, 0, 0, time.UTC)
+	end := time.Date(2018, 10, 22, 9, 0, 0, 0, time.UTC)
+	// Monday to Friday, and the Monday at the end is included.
+	if got := len(schedule.Between(start, end)); got != 6 {
+		t.Errorf("expected 6 activations, got %d", got)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "*/0 * * * *", "5-1 * * * *", "* * * * foo"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var durationRE = regexp.MustCompile("^([0-9]+)(y|w|d|h|m|s|ms)$")
+
+// ParseDuration parses a duration in Prometheus format (e.g. "30d", "5m"),
+// falling back to Go duration syntax (e.g. "1h30m").
+func ParseDuration(s string) (time.Duration, error) {
+	matches := durationRE.FindStringSubmatch(s)
+	if matches == nil {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("not a valid duration string: %q", s)
+		}
+		return d, nil
+	}
+	n, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("not a valid duration string: %q", s)
+	}
+	unit := time.Duration(0)
+	switch matches[2] {
+	case "y":
+		unit = 365 * 24 * time.Hour
+	case "w":
+		unit = 7 * 24 * time.Hour
+	case "d":
+		unit = 24 * time.Hour
+	case "h":
+		unit = time.Hour
+	case "m":
+		unit = time.Minute
+	case "s":
+		unit = time.Second
+	case "ms":
+		unit = time.Millisecond
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// FormatDuration formats a duration the way PromQL range selectors expect it.
+func FormatDuration(d time.Duration) string {
+	if d%time.Second != 0 {
+		return fmt.Sprintf("%dms", int64(d/time.Millisecond))
+	}
+	return fmt.Sprintf("%ds", int64(d/time.Second))
+}
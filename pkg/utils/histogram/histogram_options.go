@@ -0,0 +1,93 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package histogram
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// HistogramOptions define the number and size of buckets of a histogram.
+type HistogramOptions interface {
+	// Returns the number of buckets in the histogram.
+	NumBuckets() int
+	// Returns the index of the bucket to which the given value falls.
+	// If the value is outside of the range covered by the histogram, it
+	// returns the closest bucket (either the first or the last one).
+	FindBucket(value float64) int
+	// Returns the start of the bucket with a given index. If the index is
+	// outside the [0..NumBuckets() - 1] range, the result is undefined.
+	GetBucketStart(bucket int) float64
+	// Returns the minimum weight for a bucket to be considered non-empty.
+	Epsilon() float64
+}
+
+// NewExponentialHistogramOptions returns HistogramOptions describing a
+// histogram with exponentially growing bucket boundaries. The first bucket
+// covers the range [0..firstBucketSize). Bucket with index n has size equal
+// to firstBucketSize * ratio^n. It follows that the bucket with index n >= 1
+// starts at:
+//
+//	firstBucketSize * (1 + ratio + ratio^2 + ... + ratio^(n-1)) =
+//	firstBucketSize * (ratio^n - 1) / (ratio - 1).
+//
+// The last bucket start is larger or equal to maxValue.
+// Requires maxValue > 0, firstBucketSize > 0, ratio > 1, epsilon > 0.
+func NewExponentialHistogramOptions(maxValue float64, firstBucketSize float64, ratio float64, epsilon float64) (HistogramOptions, error) {
+	if maxValue <= 0.0 || firstBucketSize <= 0.0 || ratio <= 1.0 || epsilon <= 0.0 {
+		return nil, errors.New("maxValue, firstBucketSize and epsilon must be > 0.0, ratio must be > 1.0")
+	}
+	numBuckets := int(math.Ceil(math.Log(maxValue*(ratio-1)/firstBucketSize+1)/math.Log(ratio))) + 1
+	if numBuckets < 1 {
+		return nil, fmt.Errorf("invalid number of buckets: %d", numBuckets)
+	}
+	return &exponentialHistogramOptions{numBuckets, firstBucketSize, ratio, epsilon}, nil
+}
+
+type exponentialHistogramOptions struct {
+	numBuckets      int
+	firstBucketSize float64
+	ratio           float64
+	epsilon         float64
+}
+
+func (o *exponentialHistogramOptions) NumBuckets() int {
+	return o.numBuckets
+}
+
+func (o *exponentialHistogramOptions) FindBucket(value float64) int {
+	if value < o.firstBucketSize {
+		return 0
+	}
+	bucket := int(math.Log(value*(o.ratio-1)/o.firstBucketSize+1) / math.Log(o.ratio))
+	if bucket >= o.numBuckets {
+		return o.numBuckets - 1
+	}
+	return bucket
+}
+
+func (o *exponentialHistogramOptions) GetBucketStart(bucket int) float64 {
+	if bucket == 0 {
+		return 0.0
+	}
+	return o.firstBucketSize * (math.Pow(o.ratio, float64(bucket)) - 1) / (o.ratio - 1)
+}
+
+func (o *exponentialHistogramOptions) Epsilon() float64 {
+	return o.epsilon
+}
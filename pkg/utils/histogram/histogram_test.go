@@ -0,0 +1,117 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package histogram
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var (
+	testOptions, _ = NewExponentialHistogramOptions(1000, 1, 1.05, 0.0001)
+	startTime      = time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func TestExponentialBuckets(t *testing.T) {
+	for bucket := 1; bucket < testOptions.NumBuckets(); bucket++ {
+		start := testOptions.GetBucketStart(bucket)
+		if found := testOptions.FindBucket(start * 1.0001); found != bucket {
+			t.Errorf("value %v: expected bucket %d, got %d", start, bucket, found)
+		}
+	}
+	if last := testOptions.GetBucketStart(testOptions.NumBuckets() - 1); last < 1000 {
+		t.Errorf("last bucket starts at %v, expected >= 1000", last)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	h := NewHistogram(testOptions)
+	if !h.IsEmpty() || h.Percentile(0.5) != 0 {
+		t.Fatalf("new histogram should be empty")
+	}
+	for i := 1; i <= 100; i++ {
+		h.AddSample(float64(i), 1, startTime)
+	}
+	for _, p := range []float64{0.5, 0.95, 0.99} {
+		got := h.Percentile(p)
+		want := 100 * p
+		// Percentile returns the end of the bucket, which is at most 5% off.
+		if got < want || got > want*1.05+1 {
+			t.Errorf("percentile %v: got %v, want about %v", p, got, want)
+		}
+	}
+}
+
+func TestDecayingHistogramPrefersRecentSamples(t *testing.T) {
+	h := NewDecayingHistogram(testOptions, time.Hour)
+	// An old spike followed by recent low usage with equal sample counts.
+	h.AddSample(500, 1, startTime)
+	h.AddSample(10, 1, startTime.Add(10*time.Hour))
+	if got := h.Percentile(0.99); got > 12 {
+		t.Errorf("old spike should have decayed, got P99 %v", got)
+	}
+}
+
+func TestDecayingHistogramMerge(t *testing.T) {
+	h1 := NewDecayingHistogram(testOptions, time.Hour)
+	h2 := NewDecayingHistogram(testOptions, time.Hour)
+	h1.AddSample(10, 1, startTime)
+	h2.AddSample(100, 1, startTime.Add(200*time.Hour))
+	h1.Merge(h2)
+	if got := h1.Percentile(0.5); math.Abs(got-100) > 6 {
+		t.Errorf("expected merged median close to 100, got %v", got)
+	}
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	h := NewDecayingHistogram(testOptions, time.Hour)
+	for i := 1; i <= 100; i++ {
+		h.AddSample(float64(i), 1, startTime.Add(time.Duration(i)*time.Minute))
+	}
+	checkpoint, err := h.SaveToCheckpoint()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	loaded := NewDecayingHistogram(testOptions, time.Hour)
+	if err := loaded.LoadFromCheckpoint(checkpoint); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, p := range []float64{0.1, 0.5, 0.95} {
+		if got, want := loaded.Percentile(p), h.Percentile(p); got != want {
+			t.Errorf("percentile %v: got %v, want %v", p, got, want)
+		}
+	}
+	// Samples added after loading weigh the same as in the original histogram.
+	h.AddSample(500, 50, startTime.Add(3*time.Hour))
+	loaded.AddSample(500, 50, startTime.Add(3*time.Hour))
+	if got, want := loaded.Percentile(0.5), h.Percentile(0.5); got != want {
+		t.Errorf("median after adding samples: got %v, want %v", got, want)
+	}
+}
+
+func TestLoadInvalidCheckpoint(t *testing.T) {
+	h := NewHistogram(testOptions)
+	if err := h.LoadFromCheckpoint(nil); err == nil {
+		t.Errorf("expected error loading nil checkpoint")
+	}
+	checkpoint, _ := h.SaveToCheckpoint()
+	checkpoint.BucketWeights[testOptions.NumBuckets()] = 1
+	if err := h.LoadFromCheckpoint(checkpoint); err == nil {
+		t.Errorf("expected error loading bucket out of range")
+	}
+}
@@ -0,0 +1,346 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ical parses the events of iCalendar (RFC 5545) files and expands
+// their recurrences.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a VEVENT of a calendar.
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Start       time.Time
+	End         time.Time
+	// AllDay is set if the event starts and ends on dates instead of times.
+	AllDay bool
+	// RRule is the recurrence rule of the event, nil if it doesn't recur.
+	RRule *RRule
+	// ExDates are the starts of the occurrences excluded from the recurrence.
+	ExDates []time.Time
+	// RecurrenceID is the start of the occurrence of the recurring event with
+	// the same UID this event replaces, zero if it replaces none.
+	RecurrenceID time.Time
+	// Skipped is the reason the event can't be imported, e.g. it is cancelled
+	// or its time zone is unknown, empty if it can.
+	Skipped string
+}
+
+// Occurrence is a single occurrence of an event.
+type Occurrence struct {
+	Start time.Time
+	End   time.Time
+}
+
+// property is a content line of a calendar.
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parse returns the events of the calendar. The events which can't be
+// imported, e.g. cancelled events or events in an unknown time zone, are
+// returned with the reason in Skipped instead of failing the whole calendar.
+func Parse(r io.Reader) ([]*Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	// The VTIMEZONE components may follow the events using them, so the
+	// events are built once the whole calendar is read.
+	components := make([]*component, 0)
+	var current *component
+	// depth counts the components nested in the current VEVENT or VTIMEZONE,
+	// e.g. VALARM, STANDARD or DAYLIGHT.
+	depth := 0
+	for i, line := range lines {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		p, err := parseProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		value := strings.ToUpper(p.value)
+		switch {
+		case p.name == "BEGIN" && (value == "VEVENT" || value == "VTIMEZONE") && current == nil:
+			current = &component{name: value, end: i + 1}
+		case p.name == "BEGIN" && current != nil:
+			if current.name == "VTIMEZONE" && value == "DAYLIGHT" {
+				current.daylight = true
+			}
+			depth++
+		case p.name == "END" && current != nil && depth > 0:
+			depth--
+		case p.name == "END" && current != nil && value == current.name:
+			current.end = i + 1
+			components = append(components, current)
+			current = nil
+		case current != nil && (depth == 0 || current.name == "VTIMEZONE"):
+			current.properties = append(current.properties, p)
+		}
+	}
+	if current != nil {
+		return nil, fmt.Errorf("unterminated %s", current.name)
+	}
+
+	zones := make(timeZones)
+	for _, c := range components {
+		if c.name == "VTIMEZONE" {
+			zones.add(c)
+		}
+	}
+	events := make([]*Event, 0)
+	for _, c := range components {
+		if c.name != "VEVENT" {
+			continue
+		}
+		event, err := newEvent(c.properties, zones)
+		if err != nil {
+			return nil, fmt.Errorf("event ending at line %d: %v", c.end, err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// component is a VEVENT or a VTIMEZONE of a calendar.
+type component struct {
+	name       string
+	properties []*property
+	// daylight is set if a VTIMEZONE has daylight saving time rules.
+	daylight bool
+	// end is the line the component ends at.
+	end int
+}
+
+// unfold joins the folded lines of the calendar.
+func unfold(r io.Reader) ([]string, error) {
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseProperty parses a content line: name *(";" param) ":" value.
+func parseProperty(line string) (*property, error) {
+	p := &property{params: make(map[string]string)}
+	quoted := false
+	start := 0
+	var key string
+	for i, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '=' && len(p.name) != 0 && len(key) == 0:
+			key = strings.ToUpper(line[start:i])
+			start = i + 1
+		case c == ';' || c == ':':
+			if len(p.name) == 0 {
+				p.name = strings.ToUpper(line[:i])
+			} else if len(key) != 0 {
+				p.params[key] = strings.Trim(line[start:i], `"`)
+				key = ""
+			}
+			start = i + 1
+			if c == ':' {
+				p.value = line[i+1:]
+				return p, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("invalid content line %q", line)
+}
+
+func newEvent(properties []*property, zones timeZones) (*Event, error) {
+	event := &Event{}
+	var duration time.Duration
+	var hasEnd bool
+	for _, p := range properties {
+		var err error
+		switch p.name {
+		case "STATUS":
+			if strings.ToUpper(p.value) == "CANCELLED" {
+				event.Skipped = "the event is cancelled"
+			}
+		case "UID":
+			event.UID = unescape(p.value)
+		case "SUMMARY":
+			event.Summary = unescape(p.value)
+		case "DESCRIPTION":
+			event.Description = unescape(p.value)
+		case "DTSTART":
+			event.Start, event.AllDay, err = zones.parseTime(p.value, p.params)
+		case "DTEND":
+			event.End, _, err = zones.parseTime(p.value, p.params)
+			hasEnd = true
+		case "DURATION":
+			duration, err = parseDuration(p.value)
+			hasEnd = true
+		case "RRULE":
+			event.RRule, err = parseRRule(p.value)
+		case "EXDATE":
+			for _, value := range strings.Split(p.value, ",") {
+				var exDate time.Time
+				if exDate, _, err = zones.parseTime(value, p.params); err != nil {
+					break
+				}
+				event.ExDates = append(event.ExDates, exDate)
+			}
+		case "RECURRENCE-ID":
+			event.RecurrenceID, _, err = zones.parseTime(p.value, p.params)
+		}
+		if zoneErr, ok := err.(*unknownZoneError); ok {
+			event.Skipped = zoneErr.Error()
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", p.name, err)
+		}
+	}
+	if len(event.Skipped) != 0 {
+		return event, nil
+	}
+	if event.Start.IsZero() {
+		return nil, fmt.Errorf("DTSTART is missing")
+	}
+	switch {
+	case duration != 0:
+		event.End = event.Start.Add(duration)
+	case !hasEnd && event.AllDay:
+		event.End = event.Start.AddDate(0, 0, 1)
+	case !hasEnd:
+		event.End = event.Start
+	}
+	if event.End.Before(event.Start) {
+		return nil, fmt.Errorf("event ends before it starts")
+	}
+	if event.RRule != nil && !event.RRule.Until.IsZero() && event.RRule.untilFloating {
+		// A floating UNTIL is in the time zone of the start.
+		until := event.RRule.Until
+		event.RRule.Until = time.Date(until.Year(), until.Month(), until.Day(), until.Hour(), until.Minute(), until.Second(), 0, event.Start.Location())
+	}
+	return event, nil
+}
+
+func unescape(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// parseTime parses a DATE or a DATE-TIME value of a property, in the time
+// zone of its TZID parameter if there is one and local otherwise.
+func (zones timeZones) parseTime(value string, params map[string]string) (time.Time, bool, error) {
+	location := time.Local
+	if tzid, ok := params["TZID"]; ok {
+		var err error
+		if location, err = zones.location(tzid); err != nil {
+			return time.Time{}, false, err
+		}
+	}
+	return parseTime(value, params, location)
+}
+
+// parseTime parses a DATE or a DATE-TIME value. A DATE-TIME is in UTC if it
+// ends with Z and in the location otherwise. A DATE is the midnight of the day.
+func parseTime(value string, params map[string]string, location *time.Location) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, location)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, location)
+	return t, false, err
+}
+
+var durationRE = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseDuration parses a DURATION value, e.g. P1D or PT2H30M.
+func parseDuration(value string) (time.Duration, error) {
+	matches := durationRE.FindStringSubmatch(value)
+	if matches == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	var duration time.Duration
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if len(matches[i+2]) == 0 {
+			continue
+		}
+		n, err := strconv.Atoi(matches[i+2])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		duration += time.Duration(n) * unit
+	}
+	if matches[1] == "-" {
+		return 0, fmt.Errorf("negative duration %q", value)
+	}
+	return duration, nil
+}
+
+// Occurrences returns at most limit occurrences of the event overlapping the
+// period from start to end. The excluded occurrences and the occurrences
+// replaced by the overrides are left out.
+func Occurrences(event *Event, overrides []*Event, start, end time.Time, limit int) []Occurrence {
+	excluded := make([]time.Time, 0, len(event.ExDates)+len(overrides))
+	excluded = append(excluded, event.ExDates...)
+	for _, override := range overrides {
+		excluded = append(excluded, override.RecurrenceID)
+	}
+	occurrences := make([]Occurrence, 0)
+	duration := event.End.Sub(event.Start)
+	for _, t := range event.RRule.starts(event.Start, end) {
+		if len(occurrences) >= limit {
+			break
+		}
+		if t.Add(duration).Before(start) || containsTime(excluded, t) {
+			continue
+		}
+		occurrences = append(occurrences, Occurrence{Start: t, End: t.Add(duration)})
+	}
+	return occurrences
+}
+
+func containsTime(times []time.Time, t time.Time) bool {
+	for _, other := range times {
+		if other.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const layout = "2006-01-02 15:04"
+
+const calendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:sale@example.com\r\n" +
+	"SUMMARY:Weekend sale\\, online\r\n" +
+	"DTSTART;TZID=Asia/Shanghai:20181103T200000\r\n" +
+	"DTEND;TZID=Asia/Shanghai:20181104T020000\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=SA;COUNT=4\r\n" +
+	"EXDATE;TZID=Asia/Shanghai:20181110T200000\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:DISPLAY\r\n" +
+	"DESCRIPTION:Reminder\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:sale@example.com\r\n" +
+	"SUMMARY:Weekend sale\r\n" +
+	"RECURRENCE-ID;TZID=Asia/Shanghai:20181117T200000\r\n" +
+	"DTSTART;TZID=Asia/Shanghai:20181117T180000\r\n" +
+	"DURATION:PT10H\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:singles-day@example.com\r\n" +
+	"SUMMARY:Singles\r\n" +
+	"  Day\r\n" +
+	"DTSTART;VALUE=DATE:20181111\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse(t *testing.T) {
+	events, err := Parse(strings.NewReader(calendar))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+	sale, override, day := events[0], events[1], events[2]
+	if sale.Summary != "Weekend sale, online" || sale.RRule == nil || len(sale.ExDates) != 1 {
+		t.Errorf("unexpected event %+v", sale)
+	}
+	if got := sale.Start.UTC().Format(layout); got != "2018-11-03 12:00" {
+		t.Errorf("start: got %s, want 2018-11-03 12:00 UTC", got)
+	}
+	if got := override.End.Sub(override.Start); got != 10*time.Hour {
+		t.Errorf("override duration: got %v, want 10h", got)
+	}
+	if day.Summary != "Singles Day" || !day.AllDay || day.End.Sub(day.Start) != 24*time.Hour {
+		t.Errorf("unexpected all-day event %+v", day)
+	}
+
+	occurrences := Occurrences(sale, []*Event{override}, sale.Start, sale.Start.AddDate(1, 0, 0), 100)
+	want := []string{"2018-11-03 20:00", "2018-11-24 20:00"}
+	if len(occurrences) != len(want) {
+		t.Fatalf("got %d occurrences, want %v", len(occurrences), want)
+	}
+	for i, occurrence := range occurrences {
+		if got := occurrence.Start.Format(layout); got != want[i] {
+			t.Errorf("occurrence %d: got %s, want %s", i, got, want[i])
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, c := range []string{
+		"BEGIN:VEVENT\nDTSTART:20181111T000000Z\n",
+		"BEGIN:VEVENT\nSUMMARY:No start\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nDTSTART:20181111T000000Z\nRRULE:FREQ=HOURLY\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nDTSTART:20181111T000000Z\nDTEND:20181110T000000Z\nEND:VEVENT\n",
+	} {
+		if _, err := Parse(strings.NewReader(c)); err == nil {
+			t.Errorf("%q: expected an error", c)
+		}
+	}
+}
+
+const outlookCalendar = "BEGIN:VCALENDAR\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:windows\r\n" +
+	"DTSTART;TZID=China Standard Time:20181111T000000\r\n" +
+	"DTEND;TZID=China Standard Time:20181111T020000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:custom\r\n" +
+	"DTSTART;TZID=Custom:20181111T000000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:daylight\r\n" +
+	"DTSTART;TZID=Daylight:20181111T000000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:unknown\r\n" +
+	"DTSTART;TZID=Nowhere/City:20181111T000000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:cancelled\r\n" +
+	"STATUS:CANCELLED\r\n" +
+	"DTSTART:20181111T000000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:Custom\r\n" +
+	"BEGIN:STANDARD\r\n" +
+	"DTSTART:16010101T000000\r\n" +
+	"TZOFFSETFROM:+0530\r\n" +
+	"TZOFFSETTO:+0530\r\n" +
+	"END:STANDARD\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:Daylight\r\n" +
+	"BEGIN:STANDARD\r\n" +
+	"TZOFFSETTO:+0100\r\n" +
+	"END:STANDARD\r\n" +
+	"BEGIN:DAYLIGHT\r\n" +
+	"TZOFFSETTO:+0200\r\n" +
+	"END:DAYLIGHT\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseTimeZones(t *testing.T) {
+	events, err := Parse(strings.NewReader(outlookCalendar))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 5 {
+		t.Fatalf("got %d events, want 5", len(events))
+	}
+	windows, custom := events[0], events[1]
+	if got := windows.Start.UTC().Format(layout); windows.Skipped != "" || got != "2018-11-10 16:00" {
+		t.Errorf("windows time zone: got %s (%q), want 2018-11-10 16:00 UTC", got, windows.Skipped)
+	}
+	if got := custom.Start.UTC().Format(layout); custom.Skipped != "" || got != "2018-11-10 18:30" {
+		t.Errorf("custom time zone: got %s (%q), want 2018-11-10 18:30 UTC", got, custom.Skipped)
+	}
+	for _, event := range events[2:] {
+		if len(event.Skipped) == 0 {
+			t.Errorf("event %s should be skipped", event.UID)
+		}
+	}
+}
+
+func TestStarts(t *testing.T) {
+	for _, c := range []struct {
+		rule, dtstart string
+		want          []string
+	}{
+		{"FREQ=DAILY;INTERVAL=2;COUNT=3", "2018-10-30 09:00", []string{"2018-10-30 09:00", "2018-11-01 09:00", "2018-11-03 09:00"}},
+		{"FREQ=WEEKLY;BYDAY=MO,FR;UNTIL=20181109T090000Z", "2018-11-02 09:00", []string{"2018-11-02 09:00", "2018-11-05 09:00", "2018-11-09 09:00"}},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3", "2018-01-31 00:00", []string{"2018-01-31 00:00", "2018-02-28 00:00", "2018-03-31 00:00"}},
+		{"FREQ=MONTHLY;BYDAY=-1FR;COUNT=2", "2018-11-30 10:00", []string{"2018-11-30 10:00", "2018-12-28 10:00"}},
+		{"FREQ=YEARLY;BYMONTH=11;BYDAY=4TH;COUNT=2", "2018-11-22 00:00", []string{"2018-11-22 00:00", "2019-11-28 00:00"}},
+		{"FREQ=YEARLY;COUNT=3", "2018-11-11 00:00", []string{"2018-11-11 00:00", "2019-11-11 00:00", "2020-11-11 00:00"}},
+	} {
+		rule, err := parseRRule(c.rule)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.rule, err)
+			continue
+		}
+		dtstart, _ := time.ParseInLocation(layout, c.dtstart, time.UTC)
+		starts := rule.starts(dtstart, dtstart.AddDate(5, 0, 0))
+		got := make([]string, 0, len(starts))
+		for _, start := range starts {
+			got = append(got, start.Format(layout))
+		}
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("%q from %s: got %v, want %v", c.rule, c.dtstart, got, c.want)
+		}
+	}
+}
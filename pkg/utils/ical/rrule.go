@@ -0,0 +1,295 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ical
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequencies of a recurrence rule.
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+// RRule is a recurrence rule. The rule parts FREQ, INTERVAL, COUNT, UNTIL,
+// BYMONTH, BYMONTHDAY, BYDAY and WKST are supported, with daily or coarser
+// frequencies. Every occurrence starts at the time of day of the event.
+type RRule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByMonth    []int
+	ByMonthDay []int
+	ByDay      []WeekdayNum
+	WeekStart  time.Weekday
+	// untilFloating is set if UNTIL has no time zone.
+	untilFloating bool
+}
+
+// WeekdayNum is a BYDAY entry, e.g. -1FR is the last Friday. N is 0 for
+// every such weekday.
+type WeekdayNum struct {
+	N       int
+	Weekday time.Weekday
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// maxRecurrenceDays bounds the expansion of a rule without COUNT or UNTIL.
+const maxRecurrenceDays = 100 * 366
+
+func parseRRule(value string) (*RRule, error) {
+	rule := &RRule{Interval: 1, WeekStart: time.Monday}
+	for _, part := range strings.Split(value, ";") {
+		keyValue := strings.SplitN(part, "=", 2)
+		if len(keyValue) != 2 {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+		key, v := strings.ToUpper(keyValue[0]), strings.ToUpper(keyValue[1])
+		var err error
+		switch key {
+		case "FREQ":
+			if v != Daily && v != Weekly && v != Monthly && v != Yearly {
+				return nil, fmt.Errorf("unsupported frequency %s", v)
+			}
+			rule.Freq = v
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(v)
+			if err == nil && rule.Interval < 1 {
+				err = fmt.Errorf("interval must be positive")
+			}
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(v)
+			if err == nil && rule.Count < 1 {
+				err = fmt.Errorf("count must be positive")
+			}
+		case "UNTIL":
+			rule.Until, _, err = parseTime(v, nil, time.UTC)
+			rule.untilFloating = !strings.HasSuffix(v, "Z")
+		case "BYMONTH":
+			rule.ByMonth, err = parseInts(v, 1, 12, false)
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parseInts(v, 1, 31, true)
+		case "BYDAY":
+			rule.ByDay, err = parseWeekdayNums(v)
+		case "WKST":
+			weekday, ok := weekdays[v]
+			if !ok {
+				err = fmt.Errorf("invalid weekday %s", v)
+			}
+			rule.WeekStart = weekday
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	if len(rule.Freq) == 0 {
+		return nil, fmt.Errorf("FREQ is missing")
+	}
+	for _, weekdayNum := range rule.ByDay {
+		if weekdayNum.N != 0 && rule.Freq != Monthly && rule.Freq != Yearly {
+			return nil, fmt.Errorf("BYDAY: numbered weekdays need a MONTHLY or YEARLY frequency")
+		}
+	}
+	return rule, nil
+}
+
+// parseInts parses a list of integers within [min, max], or within [-max, -min] if negative is set.
+func parseInts(value string, min, max int, negative bool) ([]int, error) {
+	ints := make([]int, 0)
+	for _, s := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", s)
+		}
+		if (n < min || n > max) && !(negative && -n >= min && -n <= max) {
+			return nil, fmt.Errorf("%d out of range", n)
+		}
+		ints = append(ints, n)
+	}
+	return ints, nil
+}
+
+func parseWeekdayNums(value string) ([]WeekdayNum, error) {
+	weekdayNums := make([]WeekdayNum, 0)
+	for _, s := range strings.Split(value, ",") {
+		if len(s) < 2 {
+			return nil, fmt.Errorf("invalid weekday %q", s)
+		}
+		weekday, ok := weekdays[s[len(s)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("invalid weekday %q", s)
+		}
+		n := 0
+		if len(s) > 2 {
+			var err error
+			n, err = strconv.Atoi(s[:len(s)-2])
+			if err != nil || n == 0 || n > 53 || n < -53 {
+				return nil, fmt.Errorf("invalid weekday %q", s)
+			}
+		}
+		weekdayNums = append(weekdayNums, WeekdayNum{N: n, Weekday: weekday})
+	}
+	return weekdayNums, nil
+}
+
+// starts returns the starts of the occurrences of the rule for an event
+// starting at dtstart, up to end. The event start is always the first
+// occurrence. A nil rule has the event start as its only occurrence.
+func (rule *RRule) starts(dtstart, end time.Time) []time.Time {
+	starts := make([]time.Time, 0)
+	if dtstart.After(end) {
+		return starts
+	}
+	starts = append(starts, dtstart)
+	if rule == nil {
+		return starts
+	}
+	location := dtstart.Location()
+	for i := 1; i < maxRecurrenceDays; i++ {
+		if rule.Count > 0 && len(starts) >= rule.Count {
+			break
+		}
+		t := time.Date(dtstart.Year(), dtstart.Month(), dtstart.Day()+i, dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, location)
+		if t.After(end) || (!rule.Until.IsZero() && t.After(rule.Until)) {
+			break
+		}
+		if rule.matches(dtstart, t) {
+			starts = append(starts, t)
+		}
+	}
+	return starts
+}
+
+// matches returns true if the day of t is an occurrence of the rule.
+func (rule *RRule) matches(dtstart, t time.Time) bool {
+	if !rule.inInterval(dtstart, t) {
+		return false
+	}
+	if len(rule.ByMonth) > 0 && !containsInt(rule.ByMonth, int(t.Month())) {
+		return false
+	}
+	if len(rule.ByMonthDay) > 0 && !rule.matchesMonthDay(t) {
+		return false
+	}
+	if len(rule.ByDay) > 0 {
+		return rule.matchesDay(t)
+	}
+	// Without BYxxx the rule repeats the day of the event start.
+	switch rule.Freq {
+	case Weekly:
+		return t.Weekday() == dtstart.Weekday()
+	case Monthly:
+		return len(rule.ByMonthDay) > 0 || t.Day() == dtstart.Day()
+	case Yearly:
+		if len(rule.ByMonthDay) > 0 {
+			return true
+		}
+		if len(rule.ByMonth) == 0 && t.Month() != dtstart.Month() {
+			return false
+		}
+		return t.Day() == dtstart.Day()
+	}
+	return true
+}
+
+// inInterval returns true if t is in a period of the rule's frequency which
+// is a multiple of the interval away from the period of dtstart.
+func (rule *RRule) inInterval(dtstart, t time.Time) bool {
+	var periods int
+	switch rule.Freq {
+	case Daily:
+		periods = daysBetween(dtstart, t)
+	case Weekly:
+		periods = daysBetween(rule.weekStart(dtstart), rule.weekStart(t)) / 7
+	case Monthly:
+		periods = (t.Year()-dtstart.Year())*12 + int(t.Month()) - int(dtstart.Month())
+	case Yearly:
+		periods = t.Year() - dtstart.Year()
+	}
+	return periods%rule.Interval == 0
+}
+
+func (rule *RRule) weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) - int(rule.WeekStart) + 7) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, time.UTC)
+}
+
+func (rule *RRule) matchesMonthDay(t time.Time) bool {
+	days := daysIn(t.Year(), t.Month())
+	for _, day := range rule.ByMonthDay {
+		if day == t.Day() || (day < 0 && days+day+1 == t.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesDay returns true if t is one of the weekdays. A numbered weekday
+// counts within the month, or within the year for a YEARLY rule without BYMONTH.
+func (rule *RRule) matchesDay(t time.Time) bool {
+	for _, weekdayNum := range rule.ByDay {
+		if weekdayNum.Weekday != t.Weekday() {
+			continue
+		}
+		if weekdayNum.N == 0 {
+			return true
+		}
+		day, days := t.Day(), daysIn(t.Year(), t.Month())
+		if rule.Freq == Yearly && len(rule.ByMonth) == 0 {
+			day, days = t.YearDay(), time.Date(t.Year(), time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+		}
+		if weekdayNum.N > 0 && (day-1)/7+1 == weekdayNum.N {
+			return true
+		}
+		if weekdayNum.N < 0 && (days-day)/7+1 == -weekdayNum.N {
+			return true
+		}
+	}
+	return false
+}
+
+func daysBetween(from, to time.Time) int {
+	a := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	b := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(b.Sub(a).Hours() / 24)
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func containsInt(ints []int, n int) bool {
+	for _, i := range ints {
+		if i == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ical
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// windowsZones maps the Windows time zone names used by Outlook and Exchange
+// as TZID to the IANA time zones, after the CLDR windowsZones table.
+var windowsZones = map[string]string{
+	"Dateline Standard Time":          "Etc/GMT+12",
+	"UTC-11":                          "Etc/GMT+11",
+	"Hawaiian Standard Time":          "Pacific/Honolulu",
+	"Alaskan Standard Time":           "America/Anchorage",
+	"Pacific Standard Time (Mexico)":  "America/Tijuana",
+	"Pacific Standard Time":           "America/Los_Angeles",
+	"US Mountain Standard Time":       "America/Phoenix",
+	"Mountain Standard Time (Mexico)": "America/Chihuahua",
+	"Mountain Standard Time":          "America/Denver",
+	"Central America Standard Time":   "America/Guatemala",
+	"Central Standard Time":           "America/Chicago",
+	"Central Standard Time (Mexico)":  "America/Mexico_City",
+	"Canada Central Standard Time":    "America/Regina",
+	"SA Pacific Standard Time":        "America/Bogota",
+	"Eastern Standard Time":           "America/New_York",
+	"US Eastern Standard Time":        "America/Indiana/Indianapolis",
+	"Venezuela Standard Time":         "America/Caracas",
+	"Paraguay Standard Time":          "America/Asuncion",
+	"Atlantic Standard Time":          "America/Halifax",
+	"Central Brazilian Standard Time": "America/Cuiaba",
+	"SA Western Standard Time":        "America/La_Paz",
+	"Pacific SA Standard Time":        "America/Santiago",
+	"Newfoundland Standard Time":      "America/St_Johns",
+	"E. South America Standard Time":  "America/Sao_Paulo",
+	"Argentina Standard Time":         "America/Argentina/Buenos_Aires",
+	"SA Eastern Standard Time":        "America/Cayenne",
+	"Greenland Standard Time":         "America/Godthab",
+	"Montevideo Standard Time":        "America/Montevideo",
+	"UTC-02":                          "Etc/GMT+2",
+	"Azores Standard Time":            "Atlantic/Azores",
+	"Cape Verde Standard Time":        "Atlantic/Cape_Verde",
+	"Morocco Standard Time":           "Africa/Casablanca",
+	"UTC":                             "Etc/UTC",
+	"GMT Standard Time":               "Europe/London",
+	"Greenwich Standard Time":         "Atlantic/Reykjavik",
+	"W. Europe Standard Time":         "Europe/Berlin",
+	"Central Europe Standard Time":    "Europe/Budapest",
+	"Romance Standard Time":           "Europe/Paris",
+	"Central European Standard Time":  "Europe/Warsaw",
+	"W. Central Africa Standard Time": "Africa/Lagos",
+	"Namibia Standard Time":           "Africa/Windhoek",
+	"Jordan Standard Time":            "Asia/Amman",
+	"GTB Standard Time":               "Europe/Bucharest",
+	"Middle East Standard Time":       "Asia/Beirut",
+	"Egypt Standard Time":             "Africa/Cairo",
+	"Syria Standard Time":             "Asia/Damascus",
+	"E. Europe Standard Time":         "Europe/Chisinau",
+	"South Africa Standard Time":      "Africa/Johannesburg",
+	"FLE Standard Time":               "Europe/Kiev",
+	"Turkey Standard Time":            "Europe/Istanbul",
+	"Israel Standard Time":            "Asia/Jerusalem",
+	"Arabic Standard Time":            "Asia/Baghdad",
+	"Arab Standard Time":              "Asia/Riyadh",
+	"Russian Standard Time":           "Europe/Moscow",
+	"E. Africa Standard Time":         "Africa/Nairobi",
+	"Iran Standard Time":              "Asia/Tehran",
+	"Arabian Standard Time":           "Asia/Dubai",
+	"Azerbaijan Standard Time":        "Asia/Baku",
+	"Mauritius Standard Time":         "Indian/Mauritius",
+	"Georgian Standard Time":          "Asia/Tbilisi",
+	"Caucasus Standard Time":          "Asia/Yerevan",
+	"Afghanistan Standard Time":       "Asia/Kabul",
+	"West Asia Standard Time":         "Asia/Tashkent",
+	"Ekaterinburg Standard Time":      "Asia/Yekaterinburg",
+	"Pakistan Standard Time":          "Asia/Karachi",
+	"India Standard Time":             "Asia/Kolkata",
+	"Sri Lanka Standard Time":         "Asia/Colombo",
+	"Nepal Standard Time":             "Asia/Kathmandu",
+	"Central Asia Standard Time":      "Asia/Almaty",
+	"Bangladesh Standard Time":        "Asia/Dhaka",
+	"Myanmar Standard Time":           "Asia/Rangoon",
+	"SE Asia Standard Time":           "Asia/Bangkok",
+	"N. Central Asia Standard Time":   "Asia/Novosibirsk",
+	"North Asia Standard Time":        "Asia/Krasnoyarsk",
+	"China Standard Time":             "Asia/Shanghai",
+	"North Asia East Standard Time":   "Asia/Irkutsk",
+	"Singapore Standard Time":         "Asia/Singapore",
+	"W. Australia Standard Time":      "Australia/Perth",
+	"Taipei Standard Time":            "Asia/Taipei",
+	"Ulaanbaatar Standard Time":       "Asia/Ulaanbaatar",
+	"Tokyo Standard Time":             "Asia/Tokyo",
+	"Korea Standard Time":             "Asia/Seoul",
+	"Yakutsk Standard Time":           "Asia/Yakutsk",
+	"Cen. Australia Standard Time":    "Australia/Adelaide",
+	"AUS Central Standard Time":       "Australia/Darwin",
+	"E. Australia Standard Time":      "Australia/Brisbane",
+	"AUS Eastern Standard Time":       "Australia/Sydney",
+	"West Pacific Standard Time":      "Pacific/Port_Moresby",
+	"Tasmania Standard Time":          "Australia/Hobart",
+	"Vladivostok Standard Time":       "Asia/Vladivostok",
+	"Magadan Standard Time":           "Asia/Magadan",
+	"Central Pacific Standard Time":   "Pacific/Guadalcanal",
+	"New Zealand Standard Time":       "Pacific/Auckland",
+	"UTC+12":                          "Etc/GMT-12",
+	"Fiji Standard Time":              "Pacific/Fiji",
+	"Tonga Standard Time":             "Pacific/Tongatapu",
+	"Samoa Standard Time":             "Pacific/Apia",
+}
+
+// unknownZoneError is returned for a TZID which can't be resolved.
+type unknownZoneError struct {
+	tzid string
+}
+
+func (e *unknownZoneError) Error() string {
+	return fmt.Sprintf("unknown time zone %q", e.tzid)
+}
+
+// timeZones are the locations of the VTIMEZONE components of a calendar
+// which are neither IANA nor Windows time zones, by TZID.
+type timeZones map[string]*time.Location
+
+// add resolves the location of a VTIMEZONE from its X-LIC-LOCATION, or from
+// its offset if it has no daylight saving time rules. Time zones with custom
+// daylight saving time rules aren't supported.
+func (zones timeZones) add(c *component) {
+	var tzid string
+	offsets := make(map[string]bool)
+	var offset string
+	for _, p := range c.properties {
+		switch p.name {
+		case "TZID":
+			tzid = p.value
+		case "X-LIC-LOCATION":
+			if location, err := time.LoadLocation(p.value); err == nil {
+				zones[tzid] = location
+				return
+			}
+		case "TZOFFSETTO":
+			offset = p.value
+			offsets[offset] = true
+		}
+	}
+	if len(tzid) == 0 || c.daylight || len(offsets) != 1 {
+		return
+	}
+	if seconds, err := parseOffset(offset); err == nil {
+		zones[tzid] = time.FixedZone(tzid, seconds)
+	}
+}
+
+// location returns the location of a TZID, which is an IANA time zone, a
+// Windows time zone or the TZID of a VTIMEZONE of the calendar.
+func (zones timeZones) location(tzid string) (*time.Location, error) {
+	if location, err := time.LoadLocation(tzid); err == nil {
+		return location, nil
+	}
+	if name, ok := windowsZones[tzid]; ok {
+		if location, err := time.LoadLocation(name); err == nil {
+			return location, nil
+		}
+	}
+	if location, ok := zones[tzid]; ok {
+		return location, nil
+	}
+	return nil, &unknownZoneError{tzid: tzid}
+}
+
+// parseOffset parses a UTC offset value, e.g. +0800 or -033000, in seconds.
+func parseOffset(value string) (int, error) {
+	if (len(value) != 5 && len(value) != 7) || (value[0] != '+' && value[0] != '-') {
+		return 0, fmt.Errorf("invalid offset %q", value)
+	}
+	var hours, minutes, seconds int
+	if _, err := fmt.Sscanf(value[1:5], "%02d%02d", &hours, &minutes); err != nil {
+		return 0, fmt.Errorf("invalid offset %q", value)
+	}
+	if len(value) == 7 {
+		if _, err := fmt.Sscanf(value[5:], "%02d", &seconds); err != nil {
+			return 0, fmt.Errorf("invalid offset %q", value)
+		}
+	}
+	offset := hours*3600 + minutes*60 + seconds
+	if strings.HasPrefix(value, "-") {
+		offset = -offset
+	}
+	return offset, nil
+}
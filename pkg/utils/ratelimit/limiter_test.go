@@ -0,0 +1,63 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterReserve(t *testing.T) {
+	now := time.Unix(1540000000, 0)
+	l := NewLimiter(2)
+	l.now = func() time.Time { return now }
+
+	// The burst of 2 is let through at once, then one event every 500ms.
+	for i, want := range []time.Duration{0, 0, 500 * time.Millisecond, time.Second} {
+		if got := l.reserve(); got != want {
+			t.Errorf("event %d: got delay %v, want %v", i, got, want)
+		}
+	}
+	// Tokens are refilled as time passes, up to the burst.
+	now = now.Add(time.Hour)
+	for i, want := range []time.Duration{0, 0, 500 * time.Millisecond} {
+		if got := l.reserve(); got != want {
+			t.Errorf("event %d after an hour: got delay %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestLimiterWait(t *testing.T) {
+	if l := NewLimiter(0); l != nil {
+		t.Fatalf("expected no limiter for a qps of 0")
+	}
+	var unlimited *Limiter
+	if err := unlimited.Wait(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	l := NewLimiter(0.001)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected the wait to be cancelled, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeLayout is the layout of the times without a time zone accepted by the API.
+const TimeLayout = "2006-01-02 15:04:05"
+
+// ParseTime parses a time in RFC3339 format (e.g. "2018-11-11T00:00:00+08:00"),
+// falling back to TimeLayout in the given location.
+func ParseTime(s string, location *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(TimeLayout, s, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("time must be formatted as RFC3339 or %s: %q", TimeLayout, s)
+	}
+	return t, nil
+}
+
+// LoadLocation returns the location of an IANA time zone name, the local
+// time zone if the name is empty.
+func LoadLocation(name string) (*time.Location, error) {
+	if len(name) == 0 {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return location, nil
+}